@@ -17,7 +17,13 @@ package wikibase
 // Most API structs are not exported, as they're not exposed by the library API
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
 )
 
 type WikiBaseType string
@@ -33,10 +39,128 @@ type APIError struct {
 	Info string `json:"info"`
 }
 
+// ErrRateLimited matches, using errors.Is, the errors returned when the user has made too many requests of some kind
+// in a short time, either as a "ratelimited" APIError or as an HTTPError for a 429 response. MediaWiki does not say
+// when the limit resets in its API errors, but when the server sends a Retry-After header it is in the HTTPError.
+var ErrRateLimited = errors.New("Rate limited by wikibase")
+
+// Is allows errors.Is to match rate limit errors against ErrRateLimited.
+func (e *APIError) Is(target error) bool {
+	return target == ErrRateLimited && e.Code == "ratelimited"
+}
+
 func (e *APIError) Error() string {
+	if e.Code == "badtags" || strings.HasPrefix(e.Code, "tags-") {
+		return fmt.Sprintf("Error from wikibase %s: %s (check all tags in Client.EditTags are registered on the wiki)",
+			e.Code, e.Info)
+	}
+	if e.Code == "assertuserfailed" {
+		return fmt.Sprintf("Error from wikibase %s: %s (the credentials used are not for the user in Client.AssertUser)",
+			e.Code, e.Info)
+	}
 	return fmt.Sprintf("Error from wikibase %s: %s", e.Code, e.Info)
 }
 
+// decodeEnvelope decodes an API response that wraps its payload under a top level key, such as "entity" for
+// wbsetlabel or "edit" for edit. If the response has an error then that is returned, and if it does not have the
+// expected key then an error is returned rather than leaving the payload empty. The payload may be nil if only the
+// presence of the key matters.
+func decodeEnvelope(r io.Reader, key string, payload interface{}) error {
+
+	var envelope map[string]json.RawMessage
+	err := json.NewDecoder(r).Decode(&envelope)
+	if err != nil {
+		return err
+	}
+
+	if raw, ok := envelope["error"]; ok {
+		var api_err APIError
+		err = json.Unmarshal(raw, &api_err)
+		if err != nil {
+			return fmt.Errorf("Failed to decode error from server: %s", raw)
+		}
+		return &api_err
+	}
+
+	raw, ok := envelope[key]
+	if !ok {
+		keys := make([]string, 0, len(envelope))
+		for k := range envelope {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("Expected %s in response from server, got %v", key, keys)
+	}
+
+	if payload == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, payload)
+}
+
+// ProtectedPageError is returned when an edit is rejected because the page is protected and the user does not have
+// the editprotected right. Users with that right are allowed to edit protected pages by the server directly.
+type ProtectedPageError struct {
+	APIError
+	Title string
+}
+
+func (e *ProtectedPageError) Error() string {
+	return fmt.Sprintf("Page %s is protected and can not be edited by this user: %s", e.Title, e.Info)
+}
+
+// PatrolError is returned by PatrolRevision when the revision can not be patrolled, either because it is not in the
+// recent changes list (code "nosuchrcid") or because the user may not patrol their own edits (code "noautopatrol").
+type PatrolError struct {
+	APIError
+	RevID int
+}
+
+func (e *PatrolError) Error() string {
+	return fmt.Sprintf("Revision %d can not be patrolled: %s", e.RevID, e.Info)
+}
+
+// NoSuchRevisionError is returned by CompareRevisions when either of the revisions does not exist.
+type NoSuchRevisionError struct {
+	APIError
+	FromRev int
+	ToRev   int
+}
+
+func (e *NoSuchRevisionError) Error() string {
+	return fmt.Sprintf("Can not compare revisions %d and %d: %s", e.FromRev, e.ToRev, e.Info)
+}
+
+// UnmappedPropertiesError is returned by ValidatePropertyMap when property tags on a struct have no entry in the
+// client's property map.
+type UnmappedPropertiesError struct {
+	Labels []string
+}
+
+func (e *UnmappedPropertiesError) Error() string {
+	return fmt.Sprintf("No property map for property labels: %s", strings.Join(e.Labels, ", "))
+}
+
+// MappingErrors is returned by MapAllPropertyAndItemConfiguration when some labels could not be mapped, and holds the
+// error for each of those labels.
+type MappingErrors struct {
+	Errors map[string]error
+}
+
+func (e *MappingErrors) Error() string {
+	labels := make([]string, 0, len(e.Errors))
+	for label := range e.Errors {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	messages := make([]string, len(labels))
+	for index, label := range labels {
+		messages[index] = fmt.Sprintf("%s: %v", label, e.Errors[label])
+	}
+	return fmt.Sprintf("Failed to map %d labels: %s", len(labels), strings.Join(messages, "; "))
+}
+
 // Mediawiki API response structs
 
 type generalMediaWikiResponse struct {
@@ -57,6 +181,60 @@ type tokenRequestResponse struct {
 	Query tokensQuery `json:"query"`
 }
 
+type typedTokensQuery struct {
+	Tokens map[string]string `json:"tokens"`
+}
+
+type typedTokenRequestResponse struct {
+	generalMediaWikiResponse
+	Query typedTokensQuery `json:"query"`
+	Error *APIError        `json:"error"`
+}
+
+// UserInfo describes the account the client is making requests as, as returned by a call to Client.UserInfo.
+type UserInfo struct {
+	ID     int      `json:"id"`
+	Name   string   `json:"name"`
+	Anon   *string  `json:"anon"`
+	Groups []string `json:"groups"`
+	Rights []string `json:"rights"`
+}
+
+// IsAnonymous returns true if the server did not recognise the request as being from a logged in user.
+func (u *UserInfo) IsAnonymous() bool {
+	return u.Anon != nil || u.ID == 0
+}
+
+// HasRight returns true if the user has the named right, e.g. "bot" or "editprotected".
+func (u *UserInfo) HasRight(right string) bool {
+	for _, r := range u.Rights {
+		if r == right {
+			return true
+		}
+	}
+	return false
+}
+
+// InGroup returns true if the user is a member of the named group, e.g. "bot" or "sysop".
+func (u *UserInfo) InGroup(group string) bool {
+	for _, g := range u.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+type userInfoQuery struct {
+	UserInfo UserInfo `json:"userinfo"`
+}
+
+type userInfoResponse struct {
+	generalMediaWikiResponse
+	Query userInfoQuery `json:"query"`
+	Error *APIError     `json:"error"`
+}
+
 type searchItem struct {
 	Duration    int    `json:"ns"`
 	Title       string `json:"title"`
@@ -73,6 +251,171 @@ type searchQueryResponse struct {
 	Query searchQuery `json:"query"`
 }
 
+type entitySearchMatch struct {
+	ID          ItemPropertyType `json:"id"`
+	Label       string           `json:"label"`
+	Description string           `json:"description"`
+}
+
+type entitySearchResponse struct {
+	Search  []entitySearchMatch `json:"search"`
+	Success int                 `json:"success"`
+	Error   *APIError           `json:"error"`
+}
+
+type statementSearchResult struct {
+	NS     int    `json:"ns"`
+	Title  string `json:"title"`
+	PageID int    `json:"pageid"`
+}
+
+type statementSearchQuery struct {
+	Search []statementSearchResult `json:"search"`
+}
+
+type statementSearchContinue struct {
+	SROffset int `json:"sroffset"`
+}
+
+type statementSearchResponse struct {
+	generalMediaWikiResponse
+	Query    statementSearchQuery     `json:"query"`
+	Continue *statementSearchContinue `json:"continue"`
+	Error    *APIError                `json:"error"`
+}
+
+type siteInfoNamespace struct {
+	ID        int    `json:"id"`
+	Canonical string `json:"canonical"`
+	Name      string `json:"*"`
+}
+
+type siteInfoNamespacesResponse struct {
+	Query struct {
+		Namespaces map[string]siteInfoNamespace `json:"namespaces"`
+	} `json:"query"`
+	Error *APIError `json:"error"`
+}
+
+// RecentChange is an entry from the wiki's recent changes list, as returned by Client.RecentChanges. Type is one of
+// "edit", "new", "log", "external", or "categorize".
+type RecentChange struct {
+	Type      string    `json:"type"`
+	NS        int       `json:"ns"`
+	Title     string    `json:"title"`
+	PageID    int       `json:"pageid"`
+	RevID     int       `json:"revid"`
+	OldRevID  int       `json:"old_revid"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type recentChangesQuery struct {
+	RecentChanges []RecentChange `json:"recentchanges"`
+}
+
+type recentChangesContinue struct {
+	RCContinue string `json:"rccontinue"`
+	Continue   string `json:"continue"`
+}
+
+type recentChangesResponse struct {
+	generalMediaWikiResponse
+	Query    recentChangesQuery     `json:"query"`
+	Continue *recentChangesContinue `json:"continue"`
+	Error    *APIError              `json:"error"`
+}
+
+type normalizedTitle struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type pageQueryInfo struct {
+	PageID  int     `json:"pageid"`
+	NS      int     `json:"ns"`
+	Title   string  `json:"title"`
+	Missing *string `json:"missing"`
+	Invalid *string `json:"invalid"`
+}
+
+type pageQuery struct {
+	Normalized []normalizedTitle        `json:"normalized"`
+	Pages      map[string]pageQueryInfo `json:"pages"`
+}
+
+type pageQueryResponse struct {
+	generalMediaWikiResponse
+	Query pageQuery `json:"query"`
+	Error *APIError `json:"error"`
+}
+
+// canonicalTitle follows any normalisation the server applied to the title we asked for.
+func (q *pageQuery) canonicalTitle(title string) string {
+	for _, n := range q.Normalized {
+		if n.From == title {
+			return n.To
+		}
+	}
+	return title
+}
+
+type revisionSlot struct {
+	ContentModel string `json:"contentmodel"`
+	Content      string `json:"*"`
+}
+
+type revisionInfo struct {
+	RevID    int                     `json:"revid"`
+	ParentID int                     `json:"parentid"`
+	Slots    map[string]revisionSlot `json:"slots"`
+}
+
+type revisionPageInfo struct {
+	pageQueryInfo
+	Revisions []revisionInfo `json:"revisions"`
+}
+
+type revisionQuery struct {
+	BadRevIDs map[string]json.RawMessage  `json:"badrevids"`
+	Pages     map[string]revisionPageInfo `json:"pages"`
+}
+
+type revisionQueryResponse struct {
+	generalMediaWikiResponse
+	Query revisionQuery `json:"query"`
+	Error *APIError     `json:"error"`
+}
+
+// Revision is an entry in the history of a page or entity, as returned by Client.GetEntityHistory.
+type Revision struct {
+	RevID     int       `json:"revid"`
+	ParentID  int       `json:"parentid"`
+	Timestamp time.Time `json:"timestamp"`
+	User      string    `json:"user"`
+	Comment   string    `json:"comment"`
+}
+
+type historyPageInfo struct {
+	pageQueryInfo
+	Revisions []Revision `json:"revisions"`
+}
+
+type historyQuery struct {
+	Pages map[string]historyPageInfo `json:"pages"`
+}
+
+type historyContinue struct {
+	RVContinue string `json:"rvcontinue"`
+	Continue   string `json:"continue"`
+}
+
+type historyResponse struct {
+	generalMediaWikiResponse
+	Query    historyQuery     `json:"query"`
+	Continue *historyContinue `json:"continue"`
+	Error    *APIError        `json:"error"`
+}
+
 type articleEditDetailResponse struct {
 	ContentModel  string  `json:"contentmodel"`
 	New           *string `json:"new"`
@@ -96,12 +439,30 @@ type itemLabel struct {
 	Value    string `json:"value"`
 }
 
+type sitelinkInfo struct {
+	Site   string   `json:"site"`
+	Title  string   `json:"title"`
+	Badges []string `json:"badges"`
+	URL    string   `json:"url"`
+}
+
+type entityRedirect struct {
+	From ItemPropertyType `json:"from"`
+	To   ItemPropertyType `json:"to"`
+}
+
 type itemEntity struct {
-	Labels         map[string]itemLabel   `json:"labels"`
-	Claims         map[string][]claimInfo `json:"claims"`
-	ID             ItemPropertyType       `json:"id"`
-	Type           string                 `json:"type"`
-	LastRevisionID int                    `json:"lastrevid"`
+	Labels         map[string]itemLabel    `json:"labels"`
+	Descriptions   map[string]itemLabel    `json:"descriptions"`
+	Aliases        map[string][]itemLabel  `json:"aliases"`
+	Claims         map[string][]Claim      `json:"claims"`
+	Sitelinks      map[string]sitelinkInfo `json:"sitelinks"`
+	ID             ItemPropertyType        `json:"id"`
+	Type           string                  `json:"type"`
+	Title          string                  `json:"title"`
+	LastRevisionID int                     `json:"lastrevid"`
+	Missing        *string                 `json:"missing"`
+	Redirects      *entityRedirect         `json:"redirects"`
 }
 
 type itemEditResponse struct {
@@ -110,29 +471,26 @@ type itemEditResponse struct {
 	Error   *APIError   `json:"error"`
 }
 
-type pageInfo struct {
-	LastRevisionID int `json:"lastrevid"`
+type getEntitiesResponse struct {
+	Entities map[string]itemEntity `json:"entities"`
+	Success  int                   `json:"success"`
+	Error    *APIError             `json:"error"`
 }
 
-type snakInfo struct {
-	SnakType string `json:"snaktype"`
-	Property string `json:"property"`
-	Hash     string `json:"hash"`
-	DataType string `json:"datatype"`
-	// Ignoring datavalue for now...
+type pageInfo struct {
+	LastRevisionID int `json:"lastrevid"`
 }
 
-type claimInfo struct {
-	MainSnak snakInfo `json:"mainsnak"`
-	Type     string   `json:"type"`
-	ID       string   `json:"id"`
-	Rank     string   `json:"rank"`
+type getClaimsResponse struct {
+	Claims   map[string][]Claim `json:"claims"`
+	Error    *APIError          `json:"error"`
+	Continue map[string]string  `json:"continue"`
 }
 
 type setCreateResponse struct {
 	PageInfo pageInfo  `json:"pageinfo"`
 	Success  int       `json:"success"`
-	Claim    claimInfo `json:"claim"`
+	Claim    Claim     `json:"claim"`
 	Error    *APIError `json:"error"`
 }
 
@@ -152,3 +510,50 @@ type protectResponse struct {
 	Protect *protectDetailResponse `json:"protect"`
 	Error   *APIError              `json:"error"`
 }
+
+type undeleteDetailResponse struct {
+	Title        string `json:"title"`
+	Revisions    int    `json:"revisions"`
+	FileVersions int    `json:"fileversions"`
+	Reason       string `json:"reason"`
+}
+
+type undeleteResponse struct {
+	Undelete *undeleteDetailResponse `json:"undelete"`
+	Error    *APIError               `json:"error"`
+}
+
+type watchDetailResponse struct {
+	Title     string  `json:"title"`
+	Watched   *string `json:"watched"`
+	Unwatched *string `json:"unwatched"`
+	Missing   *string `json:"missing"`
+	Invalid   *string `json:"invalid"`
+}
+
+type watchResponse struct {
+	Watch []watchDetailResponse `json:"watch"`
+	Error *APIError             `json:"error"`
+}
+
+type compareDetailResponse struct {
+	FromRevID int    `json:"fromrevid"`
+	ToRevID   int    `json:"torevid"`
+	Body      string `json:"*"`
+}
+
+type compareResponse struct {
+	Compare *compareDetailResponse `json:"compare"`
+	Error   *APIError              `json:"error"`
+}
+
+type patrolDetailResponse struct {
+	RCID  int    `json:"rcid"`
+	NS    int    `json:"ns"`
+	Title string `json:"title"`
+}
+
+type patrolResponse struct {
+	Patrol *patrolDetailResponse `json:"patrol"`
+	Error  *APIError             `json:"error"`
+}
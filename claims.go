@@ -0,0 +1,775 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// These structs are used when reading claims back from Wikibase, and are more complete than those used internally
+// when writing, as they include the values, qualifiers, and references.
+
+// DataValue is the value of a snak. The format of Value depends on Type, so it is left for the caller to decode.
+type DataValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// StringValue decodes the value as a string, for values of type "string".
+func (d *DataValue) StringValue() (string, error) {
+	if d.Type != "string" {
+		return "", fmt.Errorf("Expected string value, got %s", d.Type)
+	}
+	var value string
+	err := json.Unmarshal(d.Value, &value)
+	return value, err
+}
+
+// EntityID decodes the value as an entity ID, such as an item Q number, for values of type "wikibase-entityid".
+func (d *DataValue) EntityID() (ItemPropertyType, error) {
+	if d.Type != "wikibase-entityid" {
+		return "", fmt.Errorf("Expected entity ID value, got %s", d.Type)
+	}
+	var value struct {
+		EntityType string           `json:"entity-type"`
+		NumericID  int              `json:"numeric-id"`
+		ID         ItemPropertyType `json:"id"`
+	}
+	err := json.Unmarshal(d.Value, &value)
+	if err != nil {
+		return "", err
+	}
+	if len(value.ID) > 0 {
+		return value.ID, nil
+	}
+	// Older servers only return the numeric ID
+	for prefix, entity_type := range DefaultEntityTypePrefixes {
+		if entity_type == value.EntityType {
+			return ItemPropertyType(fmt.Sprintf("%s%d", prefix, value.NumericID)), nil
+		}
+	}
+	return "", fmt.Errorf("Unrecognised entity type %s", value.EntityType)
+}
+
+// QuantityValue is the decoded value of a quantity snak. The numbers are kept as json.Number, so that large values
+// are not rounded by being decoded as floats, and can be converted with their Int64 or Float64 methods. The bounds
+// are nil if the quantity has none.
+type QuantityValue struct {
+	Amount     json.Number
+	Unit       string
+	UpperBound *json.Number
+	LowerBound *json.Number
+}
+
+// quantityNumber converts a quantity number, which Wikibase sends as a string with a leading sign but other tools may
+// send as a JSON number, into a json.Number.
+func quantityNumber(value interface{}) (json.Number, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v, nil
+	case string:
+		number := json.Number(strings.TrimPrefix(v, "+"))
+		if _, err := number.Float64(); err != nil {
+			return "", fmt.Errorf("Quantity %s is not a number", v)
+		}
+		return number, nil
+	default:
+		return "", fmt.Errorf("Quantity %v is not a number", value)
+	}
+}
+
+// Quantity decodes the value as a quantity, for values of type "quantity".
+func (d *DataValue) Quantity() (*QuantityValue, error) {
+	if d.Type != "quantity" {
+		return nil, fmt.Errorf("Expected quantity value, got %s", d.Type)
+	}
+	var value struct {
+		Amount     interface{} `json:"amount"`
+		Unit       string      `json:"unit"`
+		UpperBound interface{} `json:"upperBound"`
+		LowerBound interface{} `json:"lowerBound"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(d.Value))
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := quantityNumber(value.Amount)
+	if err != nil {
+		return nil, err
+	}
+	quantity := QuantityValue{Amount: amount, Unit: value.Unit}
+	if value.UpperBound != nil {
+		bound, err := quantityNumber(value.UpperBound)
+		if err != nil {
+			return nil, err
+		}
+		quantity.UpperBound = &bound
+	}
+	if value.LowerBound != nil {
+		bound, err := quantityNumber(value.LowerBound)
+		if err != nil {
+			return nil, err
+		}
+		quantity.LowerBound = &bound
+	}
+	return &quantity, nil
+}
+
+// Snak is a single property/value pair, used for the main value of a claim and for its qualifiers and references.
+// DataValue will be nil if SnakType is "novalue" or "somevalue".
+type Snak struct {
+	SnakType  string     `json:"snaktype"`
+	Property  string     `json:"property"`
+	Hash      string     `json:"hash,omitempty"`
+	DataType  string     `json:"datatype,omitempty"`
+	DataValue *DataValue `json:"datavalue,omitempty"`
+}
+
+// Reference is a set of snaks that together describe the source of a claim.
+type Reference struct {
+	Hash       string            `json:"hash,omitempty"`
+	Snaks      map[string][]Snak `json:"snaks"`
+	SnaksOrder []string          `json:"snaks-order"`
+}
+
+// Claim is a statement on an entity, along with its qualifiers and references.
+type Claim struct {
+	ID              string            `json:"id,omitempty"`
+	Type            string            `json:"type"`
+	Rank            string            `json:"rank"`
+	MainSnak        Snak              `json:"mainsnak"`
+	Qualifiers      map[string][]Snak `json:"qualifiers,omitempty"`
+	QualifiersOrder []string          `json:"qualifiers-order,omitempty"`
+	References      []Reference       `json:"references,omitempty"`
+}
+
+// Claim ranks as used by Wikibase.
+const (
+	RankPreferred  = "preferred"
+	RankNormal     = "normal"
+	RankDeprecated = "deprecated"
+)
+
+func validateRank(rank string) error {
+	switch rank {
+	case RankPreferred, RankNormal, RankDeprecated:
+		return nil
+	default:
+		return fmt.Errorf("Unrecognised claim rank %s", rank)
+	}
+}
+
+// QualifiersForProperty returns the qualifiers on the claim for the given property ID.
+func (c *Claim) QualifiersForProperty(property_id string) []Snak {
+	return c.Qualifiers[property_id]
+}
+
+// QualifierProperties returns the property IDs of the qualifiers on the claim, in the order Wikibase has them.
+func (c *Claim) QualifierProperties() []string {
+	return c.QualifiersOrder
+}
+
+// SnaksForProperty returns the snaks in the reference for the given property ID.
+func (r *Reference) SnaksForProperty(property_id string) []Snak {
+	return r.Snaks[property_id]
+}
+
+// GetClaims fetches all the claims on an entity, returning a map of property ID to the claims for that property.
+func (c *Client) GetClaims(id ItemPropertyType) (map[string][]Claim, error) {
+	return c.getClaims(id, "")
+}
+
+// GetBestClaims is like GetClaims, but only returns the best ranked claims for each property, as selected by
+// BestRankClaims. Properties with only deprecated claims are left out.
+func (c *Client) GetBestClaims(id ItemPropertyType) (map[string][]Claim, error) {
+	claims, err := c.getClaims(id, "")
+	if err != nil {
+		return nil, err
+	}
+
+	best := make(map[string][]Claim, len(claims))
+	for property_id, property_claims := range claims {
+		filtered := BestRankClaims(property_claims)
+		if len(filtered) > 0 {
+			best[property_id] = filtered
+		}
+	}
+	return best, nil
+}
+
+// BestRankClaims returns the claims with the best rank, following the Wikidata "truthy" semantics: the preferred
+// claims if there are any, otherwise the normal ones. Deprecated claims are never returned. The order of the claims
+// is kept.
+func BestRankClaims(claims []Claim) []Claim {
+	rank := RankNormal
+	for _, claim := range claims {
+		if claim.Rank == RankPreferred {
+			rank = RankPreferred
+			break
+		}
+	}
+
+	best := make([]Claim, 0, len(claims))
+	for _, claim := range claims {
+		if claim.Rank == rank {
+			best = append(best, claim)
+		}
+	}
+	return best
+}
+
+// DefaultFormatterURLProperty is the Wikidata property for the formatter URL of an external identifier property.
+const DefaultFormatterURLProperty = "P1630"
+
+// ResolveExternalID turns the value of an external identifier claim into a URL, using the formatter URL statement on
+// the property, with "$1" replaced by the value. If the property has several formatter URLs then the first of those
+// with the best rank is used. It is an error if the property has no formatter URL.
+func (c *Client) ResolveExternalID(property_id string, value string) (string, error) {
+
+	if len(value) == 0 {
+		return "", fmt.Errorf("External ID value must not be an empty string.")
+	}
+	entity, err := c.entityClaimToAPIData(ItemPropertyType(property_id))
+	if err != nil {
+		return "", err
+	}
+	if entity.EntityType != "property" {
+		return "", fmt.Errorf("Expected a property ID, got %s", property_id)
+	}
+
+	formatter_property := c.FormatterURLProperty
+	if len(formatter_property) == 0 {
+		formatter_property = DefaultFormatterURLProperty
+	}
+
+	claims, err := c.getClaimsForProperty(ItemPropertyType(property_id), formatter_property)
+	if err != nil {
+		return "", err
+	}
+	for _, claim := range BestRankClaims(claims) {
+		if claim.MainSnak.DataValue == nil {
+			continue
+		}
+		formatter, err := claim.MainSnak.DataValue.StringValue()
+		if err != nil {
+			return "", err
+		}
+		// Escape the value as Wikibase does, which leaves slashes and colons alone
+		escaped := strings.NewReplacer("%2F", "/", "%3A", ":").Replace(url.PathEscape(value))
+		return strings.Replace(formatter, "$1", escaped, -1), nil
+	}
+
+	return "", fmt.Errorf("Property %s has no formatter URL", property_id)
+}
+
+// DefaultInstanceOfProperty is the Wikidata "instance of" property.
+const DefaultInstanceOfProperty = "P31"
+
+// IsInstanceOf checks whether the item has a best ranked "instance of" statement with the class as its value. The
+// property used is the client's InstanceOfProperty, or DefaultInstanceOfProperty if that is not set.
+func (c *Client) IsInstanceOf(item ItemPropertyType, class ItemPropertyType) (bool, error) {
+
+	property_id := c.InstanceOfProperty
+	if len(property_id) == 0 {
+		property_id = DefaultInstanceOfProperty
+	}
+
+	if c.PreferSPARQLReads && len(c.SPARQLEndpoint) > 0 {
+		found, err := c.sparqlIsInstanceOf(item, class, property_id)
+		if err == nil {
+			return found, nil
+		}
+	}
+
+	claims, err := c.getClaimsForProperty(item, property_id)
+	if err != nil {
+		return false, err
+	}
+	for _, claim := range BestRankClaims(claims) {
+		if claim.MainSnak.DataValue == nil {
+			continue
+		}
+		value, err := claim.MainSnak.DataValue.EntityID()
+		if err == nil && value == class {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *Client) getClaimsForProperty(id ItemPropertyType, property_id string) ([]Claim, error) {
+	claims, err := c.getClaims(id, property_id)
+	if err != nil {
+		return nil, err
+	}
+	return claims[property_id], nil
+}
+
+// getClaims fetches the claims on an entity, optionally restricted to a single property if property_id is not empty.
+// If the server splits the claims over several responses with continuations, they are all fetched and combined.
+func (c *Client) getClaims(id ItemPropertyType, property_id string) (map[string][]Claim, error) {
+
+	if len(id) == 0 {
+		return nil, fmt.Errorf("Entity ID must not be an empty string.")
+	}
+
+	args := map[string]string{
+		"action": "wbgetclaims",
+		"entity": string(id),
+	}
+	if len(property_id) > 0 {
+		args["property"] = property_id
+	}
+
+	claims := make(map[string][]Claim)
+	seen := make(map[string]bool)
+	for {
+		response, err := c.get(args)
+		if err != nil {
+			return nil, err
+		}
+
+		var res getClaimsResponse
+		err = json.NewDecoder(response).Decode(&res)
+		response.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if res.Error != nil {
+			return nil, res.Error
+		}
+
+		for property, property_claims := range res.Claims {
+			if _, ok := claims[property]; !ok {
+				claims[property] = make([]Claim, 0, len(property_claims))
+			}
+			for _, claim := range property_claims {
+				// Don't repeat claims if the server's batches overlap
+				if len(claim.ID) > 0 && seen[claim.ID] {
+					continue
+				}
+				seen[claim.ID] = true
+				claims[property] = append(claims[property], claim)
+			}
+		}
+
+		if len(res.Continue) == 0 {
+			break
+		}
+		repeated := true
+		for key, value := range res.Continue {
+			if args[key] != value {
+				repeated = false
+			}
+			args[key] = value
+		}
+		if repeated {
+			return nil, fmt.Errorf("Server returned the same continuation twice: %v", res.Continue)
+		}
+	}
+
+	return claims, nil
+}
+
+// snakForValue builds the main snak for a claim on the property with the provided value, which can be of any type
+// supported by the struct tag based upload. A nil value gives a "no value" snak.
+func (c *Client) snakForValue(property_id string, property_label string, value interface{}) (Snak, error) {
+
+	snak := Snak{SnakType: "novalue", Property: property_id}
+	if value == nil {
+		return snak, nil
+	}
+
+	f := reflect.StructField{Name: property_label, Type: reflect.TypeOf(value)}
+	data, err := c.getItemCreateClaimValue(f, reflect.ValueOf(value))
+	if err != nil {
+		return Snak{}, err
+	}
+	if data == nil {
+		return snak, nil
+	}
+
+	raw, err := json.Marshal(data.Value)
+	if err != nil {
+		return Snak{}, err
+	}
+	snak.SnakType = "value"
+	snak.DataValue = &DataValue{Type: data.Type, Value: raw}
+
+	return snak, nil
+}
+
+// sameSnakValue returns true if the snak read back from the server has the same type and value as the snak built
+// locally. The server adds fields to some values and doesn't keep the order of the fields, so the values are compared
+// field by field as for snakHasEncodedValue.
+func sameSnakValue(stored Snak, local Snak) bool {
+	if stored.SnakType != local.SnakType {
+		return false
+	}
+	if local.DataValue == nil {
+		return stored.DataValue == nil
+	}
+	if stored.DataValue == nil || stored.DataValue.Type != local.DataValue.Type {
+		return false
+	}
+	return snakHasEncodedValue(stored, local.DataValue.Value)
+}
+
+// setClaim writes the entire claim to Wikibase, creating it if a claim with that ID does not exist already.
+func (c *Client) setClaim(claim Claim) error {
+
+	b, err := json.Marshal(claim)
+	if err != nil {
+		return err
+	}
+
+	editToken, terr := c.GetEditingToken()
+	if terr != nil {
+		return terr
+	}
+
+	response, err := c.editPost(
+		map[string]string{
+			"action": "wbsetclaim",
+			"token":  editToken,
+			"claim":  string(b),
+			"bot":    "1",
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+
+	var res setCreateResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return err
+	}
+
+	if res.Error != nil {
+		return fmt.Errorf("Failed to set claim %s: %w", claim.ID, res.Error)
+	}
+
+	if res.Success != 1 {
+		return fmt.Errorf("We got an unexpected success value setting claim %s: %v", claim.ID, res)
+	}
+
+	return nil
+}
+
+// SetPreferredClaim sets the value for the property with the given label on the item as the preferred claim, and
+// demotes any other preferred claims for that property to normal rank, as is the convention on Wikidata for things
+// like "current population". If the item already has a claim with the same value that claim is promoted, otherwise
+// a new claim is created. All the changes are made in a single edit, so either they all apply or none do.
+func (c *Client) SetPreferredClaim(item ItemPropertyType, property_label string, value interface{}) error {
+
+	property_id, ok := c.PropertyMap[property_label]
+	if !ok {
+		return fmt.Errorf("No property map for property label %s", property_label)
+	}
+
+	snak, err := c.snakForValue(property_id, property_label, value)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal %s on %s: %v", property_id, item, err)
+	}
+
+	claims, err := c.getClaimsForProperty(item, property_id)
+	if err != nil {
+		return err
+	}
+
+	target := -1
+	for i := range claims {
+		if sameSnakValue(claims[i].MainSnak, snak) {
+			target = i
+			break
+		}
+	}
+
+	changed := make([]Claim, 0)
+	if target == -1 {
+		changed = append(changed, Claim{Type: "statement", MainSnak: snak, Rank: RankPreferred})
+	} else if claims[target].Rank != RankPreferred {
+		claim := claims[target]
+		claim.Rank = RankPreferred
+		changed = append(changed, claim)
+	}
+	for i, claim := range claims {
+		if i == target || claim.Rank != RankPreferred {
+			continue
+		}
+		claim.Rank = RankNormal
+		changed = append(changed, claim)
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(changed)
+	if err != nil {
+		return err
+	}
+	return c.SetClaims(item, b)
+}
+
+// SetRankForClaim sets the rank of the claim for the property with the given label on the item. The rank must be one
+// of RankPreferred, RankNormal, or RankDeprecated. As the claim is found by reading the item's claims, this will fail
+// if the item does not have exactly one claim for the property; use SetPreferredClaim to pick between several values.
+func (c *Client) SetRankForClaim(item ItemPropertyType, property_label string, rank string) error {
+
+	err := validateRank(rank)
+	if err != nil {
+		return err
+	}
+
+	property_id, ok := c.PropertyMap[property_label]
+	if !ok {
+		return fmt.Errorf("No property map for property label %s", property_label)
+	}
+
+	claims, err := c.getClaimsForProperty(item, property_id)
+	if err != nil {
+		return err
+	}
+
+	switch len(claims) {
+	case 0:
+		return fmt.Errorf("No claim found for %s on %s", property_id, item)
+	case 1:
+		claim := claims[0]
+		if claim.Rank == rank {
+			return nil
+		}
+		claim.Rank = rank
+		return c.setClaim(claim)
+	default:
+		return fmt.Errorf("Multiple claims found for %s on %s", property_id, item)
+	}
+}
+
+// SetClaims sets all the claims in the JSON encoded array of claims on the item in a single wbeditentity request, so
+// that they are applied together in one revision, and either all succeed or none do. Claims with an ID replace the
+// existing claim with that ID, and claims without are created.
+func (c *Client) SetClaims(item ItemPropertyType, claims []byte) error {
+	_, err := c.SetClaimsWithResult(item, claims)
+	return err
+}
+
+// SetClaimsWithResult is like SetClaims, but returns the claims as stored by the server, in the same order as they
+// were sent, so that the statement IDs of new claims are known.
+func (c *Client) SetClaimsWithResult(item ItemPropertyType, claims []byte) ([]Claim, error) {
+
+	if len(item) == 0 {
+		return nil, fmt.Errorf("Item ID must not be an empty string.")
+	}
+
+	var sent []Claim
+	err := json.Unmarshal(claims, &sent)
+	if err != nil {
+		return nil, fmt.Errorf("Claims must be a JSON array of claims: %v", err)
+	}
+	if len(sent) == 0 {
+		return nil, nil
+	}
+
+	sent_claims := make([]sentClaim, len(sent))
+	for index, claim := range sent {
+		sent_claims[index] = sentClaim{
+			ID:       claim.ID,
+			Property: claim.MainSnak.Property,
+			SnakType: claim.MainSnak.SnakType,
+		}
+		if claim.MainSnak.DataValue != nil {
+			sent_claims[index].Value = claim.MainSnak.DataValue.Value
+		}
+	}
+
+	_, result, err := c.editEntityClaims(item, &struct {
+		Claims json.RawMessage `json:"claims"`
+	}{Claims: claims}, sent_claims, false)
+	return result, err
+}
+
+// sentClaim identifies a claim sent with wbeditentity by its ID, which is empty for new claims, and its property,
+// along with its main snak's type and encoded value, which are used to find new claims if the edit needs retrying.
+type sentClaim struct {
+	ID       string
+	Property string
+	SnakType string
+	Value    []byte
+}
+
+// editEntityClaims sends the data to wbeditentity to edit the item, clearing it first if clear is set, and returns
+// the entity as stored by the server, along with the stored claims for each of the sent claims, in the same order.
+func (c *Client) editEntityClaims(item ItemPropertyType, data interface{}, sent []sentClaim,
+	clear bool) (*itemEntity, []Claim, error) {
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	editToken, terr := c.GetEditingToken()
+	if terr != nil {
+		return nil, nil, terr
+	}
+
+	args := map[string]string{
+		"action": "wbeditentity",
+		"token":  editToken,
+		"id":     string(item),
+		"data":   string(b),
+		"bot":    "1",
+	}
+	if clear {
+		args["clear"] = "1"
+	}
+
+	// Retrying an edit that was committed would duplicate any new claims, so look for them before retrying. Edits
+	// that only change existing claims are safe to repeat. An edit that clears the item can't be checked this way,
+	// so isn't retried.
+	var check retryCheck
+	if !clear {
+		check = func() ([]byte, error) {
+			for _, claim := range sent {
+				if len(claim.ID) == 0 {
+					return c.findEditedClaims(item, sent)
+				}
+			}
+			return nil, nil
+		}
+	}
+	response, err := c.editPostWithRetryCheck(args, check)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Close()
+
+	var res itemEditResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if res.Error != nil {
+		return nil, nil, res.Error
+	}
+
+	if res.Success != 1 {
+		return nil, nil, fmt.Errorf("We got an unexpected success value: %v", res)
+	}
+
+	if res.Entity == nil {
+		return nil, nil, fmt.Errorf("Unexpected response from server: %v", res)
+	}
+
+	// The response has all the claims on the item. New claims are added after any existing ones for the property,
+	// in the order we sent them, so count back from the end of the list to find them.
+	new_counts := make(map[string]int)
+	for _, claim := range sent {
+		if len(claim.ID) == 0 {
+			new_counts[claim.Property] += 1
+		}
+	}
+	new_offsets := make(map[string]int)
+
+	result := make([]Claim, len(sent))
+	for index, claim := range sent {
+		existing := res.Entity.Claims[claim.Property]
+		if len(claim.ID) > 0 {
+			found := false
+			for _, e := range existing {
+				if e.ID == claim.ID {
+					result[index] = e
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, nil, fmt.Errorf("Claim %s was not in response from server", claim.ID)
+			}
+			continue
+		}
+
+		position := len(existing) - new_counts[claim.Property] + new_offsets[claim.Property]
+		if position < 0 || position >= len(existing) {
+			return nil, nil, fmt.Errorf("Claim for %s was not in response from server", claim.Property)
+		}
+		result[index] = existing[position]
+		new_offsets[claim.Property] += 1
+	}
+
+	return res.Entity, result, nil
+}
+
+// findEditedClaims is the check before retrying a wbeditentity edit of the sent claims. If the item has a claim with
+// the same value for each new claim then it returns a response equivalent to the one the server would have sent
+// for the edit, with those claims last for their property as the server adds them. Otherwise it returns nil. As for
+// CreateClaimOnItem, this can't tell a claim that existed already from one made by the earlier attempt.
+func (c *Client) findEditedClaims(item ItemPropertyType, sent []sentClaim) ([]byte, error) {
+
+	entity, err := c.getEntity(item, "info|claims")
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string][]Claim)
+	used := make(map[string]bool)
+	for _, claim := range sent {
+		if len(claim.ID) > 0 {
+			continue
+		}
+		existing := entity.Claims[claim.Property]
+		match := -1
+		for index := len(existing) - 1; index >= 0; index-- {
+			e := existing[index]
+			if used[e.ID] || e.MainSnak.SnakType != claim.SnakType {
+				continue
+			}
+			if claim.SnakType != "value" || snakHasEncodedValue(e.MainSnak, claim.Value) {
+				match = index
+				break
+			}
+		}
+		if match < 0 {
+			return nil, nil
+		}
+		used[existing[match].ID] = true
+		found[claim.Property] = append(found[claim.Property], existing[match])
+	}
+
+	for property, claims := range found {
+		others := make([]Claim, 0, len(entity.Claims[property]))
+		for _, e := range entity.Claims[property] {
+			if !used[e.ID] {
+				others = append(others, e)
+			}
+		}
+		entity.Claims[property] = append(others, claims...)
+	}
+
+	return json.Marshal(itemEditResponse{Entity: entity, Success: 1})
+}
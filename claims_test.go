@@ -0,0 +1,780 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetClaimsWithQualifiersAndReferences(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{
+    "claims": {
+        "P14": [
+            {
+                "mainsnak": {
+                    "snaktype": "value",
+                    "property": "P14",
+                    "hash": "db735571fef70e4d199d40fe10609312fa8e5fa9",
+                    "datavalue": {"value": "wot!", "type": "string"},
+                    "datatype": "string"
+                },
+                "type": "statement",
+                "qualifiers": {
+                    "P580": [
+                        {
+                            "snaktype": "value",
+                            "property": "P580",
+                            "hash": "0ac6a8bd2ab6cd4c2b4e3e4a0c4f1e0d7b4e5e1d",
+                            "datavalue": {
+                                "value": {
+                                    "time": "+2001-00-00T00:00:00Z",
+                                    "timezone": 0,
+                                    "before": 0,
+                                    "after": 0,
+                                    "precision": 9,
+                                    "calendarmodel": "http://www.wikidata.org/entity/Q1985727"
+                                },
+                                "type": "time"
+                            },
+                            "datatype": "time"
+                        }
+                    ]
+                },
+                "qualifiers-order": ["P580"],
+                "id": "Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63",
+                "rank": "normal",
+                "references": [
+                    {
+                        "hash": "fa278ebfc458360e5aed63d5058cca83c46134f1",
+                        "snaks": {
+                            "P143": [
+                                {
+                                    "snaktype": "value",
+                                    "property": "P143",
+                                    "datavalue": {
+                                        "value": {"entity-type": "item", "numeric-id": 328},
+                                        "type": "wikibase-entityid"
+                                    },
+                                    "datatype": "wikibase-item"
+                                }
+                            ]
+                        },
+                        "snaks-order": ["P143"]
+                    }
+                ]
+            }
+        ],
+        "P15": [
+            {
+                "mainsnak": {"snaktype": "novalue", "property": "P15", "datatype": "string"},
+                "type": "statement",
+                "id": "Q11$2BE01A5E-EAC8-4568-B866-8E07E93EAB63",
+                "rank": "preferred"
+            }
+        ]
+    }
+}
+`)
+	wikibase := NewClient(client)
+
+	claims, err := wikibase.GetClaims("Q11")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(claims) != 2 || len(claims["P14"]) != 1 || len(claims["P15"]) != 1 {
+		t.Fatalf("We got unexpected claims: %v", claims)
+	}
+
+	claim := claims["P14"][0]
+	if claim.ID != "Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63" {
+		t.Errorf("We got the wrong claim ID: %v", claim)
+	}
+	if claim.MainSnak.DataValue == nil || string(claim.MainSnak.DataValue.Value) != `"wot!"` {
+		t.Errorf("We got the wrong main snak value: %v", claim.MainSnak)
+	}
+
+	qualifiers := claim.QualifiersForProperty("P580")
+	if len(qualifiers) != 1 {
+		t.Fatalf("We got the wrong qualifiers: %v", claim.Qualifiers)
+	}
+	if qualifiers[0].DataValue == nil || qualifiers[0].DataValue.Type != "time" {
+		t.Errorf("We got the wrong qualifier value: %v", qualifiers[0])
+	}
+	if len(claim.QualifierProperties()) != 1 || claim.QualifierProperties()[0] != "P580" {
+		t.Errorf("We got the wrong qualifier order: %v", claim.QualifierProperties())
+	}
+
+	if len(claim.References) != 1 {
+		t.Fatalf("We got the wrong references: %v", claim.References)
+	}
+	snaks := claim.References[0].SnaksForProperty("P143")
+	if len(snaks) != 1 || snaks[0].DataValue == nil || snaks[0].DataValue.Type != "wikibase-entityid" {
+		t.Errorf("We got the wrong reference snaks: %v", claim.References[0])
+	}
+
+	novalue := claims["P15"][0]
+	if novalue.MainSnak.SnakType != "novalue" || novalue.MainSnak.DataValue != nil {
+		t.Errorf("We got the wrong novalue snak: %v", novalue.MainSnak)
+	}
+	if novalue.Rank != "preferred" {
+		t.Errorf("We got the wrong rank: %v", novalue)
+	}
+
+	// Check that the request was also sane
+	if client.LastArgs()["action"] != "wbgetclaims" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["entity"] != "Q11" {
+		t.Errorf("Unexpected entity requested: %v", client.LastArgs())
+	}
+}
+
+const testSetClaimResponse = `
+{"pageinfo":{"lastrevid":461},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P14","datatype":"quantity"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"preferred"}}
+`
+
+// sentEditClaims decodes the claims sent in a wbeditentity request.
+func sentEditClaims(t *testing.T, args map[string]string) []Claim {
+	if args["action"] != "wbeditentity" {
+		t.Fatalf("Unexpected action requested: %v", args)
+	}
+	var data struct {
+		Claims []Claim `json:"claims"`
+	}
+	err := json.Unmarshal([]byte(args["data"]), &data)
+	if err != nil {
+		t.Fatalf("Failed to decode claims sent: %v", err)
+	}
+	return data.Claims
+}
+
+func TestSetPreferredClaimDemotesOthers(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":"+100","unit":"1"},"type":"quantity"},"datatype":"quantity"},"type":"statement","id":"Q11$OLD-PREFERRED","rank":"preferred"},
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":"+90","unit":"1"},"type":"quantity"},"datatype":"quantity"},"type":"statement","id":"Q11$OLD-NORMAL","rank":"normal"}
+]}}
+`)
+	client.AddResponse(`
+{"entity":{"id":"Q11","type":"item","lastrevid":462,"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":"+100","unit":"1"},"type":"quantity"},"datatype":"quantity"},"type":"statement","id":"Q11$OLD-PREFERRED","rank":"normal"},
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":"+90","unit":"1"},"type":"quantity"},"datatype":"quantity"},"type":"statement","id":"Q11$OLD-NORMAL","rank":"normal"},
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":"+110","unit":"1"},"type":"quantity"},"datatype":"quantity"},"type":"statement","id":"Q11$NEW","rank":"preferred"}
+]}},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["population"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetPreferredClaim("Q11", "population", 110)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 2 {
+		t.Fatalf("Got unexpected invocation count: %v", client)
+	}
+
+	// The new claim and the demotion of the old preferred claim are sent in one edit
+	if client.LastArgs()["id"] != "Q11" {
+		t.Errorf("Unexpected item edited: %v", client.LastArgs())
+	}
+	sent := sentEditClaims(t, client.LastArgs())
+	if len(sent) != 2 {
+		t.Fatalf("Expected two claims to be sent: %v", sent)
+	}
+	created := sent[0]
+	if len(created.ID) != 0 || created.Rank != RankPreferred || created.MainSnak.DataValue == nil ||
+		!strings.Contains(string(created.MainSnak.DataValue.Value), "+110") {
+		t.Errorf("Expected new preferred claim: %v", created)
+	}
+	demoted := sent[1]
+	if demoted.ID != "Q11$OLD-PREFERRED" || demoted.Rank != RankNormal {
+		t.Errorf("Expected old preferred claim to be demoted: %v", demoted)
+	}
+	if demoted.MainSnak.DataValue == nil || !strings.Contains(string(demoted.MainSnak.DataValue.Value), "+100") {
+		t.Errorf("Expected demoted claim to keep its value: %v", demoted.MainSnak)
+	}
+}
+
+func TestSetPreferredClaimCreatesNewClaim(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"claims":{}}`)
+	client.AddResponse(`
+{"entity":{"id":"Q11","type":"item","lastrevid":462,"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":"+110","unit":"1"},"type":"quantity"},"datatype":"quantity"},"type":"statement","id":"Q11$NEW","rank":"preferred"}
+]}},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["population"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetPreferredClaim("Q11", "population", 110)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+
+	sent := sentEditClaims(t, client.LastArgs())
+	if len(sent) != 1 {
+		t.Fatalf("Expected one claim to be sent: %v", sent)
+	}
+	created := sent[0]
+	if len(created.ID) != 0 {
+		t.Errorf("Expected new claim to have no ID: %v", created.ID)
+	}
+	if created.Rank != RankPreferred || created.MainSnak.Property != "P14" || created.MainSnak.SnakType != "value" {
+		t.Errorf("Unexpected claim created: %v", created)
+	}
+	if created.MainSnak.DataValue == nil || created.MainSnak.DataValue.Type != "quantity" {
+		t.Errorf("Unexpected claim value created: %v", created.MainSnak)
+	}
+}
+
+func TestSetPreferredClaimPromotesExistingValue(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"wot!","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$EXISTING","rank":"normal"}
+]}}
+`)
+	client.AddResponse(`
+{"entity":{"id":"Q11","type":"item","lastrevid":462,"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"wot!","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$EXISTING","rank":"preferred"}
+]}},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["name"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetPreferredClaim("Q11", "name", "wot!")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 2 {
+		t.Fatalf("Got unexpected invocation count: %v", client)
+	}
+
+	sent := sentEditClaims(t, client.LastArgs())
+	if len(sent) != 1 || sent[0].ID != "Q11$EXISTING" || sent[0].Rank != RankPreferred {
+		t.Errorf("Expected existing claim to be promoted: %v", sent)
+	}
+}
+
+func TestSetPreferredClaimAlreadyPreferred(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"wot!","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$EXISTING","rank":"preferred"}
+]}}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["name"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetPreferredClaim("Q11", "name", "wot!")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Expected no edit when nothing changes: %v", client)
+	}
+}
+
+func TestSetPreferredClaimPromotesExistingItemValue(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"entity-type":"item","numeric-id":6,"id":"Q6"},"type":"wikibase-entityid"},"datatype":"wikibase-item"},"type":"statement","id":"Q11$OTHER","rank":"normal"},
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"entity-type":"item","numeric-id":5,"id":"Q5"},"type":"wikibase-entityid"},"datatype":"wikibase-item"},"type":"statement","id":"Q11$EXISTING","rank":"normal"}
+]}}
+`)
+	client.AddResponse(`
+{"entity":{"id":"Q11","type":"item","lastrevid":462,"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"entity-type":"item","numeric-id":6,"id":"Q6"},"type":"wikibase-entityid"},"datatype":"wikibase-item"},"type":"statement","id":"Q11$OTHER","rank":"normal"},
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"entity-type":"item","numeric-id":5,"id":"Q5"},"type":"wikibase-entityid"},"datatype":"wikibase-item"},"type":"statement","id":"Q11$EXISTING","rank":"preferred"}
+]}},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["instance of"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetPreferredClaim("Q11", "instance of", ItemPropertyType("Q5"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 2 {
+		t.Fatalf("Got unexpected invocation count: %v", client)
+	}
+
+	sent := sentEditClaims(t, client.LastArgs())
+	if len(sent) != 1 || sent[0].ID != "Q11$EXISTING" || sent[0].Rank != RankPreferred {
+		t.Errorf("Expected existing item claim to be promoted: %v", sent)
+	}
+}
+
+func TestSameSnakValue(t *testing.T) {
+
+	wikibase := NewClient(&MockNetworkClient{})
+
+	// The server sends time fields in its own order
+	local, err := wikibase.snakForValue("P14", "date", time.Date(2001, 5, 11, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	stored := Snak{SnakType: "value", Property: "P14", DataValue: &DataValue{Type: "time", Value: json.RawMessage(
+		`{"after":0,"before":0,"calendarmodel":"http://www.wikidata.org/entity/Q1985727","precision":11,` +
+			`"time":"+0000000002001-05-11T00:00:00Z","timezone":0}`)}}
+	if !sameSnakValue(stored, local) {
+		t.Errorf("Expected time values to match: %s %s", stored.DataValue.Value, local.DataValue.Value)
+	}
+
+	other, err := wikibase.snakForValue("P14", "date", time.Date(2001, 5, 12, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if sameSnakValue(stored, other) {
+		t.Errorf("Expected different times not to match")
+	}
+
+	novalue := Snak{SnakType: "novalue", Property: "P14"}
+	if !sameSnakValue(novalue, novalue) || sameSnakValue(stored, novalue) || sameSnakValue(novalue, local) {
+		t.Errorf("Unexpected result comparing no value snaks")
+	}
+}
+
+func TestSetRankForClaim(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":"+100","unit":"1"},"type":"quantity"},"datatype":"quantity"},"type":"statement","id":"Q11$ONLY-CLAIM","rank":"normal"}
+]}}
+`)
+	client.AddResponse(testSetClaimResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["population"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetRankForClaim("Q11", "population", RankDeprecated)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 2 {
+		t.Fatalf("Got unexpected invocation count: %v", client)
+	}
+	if client.LastArgs()["action"] != "wbsetclaim" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+	var claim Claim
+	err = json.Unmarshal([]byte(client.LastArgs()["claim"]), &claim)
+	if err != nil {
+		t.Fatalf("Failed to decode claim sent: %v", err)
+	}
+	if claim.ID != "Q11$ONLY-CLAIM" || claim.Rank != RankDeprecated {
+		t.Errorf("Expected claim to be deprecated: %v", claim)
+	}
+}
+
+func TestSetRankForClaimInvalidRank(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["population"] = "P14"
+
+	err := wikibase.SetRankForClaim("Q11", "population", "best")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestSetRankForClaimMultipleClaims(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datatype":"quantity"},"type":"statement","id":"Q11$ONE","rank":"normal"},
+    {"mainsnak":{"snaktype":"value","property":"P14","datatype":"quantity"},"type":"statement","id":"Q11$TWO","rank":"normal"}
+]}}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["population"] = "P14"
+
+	err := wikibase.SetRankForClaim("Q11", "population", RankPreferred)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestSetClaims(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"id":"Q11","type":"item","lastrevid":56,"claims":{
+    "P14":[
+        {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":"+100","unit":"1"},"type":"quantity"},"datatype":"quantity"},"type":"statement","id":"Q11$OLD-CLAIM","rank":"normal"},
+        {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":"+200","unit":"1"},"type":"quantity"},"datatype":"quantity"},"type":"statement","id":"Q11$NEW-CLAIM-1","rank":"normal"}
+    ],
+    "P15":[
+        {"mainsnak":{"snaktype":"value","property":"P15","datavalue":{"value":"hello","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$NEW-CLAIM-2","rank":"normal"}
+    ]
+}},"success":1}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	claims := []byte(`[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":"+100","unit":"1"},"type":"quantity"}},"type":"statement","id":"Q11$OLD-CLAIM","rank":"normal"},
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":"+200","unit":"1"},"type":"quantity"}},"type":"statement","rank":"normal"},
+    {"mainsnak":{"snaktype":"value","property":"P15","datavalue":{"value":"hello","type":"string"}},"type":"statement","rank":"normal"}
+]`)
+
+	result, err := wikibase.SetClaimsWithResult("Q11", claims)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 1 {
+		t.Fatalf("Got unexpected invocation count: %v", client)
+	}
+	args := client.LastArgs()
+	if args["action"] != "wbeditentity" || args["id"] != "Q11" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+	var data struct {
+		Claims []Claim `json:"claims"`
+	}
+	err = json.Unmarshal([]byte(args["data"]), &data)
+	if err != nil {
+		t.Fatalf("Failed to decode data sent: %v", err)
+	}
+	if len(data.Claims) != 3 {
+		t.Errorf("Expected all claims in one request: %v", data)
+	}
+
+	if len(result) != 3 {
+		t.Fatalf("Got wrong number of claims back: %v", result)
+	}
+	ids := []string{result[0].ID, result[1].ID, result[2].ID}
+	if !reflect.DeepEqual(ids, []string{"Q11$OLD-CLAIM", "Q11$NEW-CLAIM-1", "Q11$NEW-CLAIM-2"}) {
+		t.Errorf("Got wrong claim IDs: %v", ids)
+	}
+}
+
+func TestSetClaimsError(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"error":{"code":"modification-failed","info":"Bad value"}}`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetClaims("Q11", []byte(`[{"mainsnak":{"snaktype":"novalue","property":"P14"},"type":"statement"}]`))
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestSetClaimsInvalidJSON(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+
+	err := wikibase.SetClaims("Q11", []byte(`{"not": "an array"}`))
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestQuantityValueKeepsPrecision(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":"+9007199254740993","unit":"1","upperBound":"+9007199254740995","lowerBound":"+9007199254740991"},"type":"quantity"},"datatype":"quantity"},"type":"statement","id":"Q11$BIG-CLAIM","rank":"normal"},
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":{"amount":9007199254740993,"unit":"1"},"type":"quantity"},"datatype":"quantity"},"type":"statement","id":"Q11$NUMBER-CLAIM","rank":"normal"}
+]}}
+`)
+	client.AddResponse(testSetClaimResponse)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	claims, err := wikibase.GetClaims("Q11")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(claims["P14"]) != 2 {
+		t.Fatalf("We got the wrong claims: %v", claims)
+	}
+
+	for _, claim := range claims["P14"] {
+		quantity, err := claim.MainSnak.DataValue.Quantity()
+		if err != nil {
+			t.Fatalf("We got an unexpected error: %v", err)
+		}
+		amount, err := quantity.Amount.Int64()
+		if err != nil {
+			t.Fatalf("We got an unexpected error: %v", err)
+		}
+		if amount != 9007199254740993 {
+			t.Errorf("Quantity lost precision: %v", amount)
+		}
+	}
+
+	quantity, _ := claims["P14"][0].MainSnak.DataValue.Quantity()
+	if quantity.UpperBound == nil || quantity.UpperBound.String() != "9007199254740995" || quantity.LowerBound == nil {
+		t.Errorf("We got the wrong bounds: %v", quantity)
+	}
+
+	// Writing the claim back should send the value as it was read
+	claim := claims["P14"][0]
+	claim.Rank = RankPreferred
+	err = wikibase.setClaim(claim)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(client.LastArgs()["claim"], `"amount":"+9007199254740993"`) {
+		t.Errorf("Quantity was changed on write: %v", client.LastArgs()["claim"])
+	}
+}
+
+func TestQuantityValueWrongType(t *testing.T) {
+	value := DataValue{Type: "string", Value: json.RawMessage(`"hello"`)}
+	if _, err := value.Quantity(); err == nil {
+		t.Errorf("We expected an error")
+	}
+	value = DataValue{Type: "quantity", Value: json.RawMessage(`{"amount":"lots","unit":"1"}`)}
+	if _, err := value.Quantity(); err == nil {
+		t.Errorf("We expected an error")
+	}
+}
+
+func TestGetBestClaimsPrefersPreferredRank(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{
+    "claims": {
+        "P14": [
+            {"mainsnak": {"snaktype": "value", "property": "P14", "datavalue": {"value": "old", "type": "string"}},
+             "type": "statement", "id": "Q11$1", "rank": "normal"},
+            {"mainsnak": {"snaktype": "value", "property": "P14", "datavalue": {"value": "current", "type": "string"}},
+             "type": "statement", "id": "Q11$2", "rank": "preferred"},
+            {"mainsnak": {"snaktype": "value", "property": "P14", "datavalue": {"value": "wrong", "type": "string"}},
+             "type": "statement", "id": "Q11$3", "rank": "deprecated"}
+        ],
+        "P15": [
+            {"mainsnak": {"snaktype": "value", "property": "P15", "datavalue": {"value": "a", "type": "string"}},
+             "type": "statement", "id": "Q11$4", "rank": "normal"},
+            {"mainsnak": {"snaktype": "value", "property": "P15", "datavalue": {"value": "b", "type": "string"}},
+             "type": "statement", "id": "Q11$5", "rank": "normal"}
+        ],
+        "P16": [
+            {"mainsnak": {"snaktype": "value", "property": "P16", "datavalue": {"value": "c", "type": "string"}},
+             "type": "statement", "id": "Q11$6", "rank": "deprecated"}
+        ]
+    }
+}
+`)
+	wikibase := NewClient(client)
+
+	claims, err := wikibase.GetBestClaims("Q11")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+
+	if len(claims["P14"]) != 1 || claims["P14"][0].ID != "Q11$2" {
+		t.Errorf("Expected the preferred claim to win: %v", claims["P14"])
+	}
+	if len(claims["P15"]) != 2 || claims["P15"][0].ID != "Q11$4" || claims["P15"][1].ID != "Q11$5" {
+		t.Errorf("Expected all normal claims in order: %v", claims["P15"])
+	}
+	if _, ok := claims["P16"]; ok {
+		t.Errorf("Did not expect property with only deprecated claims: %v", claims["P16"])
+	}
+	if client.LastArgs()["action"] != "wbgetclaims" || client.LastArgs()["entity"] != "Q11" {
+		t.Errorf("Unexpected request: %v", client.LastArgs())
+	}
+}
+
+func TestResolveExternalID(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{
+    "claims": {
+        "P1630": [
+            {"mainsnak": {"snaktype": "value", "property": "P1630",
+                          "datavalue": {"value": "https://old.example.org/$1", "type": "string"}},
+             "type": "statement", "id": "P214$1", "rank": "normal"},
+            {"mainsnak": {"snaktype": "value", "property": "P1630",
+                          "datavalue": {"value": "https://viaf.org/viaf/$1/", "type": "string"}},
+             "type": "statement", "id": "P214$2", "rank": "preferred"}
+        ]
+    }
+}
+`)
+	wikibase := NewClient(client)
+
+	link, err := wikibase.ResolveExternalID("P214", "113230702")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if link != "https://viaf.org/viaf/113230702/" {
+		t.Errorf("We got the wrong link: %v", link)
+	}
+	if client.LastArgs()["action"] != "wbgetclaims" || client.LastArgs()["entity"] != "P214" ||
+		client.LastArgs()["property"] != "P1630" {
+		t.Errorf("Unexpected request: %v", client.LastArgs())
+	}
+}
+
+func TestResolveExternalIDWithFormatterProperty(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{
+    "claims": {
+        "P9": [
+            {"mainsnak": {"snaktype": "value", "property": "P9",
+                          "datavalue": {"value": "https://example.org/id?q=$1", "type": "string"}},
+             "type": "statement", "id": "P4$1", "rank": "normal"}
+        ]
+    }
+}
+`)
+	client.AddResponse(`{"claims": {}}`)
+	wikibase := NewClient(client)
+	wikibase.FormatterURLProperty = "P9"
+
+	link, err := wikibase.ResolveExternalID("P4", "a b/c")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if link != "https://example.org/id?q=a%20b/c" {
+		t.Errorf("We got the wrong link: %v", link)
+	}
+	if client.LastArgs()["property"] != "P9" {
+		t.Errorf("Expected the configured formatter property to be used: %v", client.LastArgs())
+	}
+
+	_, err = wikibase.ResolveExternalID("P4", "123")
+	if err == nil {
+		t.Errorf("We expected an error for a property without a formatter URL")
+	}
+
+	_, err = wikibase.ResolveExternalID("Q4", "123")
+	if err == nil {
+		t.Errorf("We expected an error for an item ID")
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestGetClaimsFollowsContinuation(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{
+    "claims": {
+        "P14": [
+            {"mainsnak": {"snaktype": "value", "property": "P14", "datavalue": {"value": "a", "type": "string"}},
+             "type": "statement", "id": "Q11$1", "rank": "normal"}
+        ]
+    },
+    "continue": {"claimcontinue": "Q11$2", "continue": "-||"}
+}
+`)
+	client.AddResponse(`
+{
+    "claims": {
+        "P14": [
+            {"mainsnak": {"snaktype": "value", "property": "P14", "datavalue": {"value": "b", "type": "string"}},
+             "type": "statement", "id": "Q11$2", "rank": "normal"}
+        ],
+        "P15": [
+            {"mainsnak": {"snaktype": "value", "property": "P15", "datavalue": {"value": "c", "type": "string"}},
+             "type": "statement", "id": "Q11$3", "rank": "normal"}
+        ]
+    }
+}
+`)
+	wikibase := NewClient(client)
+
+	claims, err := wikibase.GetClaims("Q11")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(claims["P14"]) != 2 || claims["P14"][0].ID != "Q11$1" || claims["P14"][1].ID != "Q11$2" {
+		t.Errorf("Expected claims from both responses in order: %v", claims["P14"])
+	}
+	if len(claims["P15"]) != 1 || claims["P15"][0].ID != "Q11$3" {
+		t.Errorf("Expected claims for the second property: %v", claims["P15"])
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+	if client.LastArgs()["claimcontinue"] != "Q11$2" || client.LastArgs()["continue"] != "-||" {
+		t.Errorf("Expected the continuation to be sent: %v", client.LastArgs())
+	}
+}
+
+func TestGetClaimsRepeatedContinuation(t *testing.T) {
+
+	response := `{"claims": {}, "continue": {"claimcontinue": "Q11$2"}}`
+	client := &MockNetworkClient{}
+	client.AddResponse(response)
+	client.AddResponse(response)
+	wikibase := NewClient(client)
+
+	_, err := wikibase.GetClaims("Q11")
+	if err == nil {
+		t.Errorf("We expected an error for a repeated continuation")
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
@@ -0,0 +1,100 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"fmt"
+)
+
+// DefaultConstraintPropertyID is the property used for constraint statements on Wikidata.
+const DefaultConstraintPropertyID = "P2302"
+
+// Constraint is a constraint on the values of a property, which Wikibase stores as a statement on the property. Type
+// is the item for the kind of constraint (e.g. Q21502404 for a format constraint on Wikidata), and the parameters of
+// the constraint (e.g. the regular expression for a format constraint) are stored as qualifiers.
+type Constraint struct {
+	ClaimID    string
+	Type       ItemPropertyType
+	Parameters map[string][]Snak
+}
+
+// StringParameters returns the string values of the parameter with the given property ID, such as the regular
+// expression of a format constraint (P1793 on Wikidata).
+func (c *Constraint) StringParameters(property_id string) []string {
+	values := make([]string, 0)
+	for _, snak := range c.Parameters[property_id] {
+		if snak.DataValue == nil {
+			continue
+		}
+		value, err := snak.DataValue.StringValue()
+		if err == nil {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// ItemParameters returns the item values of the parameter with the given property ID, such as the allowed values
+// of a one-of constraint (P2305 on Wikidata).
+func (c *Constraint) ItemParameters(property_id string) []ItemPropertyType {
+	values := make([]ItemPropertyType, 0)
+	for _, snak := range c.Parameters[property_id] {
+		if snak.DataValue == nil {
+			continue
+		}
+		value, err := snak.DataValue.EntityID()
+		if err == nil {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// GetPropertyConstraints fetches the constraints on the property with the given ID. The property used for
+// constraint statements is set by Client.ConstraintPropertyID, and defaults to DefaultConstraintPropertyID.
+func (c *Client) GetPropertyConstraints(property_id string) ([]Constraint, error) {
+
+	constraint_property := c.ConstraintPropertyID
+	if len(constraint_property) == 0 {
+		constraint_property = DefaultConstraintPropertyID
+	}
+
+	claims, err := c.getClaimsForProperty(ItemPropertyType(property_id), constraint_property)
+	if err != nil {
+		return nil, err
+	}
+
+	constraints := make([]Constraint, 0, len(claims))
+	for _, claim := range claims {
+		if claim.MainSnak.DataValue == nil {
+			continue
+		}
+		constraint_type, err := claim.MainSnak.DataValue.EntityID()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode constraint %s on %s: %v", claim.ID, property_id, err)
+		}
+		parameters := claim.Qualifiers
+		if parameters == nil {
+			parameters = make(map[string][]Snak, 0)
+		}
+		constraints = append(constraints, Constraint{
+			ClaimID:    claim.ID,
+			Type:       constraint_type,
+			Parameters: parameters,
+		})
+	}
+
+	return constraints, nil
+}
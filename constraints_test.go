@@ -0,0 +1,89 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"testing"
+)
+
+const testConstraintClaimsResponse = `
+{"claims":{"P2302":[
+    {"mainsnak":{"snaktype":"value","property":"P2302","datavalue":{"value":{"entity-type":"item","numeric-id":21502404,"id":"Q21502404"},"type":"wikibase-entityid"},"datatype":"wikibase-item"},
+     "type":"statement","id":"P214$FORMAT","rank":"normal",
+     "qualifiers":{"P1793":[{"snaktype":"value","property":"P1793","hash":"abc","datavalue":{"value":"[1-9]\\d{5,21}","type":"string"},"datatype":"string"}]},
+     "qualifiers-order":["P1793"]},
+    {"mainsnak":{"snaktype":"value","property":"P2302","datavalue":{"value":{"entity-type":"item","numeric-id":21510859},"type":"wikibase-entityid"},"datatype":"wikibase-item"},
+     "type":"statement","id":"P214$ONEOF","rank":"normal",
+     "qualifiers":{"P2305":[
+         {"snaktype":"value","property":"P2305","hash":"def","datavalue":{"value":{"entity-type":"item","numeric-id":5,"id":"Q5"},"type":"wikibase-entityid"},"datatype":"wikibase-item"},
+         {"snaktype":"value","property":"P2305","hash":"ghi","datavalue":{"value":{"entity-type":"item","numeric-id":43229,"id":"Q43229"},"type":"wikibase-entityid"},"datatype":"wikibase-item"}
+     ]}}
+]}}
+`
+
+func TestGetPropertyConstraints(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testConstraintClaimsResponse)
+	wikibase := NewClient(client)
+
+	constraints, err := wikibase.GetPropertyConstraints("P214")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.LastArgs()["entity"] != "P214" || client.LastArgs()["property"] != "P2302" {
+		t.Errorf("Unexpected request: %v", client.LastArgs())
+	}
+	if len(constraints) != 2 {
+		t.Fatalf("We got the wrong number of constraints: %v", constraints)
+	}
+
+	format := constraints[0]
+	if format.ClaimID != "P214$FORMAT" || format.Type != "Q21502404" {
+		t.Errorf("Format constraint was wrong: %v", format)
+	}
+	regexes := format.StringParameters("P1793")
+	if len(regexes) != 1 || regexes[0] != `[1-9]\d{5,21}` {
+		t.Errorf("Format constraint regex was wrong: %v", regexes)
+	}
+
+	one_of := constraints[1]
+	if one_of.Type != "Q21510859" {
+		t.Errorf("One-of constraint type was wrong: %v", one_of)
+	}
+	items := one_of.ItemParameters("P2305")
+	if len(items) != 2 || items[0] != "Q5" || items[1] != "Q43229" {
+		t.Errorf("One-of constraint values were wrong: %v", items)
+	}
+}
+
+func TestGetPropertyConstraintsCustomProperty(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"claims":{}}`)
+	wikibase := NewClient(client)
+	wikibase.ConstraintPropertyID = "P15"
+
+	constraints, err := wikibase.GetPropertyConstraints("P3")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(constraints) != 0 {
+		t.Errorf("Expected no constraints: %v", constraints)
+	}
+	if client.LastArgs()["property"] != "P15" {
+		t.Errorf("Unexpected request: %v", client.LastArgs())
+	}
+}
@@ -0,0 +1,40 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase_test
+
+import (
+	"fmt"
+
+	"github.com/ContentMine/wikibase"
+)
+
+func ExampleMockNetworkClient() {
+
+	mock := &wikibase.MockNetworkClient{}
+	mock.AddResponse(`{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Item:Q4","pageid":11,"displaytext":"blah"}]}}`)
+
+	client := wikibase.NewClient(mock)
+	ids, err := client.FetchItemIDsForLabel("blah")
+	if err != nil {
+		fmt.Printf("Failed to fetch IDs: %v\n", err)
+		return
+	}
+
+	fmt.Println(ids)
+	fmt.Println(mock.LastArgs()["wbssearch"])
+	// Output:
+	// [Q4]
+	// blah
+}
@@ -15,13 +15,20 @@
 package wikibase
 
 import (
+	"context"
 	"encoding"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
+// MaxLabelLength is the maximum length in characters of a label allowed by Wikibase by default.
+const MaxLabelLength = 250
+
 // ItemHeader must be embedded in all structs that are to be uploaded to Wikibase. If you give this embedded struct
 // a JSON Tag then you can save and restore the Wikibase ID state for the entire struct, which can be used to avoid
 // creating the item multiple times when you run.
@@ -33,9 +40,41 @@ import (
 // MapPropertyAndItemConfiguration to populate it's internal map before attempting to create/update Items and their
 // properties. If you add an "omitoncreate" clause then the Property will not be added to the item at create time,
 // only later on during property sync.
+//
+// Claims already uploaded are normally updated in place when refreshed. For properties that should accumulate values,
+// such as citations of different sources, an "append" clause makes a refresh add a new claim instead, leaving the
+// earlier claims on the item.
+//
+// If MapPropertyAndItemConfiguration creates a missing property, a "desc=" clause in the tag, such as
+// `property:"mass,desc=measured mass in grams"`, sets the description of the new property. The description can not
+// contain commas.
+//
+// Similarly a "label=" clause, such as `property:"mass,label=measured mass (g)"`, sets the label the property is
+// created with, so the Go side key can stay short. The tag key is still used as the key in the property map, and
+// the property is looked up by the override label first so that it is found again once created.
+//
+// Alternative names for an item can be stored in a []string field with an "alias" tag, the value of which is the
+// language of the aliases, or empty to use the client's language. These are set when the item is created, and can be
+// read back with RefreshAliases.
+//
+// A property tag can list fallback labels separated by "|", such as "birth date|date of birth", for properties that
+// are labelled differently on different servers. MapPropertyAndItemConfiguration will use the first one it finds.
+//
+// Time fields are uploaded with day precision by default. Adding "precision=year", "precision=month", or
+// "precision=day" to the tag sets the precision explicitly, and adding "inferprecision" will pick year or month
+// precision if the time is midnight UTC on the first of the year or month respectively.
+//
+// Nil pointers and empty strings are always uploaded as "no value" claims. Adding a "novalue" clause to the tag does
+// the same for the zero value of any other type, such as `property:"number of children,novalue"` on an int field,
+// to state positively that the property has no value rather than uploading a value of zero. Such claims are created
+// like any other, so are not the same as leaving the field out of the struct.
+//
+// LastRevID records the revision ID of the item the last time it was created or read back with RefreshLastRevID,
+// which can be passed as the baserevid on later edits to detect conflicting changes made in the meantime.
 type ItemHeader struct {
 	ID          ItemPropertyType  `json:"wikibase_id,omitempty"`
 	PropertyIDs map[string]string `json:"wikibase_property_ids,omitempty"`
+	LastRevID   int               `json:"wikibase_last_rev_id,omitempty"`
 }
 
 type dataValue struct {
@@ -50,17 +89,52 @@ type snakCreateInfo struct {
 }
 
 type claimCreate struct {
+	ID       string         `json:"id,omitempty"`
 	MainSnak snakCreateInfo `json:"mainsnak"`
 	Rank     string         `json:"rank"`
 	Type     string         `json:"type"`
+
+	// The key the claim ID is stored under in the item header's PropertyIDs
+	key string
+}
+
+// sentClaims identifies the claims for matching them up with those in the response to a wbeditentity request.
+func sentClaims(claims []claimCreate) ([]sentClaim, error) {
+	sent := make([]sentClaim, len(claims))
+	for index, claim := range claims {
+		sent[index] = sentClaim{ID: claim.ID, Property: claim.MainSnak.Property, SnakType: claim.MainSnak.SnakType}
+		if claim.MainSnak.DataValue != nil {
+			value, err := json.Marshal(claim.MainSnak.DataValue.Value)
+			if err != nil {
+				return nil, err
+			}
+			sent[index].Value = value
+		}
+	}
+	return sent, nil
+}
+
+// propertyClaimKey returns the key in the item header's PropertyIDs for the claim ID of the index'th field in a struct
+// for the property. The first is keyed by just the property ID, so for the usual case of one field per property the
+// map is of property ID to claim ID, and any others are keyed by the property ID and index, such as "P14#1".
+func propertyClaimKey(property_id string, index int) string {
+	if index == 0 {
+		return property_id
+	}
+	return fmt.Sprintf("%s#%d", property_id, index)
 }
 
 type itemCreateData struct {
-	Labels map[string]itemLabel `json:"labels"`
-	Claims []claimCreate        `json:"claims"`
+	Labels  map[string]itemLabel   `json:"labels,omitempty"`
+	Aliases map[string][]itemLabel `json:"aliases,omitempty"`
+	Claims  []claimCreate          `json:"claims"`
 }
 
-func getItemCreateClaimValue(f reflect.StructField, value reflect.Value) (*dataValue, error) {
+func (c *Client) getItemCreateClaimValue(f reflect.StructField, value reflect.Value) (*dataValue, error) {
+
+	if isNoValueField(f, value) {
+		return nil, nil
+	}
 
 	full_type_name := fmt.Sprintf("%v", f.Type)
 
@@ -97,11 +171,15 @@ func getItemCreateClaimValue(f reflect.StructField, value reflect.Value) (*dataV
 		if err != nil {
 			return nil, err
 		}
+		t.Precision, err = timePrecisionForField(f, value)
+		if err != nil {
+			return nil, err
+		}
 		data.Value = &t
 		data.Type = datatype
 
 	case "string":
-		t, err := StringClaimToAPIData(value.String())
+		t, err := StringClaimToAPIData(c.normalizeStringValue(propertyLabelForField(f), value.String()))
 		if err != nil {
 			return nil, err
 		}
@@ -119,14 +197,77 @@ func getItemCreateClaimValue(f reflect.StructField, value reflect.Value) (*dataV
 		data.Value = &t
 		data.Type = datatype
 
+	case "float64", "float32":
+		t, err := quantityFloatClaimToAPIData(value.Float(), value.Type().Bits())
+		if err != nil {
+			return nil, err
+		}
+		data.Value = &t
+		data.Type = datatype
+
 	case "wikibase.ItemPropertyType":
-		t, err := ItemClaimToAPIData(ItemPropertyType(value.String()))
+		t, err := c.entityClaimToAPIData(ItemPropertyType(value.String()))
+		if err != nil {
+			return nil, err
+		}
+		data.Value = &t
+		data.Type = "wikibase-entityid"
+
+	case "bool":
+		item, err := c.booleanItem(value.Bool())
+		if err != nil {
+			return nil, err
+		}
+		t, err := c.entityClaimToAPIData(item)
 		if err != nil {
 			return nil, err
 		}
 		data.Value = &t
 		data.Type = "wikibase-entityid"
 
+	case "url.URL":
+		t, err := URLClaimToAPIData(value.Interface().(url.URL))
+		if err != nil {
+			return nil, err
+		}
+		data.Value = &t
+		data.Type = "string"
+
+	case "wikibase.GlobeCoordinate":
+		t, err := c.globeCoordinateClaimToAPIData(value.Interface().(GlobeCoordinate))
+		if err != nil {
+			return nil, err
+		}
+		data.Value = &t
+		data.Type = "globecoordinate"
+
+	case "wikibase.HistoricalTime":
+		t, err := c.historicalTimeClaimToAPIData(value.Interface().(HistoricalTime))
+		if err != nil {
+			return nil, err
+		}
+		data.Value = &t
+		data.Type = datatype
+
+	case "wikibase.Quantity":
+		t, err := c.quantityWithPrecisionClaimToAPIData(value.Interface().(Quantity))
+		if err != nil {
+			return nil, err
+		}
+		data.Value = &t
+		data.Type = datatype
+
+	case "wikibase.MonolingualText":
+		t, err := c.monolingualTextClaimToAPIData(f, value.Interface().(MonolingualText))
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return nil, nil
+		}
+		data.Value = t
+		data.Type = datatype
+
 	default:
 		return nil, fmt.Errorf("Tried to upload property of unrecognised type %s", full_type_name)
 	}
@@ -134,36 +275,320 @@ func getItemCreateClaimValue(f reflect.StructField, value reflect.Value) (*dataV
 	return &data, nil
 }
 
-// CreateItemInstance will take a pointer to a Go structure that has the embedded wikibase header and
-// item and property tags on its fields and create a new item with the provided label. Any fields in the structure
-// with a Property tag that does not contain the "omitoncreate" clause will also be created as item claims at the
-// same time.
-func (c *Client) CreateItemInstance(label string, i interface{}) error {
+// getEntity fetches the requested parts of a single entity, where props is a pipe separated list of the parts of the
+// entity wanted, as per the wbgetentities API call.
+func (c *Client) getEntity(id ItemPropertyType, props string) (*itemEntity, error) {
 
-	if len(label) == 0 {
-		return fmt.Errorf("Item label must not be an empty string.")
+	if len(id) == 0 {
+		return nil, fmt.Errorf("Entity ID must not be an empty string.")
 	}
 
-	// Can we find the headers used to record bits?
-	v := reflect.ValueOf(i)
-	if v.Kind() != reflect.Ptr {
-		return fmt.Errorf("Expected a pointer to the item to upload, not %v", v.Kind())
+	response, err := c.get(
+		map[string]string{
+			"action": "wbgetentities",
+			"ids":    string(id),
+			"props":  props,
+		},
+	)
+
+	if err != nil {
+		return nil, err
 	}
-	s := v.Elem()
-	if s.Kind() != reflect.Struct {
-		return fmt.Errorf("Expected a struct for item to upload, got %v.", s.Kind())
+	defer response.Close()
+
+	var res getEntitiesResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	// If the ID is a redirect, such as after an item was merged, the server may return the target entity under
+	// either the requested ID or the target ID, so look for the redirect marker
+	entity, ok := res.Entities[string(id)]
+	if !ok {
+		for _, e := range res.Entities {
+			if e.Redirects != nil && e.Redirects.From == id {
+				entity = e
+				ok = true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("Entity %s was not in response from server: %v", id, res)
 	}
-	header := s.FieldByName("ItemHeader")
-	if !header.IsValid() {
-		return fmt.Errorf("Expected struct to have item header")
+	if entity.Missing != nil {
+		return nil, fmt.Errorf("Entity %s does not exist", id)
 	}
 
-	// Are there any properties that we should create at this venture as part of initial
-	// upload?
+	return &entity, nil
+}
+
+// Entity is the data for an item or property as returned by GetEntity. Labels and descriptions are maps of language
+// to text, and sitelinks are maps of site to page title.
+type Entity struct {
+	ID           ItemPropertyType
+	Type         string
+	LastRevID    int
+	Labels       map[string]string
+	Descriptions map[string]string
+	Claims       map[string][]Claim
+	Sitelinks    map[string]string
+
+	// If the requested ID is a redirect to another entity, for example because the item was merged into another,
+	// this is the ID that was requested, and ID is the ID of the target entity whose data is returned.
+	RedirectedFrom ItemPropertyType
+}
+
+// GetEntity fetches the labels, descriptions, claims, and sitelinks of an entity. Redirects are followed, so if
+// the ID has been merged into another entity then the data for the target entity is returned, and RedirectedFrom is
+// set to the ID that was requested.
+func (c *Client) GetEntity(id ItemPropertyType) (*Entity, error) {
+
+	res, err := c.getEntity(id, "info|labels|descriptions|claims|sitelinks")
+	if err != nil {
+		return nil, err
+	}
+
+	return entityFromItemEntity(res), nil
+}
+
+// GetEntityAtRevision fetches the entity as it was at the given revision, for reproducible reads of historical
+// state. An error is returned if the revision does not exist or is a revision of a different entity. As the entity
+// is read from the revision content, redirects are not followed, and LastRevID is the requested revision.
+func (c *Client) GetEntityAtRevision(id ItemPropertyType, revision int) (*Entity, error) {
+
+	if len(id) == 0 {
+		return nil, fmt.Errorf("Entity ID must not be an empty string.")
+	}
+	if revision <= 0 {
+		return nil, fmt.Errorf("Revision ID must be positive, not %d", revision)
+	}
+
+	response, err := c.get(
+		map[string]string{
+			"action":  "query",
+			"prop":    "revisions",
+			"revids":  strconv.Itoa(revision),
+			"rvprop":  "ids|content",
+			"rvslots": "main",
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	defer response.Close()
+
+	var res revisionQueryResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	if _, ok := res.Query.BadRevIDs[strconv.Itoa(revision)]; ok {
+		return nil, fmt.Errorf("Revision %d does not exist", revision)
+	}
+
+	for _, page := range res.Query.Pages {
+		for _, rev := range page.Revisions {
+			if rev.RevID != revision {
+				continue
+			}
+			slot, ok := rev.Slots["main"]
+			if !ok {
+				return nil, fmt.Errorf("Revision %d has no content in response from server: %v", revision, res)
+			}
+
+			content, err := decodeStoredEntity(slot.Content)
+			if err != nil {
+				return nil, fmt.Errorf("Revision %d of %s is not an entity: %v", revision, page.Title, err)
+			}
+			if len(content.ID) == 0 {
+				return nil, fmt.Errorf("Revision %d of %s is a redirect, not entity data", revision, page.Title)
+			}
+			if content.ID != id {
+				return nil, fmt.Errorf("Revision %d belongs to %s, not entity %s", revision, page.Title, id)
+			}
+			content.LastRevisionID = revision
+
+			return entityFromItemEntity(content), nil
+		}
+	}
+
+	return nil, fmt.Errorf("Revision %d was not in response from server: %v", revision, res)
+}
+
+// entityPageTitle returns the title of the page for the entity, in the namespace the client has in EntityNamespaces
+// for its type.
+func (c *Client) entityPageTitle(entity *itemEntity) (string, error) {
+	namespaces := c.EntityNamespaces
+	if namespaces == nil {
+		namespaces = DefaultEntityNamespaces
+	}
+	namespace, ok := namespaces[entity.Type]
+	if !ok {
+		return "", fmt.Errorf("No namespace known for %s entity %s", entity.Type, entity.ID)
+	}
+	if len(namespace) == 0 {
+		return string(entity.ID), nil
+	}
+	return namespace + ":" + string(entity.ID), nil
+}
+
+// GetEntityHistory returns the revisions of the entity, newest first, with who made them and their edit summaries.
+// At most limit revisions are returned, or all of them if limit is zero or less, following continuations as needed.
+// If the ID is a redirect then the history of the target entity is returned.
+func (c *Client) GetEntityHistory(id ItemPropertyType, limit int) ([]Revision, error) {
+
+	// The history is of the entity's page, whose title depends on the namespace configuration of the wiki
+	entity, err := c.getEntity(id, "info")
+	if err != nil {
+		return nil, err
+	}
+	title := entity.Title
+	if len(title) == 0 {
+		// Backends such as the REST API don't give the title, so work it out from the client's configuration
+		title, err = c.entityPageTitle(entity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	args := map[string]string{
+		"action":  "query",
+		"prop":    "revisions",
+		"titles":  title,
+		"rvprop":  "ids|timestamp|user|comment",
+		"rvdir":   "older",
+		"rvlimit": "max",
+	}
+
+	revisions := make([]Revision, 0)
+	for {
+		if limit > 0 {
+			args["rvlimit"] = strconv.Itoa(limit - len(revisions))
+		}
+
+		response, err := c.get(args)
+		if err != nil {
+			return nil, err
+		}
+
+		var res historyResponse
+		err = json.NewDecoder(response).Decode(&res)
+		response.Close()
+		if err != nil {
+			return nil, err
+		}
+		if res.Error != nil {
+			return nil, res.Error
+		}
+
+		for _, page := range res.Query.Pages {
+			if page.Missing != nil {
+				return nil, fmt.Errorf("Page %s for entity %s does not exist", title, id)
+			}
+			revisions = append(revisions, page.Revisions...)
+		}
+
+		if limit > 0 && len(revisions) >= limit {
+			revisions = revisions[:limit]
+			break
+		}
+		if res.Continue == nil || len(res.Continue.RVContinue) == 0 {
+			break
+		}
+		if res.Continue.RVContinue == args["rvcontinue"] {
+			return nil, fmt.Errorf("Server returned the same continuation twice: %s", res.Continue.RVContinue)
+		}
+		args["rvcontinue"] = res.Continue.RVContinue
+		args["continue"] = res.Continue.Continue
+	}
+
+	return revisions, nil
+}
+
+// decodeStoredEntity decodes the entity JSON stored as the content of a revision. Unlike API responses, this is
+// serialised by PHP with empty maps as empty lists, so those are dropped before decoding.
+func decodeStoredEntity(content string) (*itemEntity, error) {
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal([]byte(content), &fields)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range fields {
+		if strings.Replace(string(value), " ", "", -1) == "[]" {
+			delete(fields, key)
+		}
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var entity itemEntity
+	err = json.Unmarshal(b, &entity)
+	if err != nil {
+		return nil, err
+	}
+	return &entity, nil
+}
+
+// entityFromItemEntity converts the entity as returned by the API into the exported Entity type.
+func entityFromItemEntity(res *itemEntity) *Entity {
+
+	entity := Entity{
+		ID:           res.ID,
+		Type:         res.Type,
+		LastRevID:    res.LastRevisionID,
+		Labels:       make(map[string]string, len(res.Labels)),
+		Descriptions: make(map[string]string, len(res.Descriptions)),
+		Claims:       res.Claims,
+		Sitelinks:    make(map[string]string, len(res.Sitelinks)),
+	}
+	for language, label := range res.Labels {
+		entity.Labels[language] = label.Value
+	}
+	for language, description := range res.Descriptions {
+		entity.Descriptions[language] = description.Value
+	}
+	for site, link := range res.Sitelinks {
+		entity.Sitelinks[site] = link.Title
+	}
+	if entity.Claims == nil {
+		entity.Claims = make(map[string][]Claim, 0)
+	}
+	if res.Redirects != nil {
+		entity.RedirectedFrom = res.Redirects.From
+	}
+
+	return &entity
+}
+
+// claimsForEntityEdit builds the list of claims to send with wbeditentity for the tagged fields in the struct. If
+// on_create is set then fields with the "omitoncreate" clause are skipped. If a property map is provided, then the
+// claim IDs in it are included so that existing claims are updated rather than new ones added.
+func (c *Client) claimsForEntityEdit(ctx context.Context, s reflect.Value, on_create bool,
+	property_map_field reflect.Value) ([]claimCreate, error) {
+
 	claims := make([]claimCreate, 0)
+	counts := make(map[string]int)
 
 	t := s.Type()
 	for i := 0; i < t.NumField(); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		f := t.Field(i)
 		value := s.Field(i)
 
@@ -177,7 +602,7 @@ func (c *Client) CreateItemInstance(label string, i interface{}) error {
 			skiptag := false
 			for _, t := range parts[1:] {
 				if t == "omitoncreate" {
-					skiptag = true
+					skiptag = on_create
 					break
 				}
 			}
@@ -187,12 +612,14 @@ func (c *Client) CreateItemInstance(label string, i interface{}) error {
 
 			property_id, ok := c.PropertyMap[tag]
 			if ok == false {
-				return fmt.Errorf("No property map for property label %s", tag)
+				return nil, fmt.Errorf("No property map for property label %s", tag)
 			}
+			key := propertyClaimKey(property_id, counts[property_id])
+			counts[property_id] += 1
 
-			claim, err := getItemCreateClaimValue(f, value)
+			claim, err := c.getItemCreateClaimValue(f, value)
 			if err != nil {
-				return fmt.Errorf("Failed to marshal %s during create: %v", property_id, err)
+				return nil, fmt.Errorf("Failed to marshal %s during create: %v", property_id, err)
 			}
 
 			snaktype := "value"
@@ -207,58 +634,220 @@ func (c *Client) CreateItemInstance(label string, i interface{}) error {
 				},
 				Rank: "normal",
 				Type: "statement",
+				key:  key,
+			}
+
+			if property_map_field.IsValid() && !property_map_field.IsNil() && !hasPropertyTagOption(f, "append") {
+				id_val := property_map_field.MapIndex(reflect.ValueOf(key))
+				if id_val.IsValid() && id_val.Kind() == reflect.String {
+					create.ID = id_val.String()
+				}
 			}
 
 			claims = append(claims, create)
 		}
 	}
 
-	labels := make(map[string]itemLabel, 0)
-	labels["en"] = itemLabel{Language: "en", Value: label}
-	item := itemCreateData{Labels: labels, Claims: claims}
-
-	b, berr := json.Marshal(&item)
-	if berr != nil {
-		return berr
-	}
+	return claims, nil
+}
 
-	// Having got things
-	editToken, terr := c.GetEditingToken()
-	if terr != nil {
-		return terr
+// aliasLanguageForField returns the language of the aliases a field with an "alias" tag holds, and false if the
+// field does not have an alias tag.
+func (c *Client) aliasLanguageForField(f reflect.StructField) (string, bool, error) {
+	language, ok := f.Tag.Lookup("alias")
+	if !ok {
+		return "", false, nil
 	}
-
-	response, err := c.client.Post(
-		map[string]string{
-			"action": "wbeditentity",
-			"token":  editToken,
-			"new":    "item",
-			"data":   string(b),
-		},
-	)
-
-	if err != nil {
-		return err
+	if f.Type != reflect.TypeOf([]string{}) {
+		return "", false, fmt.Errorf("Alias field %s must be a []string, not %v", f.Name, f.Type)
 	}
-	defer response.Close()
-
-	var res itemEditResponse
-	err = json.NewDecoder(response).Decode(&res)
-	if err != nil {
-		return err
+	if len(language) == 0 {
+		language = c.labelLanguage(WikiBaseItem)
 	}
+	return language, true, nil
+}
 
-	if res.Error != nil {
-		return res.Error
-	}
+// aliasesForCreate collects the aliases in fields with an "alias" tag, dropping empty values, duplicates, and any
+// that are the same as the label in that language.
+func (c *Client) aliasesForCreate(s reflect.Value, labels map[string]itemLabel) (map[string][]itemLabel, error) {
 
-	if res.Success != 1 {
-		return fmt.Errorf("We got an unexpected success value: %v", res)
+	aliases := make(map[string][]itemLabel, 0)
+	seen := make(map[string]bool, 0)
+	for language, label := range labels {
+		seen[language+":"+label.Value] = true
 	}
 
-	if res.Entity == nil {
+	t := s.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		language, ok, err := c.aliasLanguageForField(f)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		for _, alias := range s.Field(i).Interface().([]string) {
+			alias = strings.TrimSpace(alias)
+			key := language + ":" + alias
+			if len(alias) == 0 || seen[key] {
+				continue
+			}
+			seen[key] = true
+			aliases[language] = append(aliases[language], itemLabel{Language: language, Value: alias})
+		}
+	}
+
+	return aliases, nil
+}
+
+// labelLanguageForField returns the language of the label a field with a "label" tag holds, and false if the field
+// does not have a label tag.
+func (c *Client) labelLanguageForField(f reflect.StructField) (string, bool, error) {
+	language, ok := f.Tag.Lookup("label")
+	if !ok {
+		return "", false, nil
+	}
+	if f.Type.Kind() != reflect.String {
+		return "", false, fmt.Errorf("Label field %s must be a string, not %v", f.Name, f.Type)
+	}
+	if len(language) == 0 {
+		language = c.labelLanguage(WikiBaseItem)
+	}
+	return language, true, nil
+}
+
+// labelsForReplace collects the labels in fields with a "label" tag, of which there must be at least one that is not
+// empty, as an item must keep a label when it is replaced.
+func (c *Client) labelsForReplace(s reflect.Value) (map[string]itemLabel, error) {
+
+	labels := make(map[string]itemLabel, 0)
+	t := s.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		language, ok, err := c.labelLanguageForField(f)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		label := strings.TrimSpace(s.Field(i).String())
+		if len(label) == 0 {
+			continue
+		}
+		if utf8.RuneCountInString(label) > MaxLabelLength {
+			return nil, fmt.Errorf("Item label must not be longer than %d characters, got %d.", MaxLabelLength,
+				utf8.RuneCountInString(label))
+		}
+		if _, ok := labels[language]; ok {
+			return nil, fmt.Errorf("Item has more than one label field for language %s", language)
+		}
+		labels[language] = itemLabel{Language: language, Value: label}
+	}
+
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("Item has no label in a field with a label tag")
+	}
+	return labels, nil
+}
+
+// CreateItemInstance will take a pointer to a Go structure that has the embedded wikibase header and
+// item and property tags on its fields and create a new item with the provided label. Any fields in the structure
+// with a Property tag that does not contain the "omitoncreate" clause will also be created as item claims at the
+// same time.
+func (c *Client) CreateItemInstance(label string, i interface{}) error {
+	return c.CreateItemInstanceWithContext(context.Background(), label, i)
+}
+
+// CreateItemInstanceWithContext is CreateItemInstance, but stops with the context's error if it is cancelled before
+// the item is created.
+func (c *Client) CreateItemInstanceWithContext(ctx context.Context, label string, i interface{}) error {
+
+	if len(label) == 0 {
+		return fmt.Errorf("Item label must not be an empty string.")
+	}
+	if utf8.RuneCountInString(label) > MaxLabelLength {
+		return fmt.Errorf("Item label must not be longer than %d characters, got %d.", MaxLabelLength,
+			utf8.RuneCountInString(label))
+	}
+
+	// Can we find the headers used to record bits?
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("Expected a pointer to the item to upload, not %v", v.Kind())
+	}
+	s := v.Elem()
+	if s.Kind() != reflect.Struct {
+		return fmt.Errorf("Expected a struct for item to upload, got %v.", s.Kind())
+	}
+	header, err := findItemHeader(s)
+	if err != nil {
+		return err
+	}
+
+	// Are there any properties that we should create at this venture as part of initial
+	// upload?
+	claims, err := c.claimsForEntityEdit(ctx, s, true, reflect.Value{})
+	if err != nil {
+		return err
+	}
+
+	language := c.labelLanguage(WikiBaseItem)
+	labels := make(map[string]itemLabel, 0)
+	labels[language] = itemLabel{Language: language, Value: label}
+	aliases, err := c.aliasesForCreate(s, labels)
+	if err != nil {
+		return err
+	}
+	item := itemCreateData{Labels: labels, Aliases: aliases, Claims: claims}
+
+	b, berr := json.Marshal(&item)
+	if berr != nil {
+		return berr
+	}
+
+	// Having got things
+	editToken, terr := c.GetEditingToken()
+	if terr != nil {
+		return terr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	response, err := c.editPost(
+		map[string]string{
+			"action": "wbeditentity",
+			"token":  editToken,
+			"new":    "item",
+			"data":   string(b),
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+
+	var res itemEditResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return err
+	}
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.Success != 1 {
+		return fmt.Errorf("We got an unexpected success value: %v", res)
+	}
+
+	if res.Entity == nil {
 		return fmt.Errorf("Unexpected response from server: %v", res)
 	}
+	c.clearKnownMissingLabel(WikiBaseItem, label)
 
 	// We now need to extract the ID and all the property IDs we created
 	id_field := header.FieldByName("ID")
@@ -270,6 +859,12 @@ func (c *Client) CreateItemInstance(label string, i interface{}) error {
 	}
 	id_field.SetString(string(res.Entity.ID))
 
+	rev_field := header.FieldByName("LastRevID")
+	if !rev_field.IsValid() || rev_field.Kind() != reflect.Int {
+		return fmt.Errorf("Expected header to have int LastRevID field")
+	}
+	rev_field.SetInt(int64(res.Entity.LastRevisionID))
+
 	// we need the map used to store property IDs
 	property_map_field := header.FieldByName("PropertyIDs")
 	if !property_map_field.IsValid() || property_map_field.Kind() != reflect.Map {
@@ -279,58 +874,311 @@ func (c *Client) CreateItemInstance(label string, i interface{}) error {
 		property_map_field.Set(reflect.MakeMap(property_map_field.Type()))
 	}
 
-	for property, claims := range res.Entity.Claims {
-		// In theory there can be multiple claims per property, but we only support creating one at the moment
-		// so error if there's more than one
-		if len(claims) > 1 {
-			return fmt.Errorf("Unexpected list of claims for %s after we created just one: %v", property, claims)
-		} else if len(claims) == 1 {
-			property_map_field.SetMapIndex(reflect.ValueOf(property), reflect.ValueOf(claims[0].ID))
+	// The claims for each property are returned in the order we sent them, so match them up with the keys of the
+	// fields they came from
+	keys := make(map[string][]string)
+	for _, claim := range claims {
+		keys[claim.MainSnak.Property] = append(keys[claim.MainSnak.Property], claim.key)
+	}
+	for property, created := range res.Entity.Claims {
+		for index, claim := range created {
+			key := propertyClaimKey(property, index)
+			if index < len(keys[property]) {
+				key = keys[property][index]
+			}
+			property_map_field.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(claim.ID))
 		}
 	}
 
 	return nil
 }
 
-// UploadClaimsForItem will take a pointer to a Go structure that has the embedded wikibase header and
-// item and property tags on its fields and set the claims on the item to match. The item must have been created
-// already. If allow_refresh is set to true, all properties will be written, regardless of whether they've been
-// uploaded before; if set to false only items with no existing Wikibase Property ID in the map will be updated.
-func (c *Client) UploadClaimsForItem(i interface{}, allow_refresh bool) error {
+// ClaimAction describes what UploadClaimsForItem will do with a property.
+type ClaimAction string
+
+const (
+	ClaimActionCreate ClaimAction = "create"
+	ClaimActionUpdate ClaimAction = "update"
+	ClaimActionSkip   ClaimAction = "skip"
+)
+
+// ClaimPlan describes what UploadClaimsForItem will do for a single tagged field in a struct. ClaimID is the existing
+// claim ID if the item already has a claim for the property, and EncodedValue is the JSON that will be sent as the
+// claim value, or empty if the claim will be set to "no value". ClaimKey is the key the claim ID is stored under in
+// the item header's PropertyIDs, which is the property ID unless the struct has several fields for the property.
+type ClaimPlan struct {
+	Field         string
+	PropertyLabel string
+	PropertyID    string
+	ClaimKey      string
+	ClaimID       string
+	Action        ClaimAction
+	EncodedValue  string
+}
+
+var itemHeaderType = reflect.TypeOf(ItemHeader{})
+
+// findItemHeader finds the ItemHeader embedded in the struct, either directly or through other embedded structs or
+// pointers to structs, following the same rules as Go does for promoting fields: the shallowest header is used, and it
+// is an error for there to be more than one at that depth. A nil embedded *ItemHeader is allocated if the struct is
+// mutable.
+func findItemHeader(s reflect.Value) (reflect.Value, error) {
+
+	named := ""
+	visited := map[reflect.Type]bool{s.Type(): true}
+	level := []reflect.Value{s}
+	for len(level) > 0 {
+		matches := make([]reflect.Value, 0)
+		next := make([]reflect.Value, 0)
+		for _, v := range level {
+			t := v.Type()
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				field := v.Field(i)
+				if !f.Anonymous {
+					if f.Type == itemHeaderType || f.Type == reflect.PtrTo(itemHeaderType) {
+						named = f.Name
+					}
+					continue
+				}
+
+				if field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct {
+					if field.IsNil() {
+						if field.Type().Elem() != itemHeaderType {
+							continue
+						}
+						if !field.CanSet() {
+							return reflect.Value{}, fmt.Errorf("Embedded *ItemHeader in %v is nil", t)
+						}
+						field.Set(reflect.New(itemHeaderType))
+					}
+					field = field.Elem()
+				}
+				if field.Kind() != reflect.Struct {
+					continue
+				}
+
+				if field.Type() == itemHeaderType {
+					matches = append(matches, field)
+				} else if !visited[field.Type()] {
+					visited[field.Type()] = true
+					next = append(next, field)
+				}
+			}
+		}
+
+		switch len(matches) {
+		case 0:
+			level = next
+		case 1:
+			return matches[0], nil
+		default:
+			return reflect.Value{}, fmt.Errorf("Struct %v embeds ItemHeader more than once at the same depth", s.Type())
+		}
+	}
+
+	if len(named) > 0 {
+		return reflect.Value{}, fmt.Errorf("Struct %v has ItemHeader as field %s, but it must be embedded", s.Type(), named)
+	}
+	return reflect.Value{}, fmt.Errorf("Expected struct %v to embed ItemHeader", s.Type())
+}
+
+// itemHeaderFields finds the item header in a pointer to a struct, and returns the ID and PropertyIDs fields.
+func itemHeaderFields(i interface{}) (reflect.Value, reflect.Value, reflect.Value, error) {
 
 	// Can we find the headers used to record bits?
 	v := reflect.ValueOf(i)
 	if v.Kind() != reflect.Ptr {
-		return fmt.Errorf("Expected a pointer to the item to upload, not %v", v.Kind())
+		return reflect.Value{}, reflect.Value{}, reflect.Value{},
+			fmt.Errorf("Expected a pointer to the item to upload, not %v", v.Kind())
 	}
 	s := v.Elem()
 	if s.Kind() != reflect.Struct {
-		return fmt.Errorf("Expected a struct for item to upload, got %v.", s.Kind())
+		return reflect.Value{}, reflect.Value{}, reflect.Value{},
+			fmt.Errorf("Expected a struct for item to upload, got %v.", s.Kind())
 	}
-	header := s.FieldByName("ItemHeader")
-	if !header.IsValid() {
-		return fmt.Errorf("Expected struct to have item header")
+	header, err := findItemHeader(s)
+	if err != nil {
+		return reflect.Value{}, reflect.Value{}, reflect.Value{}, err
 	}
 
 	// Having got the header, get the item ID
 	id_field := header.FieldByName("ID")
 	if !id_field.IsValid() || id_field.Kind() != reflect.String {
-		return fmt.Errorf("Expected header to have string ID field")
-	}
-	item_id := ItemPropertyType(id_field.String())
-	if len(item_id) == 0 {
-		return fmt.Errorf("Item ID is nil in item")
+		return reflect.Value{}, reflect.Value{}, reflect.Value{}, fmt.Errorf("Expected header to have string ID field")
 	}
 
 	// we need the map used to store property IDs
 	property_map_field := header.FieldByName("PropertyIDs")
 	if !property_map_field.IsValid() || property_map_field.Kind() != reflect.Map {
-		return fmt.Errorf("Expected header to have a property map")
+		return reflect.Value{}, reflect.Value{}, reflect.Value{}, fmt.Errorf("Expected header to have a property map")
 	}
-	if property_map_field.IsNil() {
-		property_map_field.Set(reflect.MakeMap(property_map_field.Type()))
+
+	return s, id_field, property_map_field, nil
+}
+
+// RefreshLastRevID will take a pointer to a Go structure that has the embedded wikibase header, and update the
+// LastRevID in the header with the current revision ID of the item on the server.
+func (c *Client) RefreshLastRevID(i interface{}) error {
+
+	s, id_field, _, err := itemHeaderFields(i)
+	if err != nil {
+		return err
+	}
+
+	entity, err := c.getEntity(ItemPropertyType(id_field.String()), "info")
+	if err != nil {
+		return err
+	}
+
+	header, err := findItemHeader(s)
+	if err != nil {
+		return err
+	}
+	rev_field := header.FieldByName("LastRevID")
+	if !rev_field.IsValid() || rev_field.Kind() != reflect.Int {
+		return fmt.Errorf("Expected header to have int LastRevID field")
+	}
+	rev_field.SetInt(int64(entity.LastRevisionID))
+
+	return nil
+}
+
+// RefreshAliases will take a pointer to a Go structure that has the embedded wikibase header and fields with an
+// "alias" tag, and set those fields to the current aliases of the item on the server in the field's language.
+func (c *Client) RefreshAliases(i interface{}) error {
+
+	s, id_field, _, err := itemHeaderFields(i)
+	if err != nil {
+		return err
+	}
+
+	entity, err := c.getEntity(ItemPropertyType(id_field.String()), "aliases")
+	if err != nil {
+		return err
 	}
 
+	t := s.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		language, ok, err := c.aliasLanguageForField(f)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		aliases := make([]string, 0, len(entity.Aliases[language]))
+		for _, alias := range entity.Aliases[language] {
+			aliases = append(aliases, alias.Value)
+		}
+		s.Field(i).Set(reflect.ValueOf(aliases))
+	}
+
+	return nil
+}
+
+// ClaimID returns the ID of the claim previously stored in the PropertyIDs map of a pointer to a struct with an
+// embedded item header for the property with the given label. The property label must have been mapped already with
+// MapPropertyAndItemConfiguration. Returns false if there is no claim ID stored for that property.
+func (c *Client) ClaimID(i interface{}, property_label string) (string, bool) {
+
+	property_id, ok := c.PropertyMap[property_label]
+	if !ok {
+		return "", false
+	}
+
+	_, _, property_map_field, err := itemHeaderFields(i)
+	if err != nil || property_map_field.IsNil() {
+		return "", false
+	}
+
+	id_val := property_map_field.MapIndex(reflect.ValueOf(property_id))
+	if !id_val.IsValid() || id_val.Kind() != reflect.String || len(id_val.String()) == 0 {
+		return "", false
+	}
+	return id_val.String(), true
+}
+
+// PlanClaims returns what UploadClaimsForItem would do for each tagged field of the item without allowing refresh,
+// without making any network calls. This is useful for debugging complex structs.
+func (c *Client) PlanClaims(i interface{}) ([]ClaimPlan, error) {
+	return c.PlanClaimsWithRefresh(i, false)
+}
+
+// PlanClaimsWithRefresh is like PlanClaims, but takes the same arguments as UploadClaimsForItem, so the plan shows
+// the existing claims that would be updated when allow_refresh is set.
+func (c *Client) PlanClaimsWithRefresh(i interface{}, allow_refresh bool) ([]ClaimPlan, error) {
+
+	s, id_field, property_map_field, err := itemHeaderFields(i)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.planClaims(s, ItemPropertyType(id_field.String()), property_map_field, allow_refresh)
+}
+
+// DescribeItem takes a pointer to a Go structure that has the embedded wikibase header and item and property tags on
+// its fields, and returns a readable report of the item's ID and, for each tagged field, the property label and ID,
+// the claim ID if the claim has been uploaded, and the field's current value. This uses only the client's property
+// map and the struct, so makes no network calls, which makes it useful for debugging imports.
+func (c *Client) DescribeItem(i interface{}) (string, error) {
+
+	s, id_field, property_map_field, err := itemHeaderFields(i)
+	if err != nil {
+		return "", err
+	}
+	plans, err := c.planClaims(s, ItemPropertyType(id_field.String()), property_map_field, false)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if len(id_field.String()) > 0 {
+		fmt.Fprintf(&b, "Item %s\n", id_field.String())
+	} else {
+		b.WriteString("Item not yet created\n")
+	}
+	for _, plan := range plans {
+		claim_id := plan.ClaimID
+		if len(claim_id) == 0 {
+			claim_id = "not uploaded"
+		}
+		f, _ := s.Type().FieldByName(plan.Field)
+		fmt.Fprintf(&b, "  %s (%s) [%s]: %s\n", plan.PropertyLabel, plan.PropertyID, claim_id,
+			describeFieldValue(f, s.FieldByName(plan.Field)))
+	}
+	return b.String(), nil
+}
+
+// describeFieldValue formats the value of a tagged field for DescribeItem.
+func describeFieldValue(f reflect.StructField, value reflect.Value) string {
+	if isNoValueField(f, value) {
+		return "no value"
+	}
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return "no value"
+		}
+		value = value.Elem()
+	}
+	if stringer, ok := value.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	if value.CanAddr() {
+		if stringer, ok := value.Addr().Interface().(fmt.Stringer); ok {
+			return stringer.String()
+		}
+	}
+	return fmt.Sprintf("%v", value.Interface())
+}
+
+func (c *Client) planClaims(s reflect.Value, item_id ItemPropertyType, property_map_field reflect.Value,
+	allow_refresh bool) ([]ClaimPlan, error) {
+
+	plans := make([]ClaimPlan, 0)
+	counts := make(map[string]int)
+
 	t := s.Type()
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
@@ -345,36 +1193,282 @@ func (c *Client) UploadClaimsForItem(i interface{}, allow_refresh bool) error {
 
 			property_id, ok := c.PropertyMap[tag]
 			if ok == false {
-				return fmt.Errorf("No property map for property label %s", tag)
+				return nil, fmt.Errorf("No property map for property label %s", tag)
 			}
 
-			// In future we should make this update the claim, but for now if we've set it once
-			// don't set it again
-			id_val := property_map_field.MapIndex(reflect.ValueOf(property_id))
-			have_existing_claim := false
-			if id_val.IsValid() && id_val.Kind() == reflect.String && len(id_val.String()) > 0 {
-				have_existing_claim = true
+			plan := ClaimPlan{
+				Field:         f.Name,
+				PropertyLabel: tag,
+				PropertyID:    property_id,
+				ClaimKey:      propertyClaimKey(property_id, counts[property_id]),
+				Action:        ClaimActionCreate,
 			}
+			counts[property_id] += 1
 
-			data, err := getDataForClaim(f, value)
+			// If we've set it once only set it again if we're allowed to refresh
+			if !property_map_field.IsNil() {
+				id_val := property_map_field.MapIndex(reflect.ValueOf(plan.ClaimKey))
+				if id_val.IsValid() && id_val.Kind() == reflect.String && len(id_val.String()) > 0 {
+					plan.ClaimID = id_val.String()
+					if allow_refresh && hasPropertyTagOption(f, "append") {
+						plan.ClaimID = ""
+					} else if allow_refresh {
+						plan.Action = ClaimActionUpdate
+					} else {
+						plan.Action = ClaimActionSkip
+					}
+				}
+			}
+
+			data, err := c.getDataForClaim(f, value)
 			if err != nil {
-				return fmt.Errorf("Failed to marshal %s on %s: %v", property_id, item_id, err)
+				return nil, fmt.Errorf("Failed to marshal %s on %s: %v", property_id, item_id, err)
 			}
+			plan.EncodedValue = string(data)
 
-			if !have_existing_claim {
-				id, err := c.CreateClaimOnItem(item_id, property_id, data)
-				if err != nil {
-					return err
-				}
+			plans = append(plans, plan)
+		}
+	}
 
-				property_map_field.SetMapIndex(reflect.ValueOf(property_id), reflect.ValueOf(id))
-			} else if allow_refresh {
-				err := c.updateClaim(id_val.String(), data)
-				if err != nil {
-					return err
-				}
+	return plans, nil
+}
+
+// UploadClaimsForItem will take a pointer to a Go structure that has the embedded wikibase header and
+// item and property tags on its fields and set the claims on the item to match. The item must have been created
+// already. If allow_refresh is set to true, all properties will be written, regardless of whether they've been
+// uploaded before; if set to false only items with no existing Wikibase Property ID in the map will be updated.
+func (c *Client) UploadClaimsForItem(i interface{}, allow_refresh bool) error {
+	return c.UploadClaimsForItemWithContext(context.Background(), i, allow_refresh)
+}
+
+// UploadClaimsForItemWithContext is UploadClaimsForItem, but checks the context before each claim is written, and
+// stops with the context's error once it is cancelled. The IDs of claims created before then are still stored in the
+// item header, so the upload can be resumed later.
+func (c *Client) UploadClaimsForItemWithContext(ctx context.Context, i interface{}, allow_refresh bool) error {
+	return c.uploadClaimsForItem(ctx, i, allow_refresh, false)
+}
+
+// uploadClaimsForItem does the work of UploadClaimsForItemWithContext. If skip_existing_appends is set then fields with
+// the "append" clause are not added again if the item already has a claim with their value.
+func (c *Client) uploadClaimsForItem(ctx context.Context, i interface{}, allow_refresh bool,
+	skip_existing_appends bool) error {
+
+	s, id_field, property_map_field, err := itemHeaderFields(i)
+	if err != nil {
+		return err
+	}
+
+	item_id := ItemPropertyType(id_field.String())
+	if len(item_id) == 0 {
+		return fmt.Errorf("Item ID is nil in item")
+	}
+
+	if property_map_field.IsNil() {
+		property_map_field.Set(reflect.MakeMap(property_map_field.Type()))
+	}
+
+	plans, err := c.planClaims(s, item_id, property_map_field, allow_refresh)
+	if err != nil {
+		return err
+	}
+	if skip_existing_appends {
+		err = c.skipExistingAppendClaims(s, item_id, plans)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, plan := range plans {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var data []byte
+		if len(plan.EncodedValue) > 0 {
+			data = []byte(plan.EncodedValue)
+		}
+
+		switch plan.Action {
+		case ClaimActionCreate:
+			id, err := c.CreateClaimOnItem(item_id, plan.PropertyID, data)
+			if err != nil {
+				return err
+			}
+
+			property_map_field.SetMapIndex(reflect.ValueOf(plan.ClaimKey), reflect.ValueOf(id))
+		case ClaimActionUpdate:
+			err := c.updateClaim(plan.ClaimID, data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// skipExistingAppendClaims changes the plans to create claims for fields with the "append" clause to skip them if the
+// item already has a claim for the property with the same value. The item's claims are only read if needed.
+func (c *Client) skipExistingAppendClaims(s reflect.Value, item_id ItemPropertyType, plans []ClaimPlan) error {
+
+	var claims map[string][]Claim
+	for index, plan := range plans {
+		f, _ := s.Type().FieldByName(plan.Field)
+		if plan.Action != ClaimActionCreate || !hasPropertyTagOption(f, "append") {
+			continue
+		}
+		if claims == nil {
+			var err error
+			claims, err = c.GetClaims(item_id)
+			if err != nil {
+				return err
 			}
 		}
+		for _, claim := range claims[plan.PropertyID] {
+			if snakHasEncodedValue(claim.MainSnak, []byte(plan.EncodedValue)) {
+				plans[index].Action = ClaimActionSkip
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// SyncItem will take a pointer to a Go structure that has the embedded wikibase header and item and property tags on
+// its fields, and make the item on Wikibase match it. If the ID in the header is empty, the item is created with the
+// given label and the claims that are not "omitoncreate", and then the remaining claims are uploaded. Otherwise the
+// label is not used, and all the claims are uploaded, updating those uploaded before, except that fields with the
+// "append" clause are only added if the item does not already have a claim with their value. If uploading claims
+// fails after the item was created, the ID is still set in the header, so calling SyncItem again will carry on from
+// there.
+func (c *Client) SyncItem(label string, i interface{}) error {
+
+	_, id_field, _, err := itemHeaderFields(i)
+	if err != nil {
+		return err
+	}
+
+	if len(id_field.String()) > 0 {
+		return c.uploadClaimsForItem(context.Background(), i, true, true)
+	}
+
+	err = c.CreateItemInstance(label, i)
+	if err != nil {
+		return err
+	}
+	return c.UploadClaimsForItem(i, false)
+}
+
+// UploadAllClaimsAtOnce will take a pointer to a Go structure that has the embedded wikibase header and item and
+// property tags on its fields and set all the claims on the item in a single request, rather than one request per
+// claim as UploadClaimsForItem does. The item must have been created already. Claims with an ID already in the
+// property map are updated, and the IDs of new claims are stored in the map.
+func (c *Client) UploadAllClaimsAtOnce(i interface{}) error {
+
+	s, id_field, property_map_field, err := itemHeaderFields(i)
+	if err != nil {
+		return err
+	}
+
+	item_id := ItemPropertyType(id_field.String())
+	if len(item_id) == 0 {
+		return fmt.Errorf("Item ID is nil in item")
+	}
+
+	if property_map_field.IsNil() {
+		property_map_field.Set(reflect.MakeMap(property_map_field.Type()))
+	}
+
+	claims, err := c.claimsForEntityEdit(context.Background(), s, false, property_map_field)
+	if err != nil {
+		return err
+	}
+	if len(claims) == 0 {
+		return nil
+	}
+
+	sent, err := sentClaims(claims)
+	if err != nil {
+		return err
+	}
+	entity, stored, err := c.editEntityClaims(item_id, &itemCreateData{Claims: claims}, sent, false)
+	if err != nil {
+		return err
+	}
+	for index, claim := range claims {
+		if len(claim.ID) == 0 {
+			property_map_field.SetMapIndex(reflect.ValueOf(claim.key), reflect.ValueOf(stored[index].ID))
+		}
+	}
+
+	header, err := findItemHeader(s)
+	if err != nil {
+		return err
+	}
+	rev_field := header.FieldByName("LastRevID")
+	if rev_field.IsValid() && rev_field.Kind() == reflect.Int {
+		rev_field.SetInt(int64(entity.LastRevisionID))
+	}
+
+	return nil
+}
+
+// ReplaceItem will take a pointer to a Go structure that has the embedded wikibase header and item and property tags
+// on its fields, and replace the whole of the existing item with it, for bots that own items entirely. The item ends
+// up with just the labels and aliases in the struct's "label" and "alias" tagged fields, and a claim for every
+// property tagged field, including those with "omitoncreate"; any other labels, descriptions, sitelinks, and claims
+// are removed. All the claims get new IDs, which replace those in the header's property map.
+func (c *Client) ReplaceItem(i interface{}) error {
+
+	s, id_field, property_map_field, err := itemHeaderFields(i)
+	if err != nil {
+		return err
+	}
+
+	item_id := ItemPropertyType(id_field.String())
+	if len(item_id) == 0 {
+		return fmt.Errorf("Item ID is nil in item, so there is nothing to replace")
+	}
+
+	labels, err := c.labelsForReplace(s)
+	if err != nil {
+		return err
+	}
+
+	// Claims are sent without IDs, as clearing the item removes the existing ones
+	claims, err := c.claimsForEntityEdit(context.Background(), s, false, reflect.Value{})
+	if err != nil {
+		return err
+	}
+
+	aliases, err := c.aliasesForCreate(s, labels)
+	if err != nil {
+		return err
+	}
+
+	// As the item is cleared, the claims in the response are just the ones we sent
+	sent, err := sentClaims(claims)
+	if err != nil {
+		return err
+	}
+	entity, stored, err := c.editEntityClaims(item_id, &itemCreateData{Labels: labels, Aliases: aliases, Claims: claims},
+		sent, true)
+	if err != nil {
+		return err
+	}
+	property_ids := reflect.MakeMap(property_map_field.Type())
+	for index, claim := range claims {
+		property_ids.SetMapIndex(reflect.ValueOf(claim.key), reflect.ValueOf(stored[index].ID))
+	}
+	property_map_field.Set(property_ids)
+
+	header, err := findItemHeader(s)
+	if err != nil {
+		return err
+	}
+	rev_field := header.FieldByName("LastRevID")
+	if rev_field.IsValid() && rev_field.Kind() == reflect.Int {
+		rev_field.SetInt(int64(entity.LastRevisionID))
 	}
 
 	return nil
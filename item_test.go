@@ -15,8 +15,14 @@
 package wikibase
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 type SimpleItemTestStruct struct {
@@ -25,8 +31,8 @@ type SimpleItemTestStruct struct {
 
 func TestCreateItem(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {
     "entity": {
         "aliases": {},
@@ -57,25 +63,28 @@ func TestCreateItem(t *testing.T) {
 		t.Errorf("Got unexpected error: %v", err)
 	}
 	if item.ID != "Q11" {
-		t.Errorf("ID did not match expected: %s", item)
+		t.Errorf("ID did not match expected: %v", item)
+	}
+	if item.LastRevID != 55 {
+		t.Errorf("Last revision ID did not match expected: %v", item)
 	}
 
 	// Check that the request was also sane
-	if client.MostRecentArgs["action"] != "wbeditentity" {
-		t.Errorf("Unexpected action requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["action"] != "wbeditentity" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["token"] != token {
-		t.Errorf("Unexpected token requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["token"] != token {
+		t.Errorf("Unexpected token requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["new"] != "item" {
-		t.Errorf("Unexpected search requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["new"] != "item" {
+		t.Errorf("Unexpected search requested: %v", client.LastArgs())
 	}
 }
 
 func TestCreateItemWithoutEditToken(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {
     "entity": {
         "aliases": {},
@@ -113,8 +122,8 @@ type SingleClaimTestStruct struct {
 
 func TestCreateItemWithProperty(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {
     "entity": {
         "aliases": {},
@@ -164,7 +173,7 @@ func TestCreateItemWithProperty(t *testing.T) {
 		t.Errorf("Got unexpected error: %v", err)
 	}
 	if item.ID != "Q7924" {
-		t.Errorf("ID did not match expected: %s", item)
+		t.Errorf("ID did not match expected: %v", item)
 	}
 	if len(item.PropertyIDs) != 1 {
 		t.Fatalf("Property map does not contain expected values: %v", item)
@@ -174,24 +183,24 @@ func TestCreateItemWithProperty(t *testing.T) {
 	}
 
 	// Check that the request was also sane
-	if client.MostRecentArgs["action"] != "wbeditentity" {
-		t.Errorf("Unexpected action requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["action"] != "wbeditentity" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["token"] != token {
-		t.Errorf("Unexpected token requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["token"] != token {
+		t.Errorf("Unexpected token requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["new"] != "item" {
-		t.Errorf("Unexpected search requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["new"] != "item" {
+		t.Errorf("Unexpected search requested: %v", client.LastArgs())
 	}
-	if strings.Index(client.MostRecentArgs["data"], "wibble") == -1 {
-		t.Errorf("Failed to spot test data in API call: %v", client.MostRecentArgs)
+	if strings.Index(client.LastArgs()["data"], "wibble") == -1 {
+		t.Errorf("Failed to spot test data in API call: %v", client.LastArgs())
 	}
 }
 
 func TestUploadClaim(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {"pageinfo":{"lastrevid":460},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P14","hash":"db735571fef70e4d199d40fe10609312fa8e5fa9","datavalue":{"value":"wot!","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"normal"}}
 `)
 	wikibase := NewClient(client)
@@ -217,8 +226,8 @@ func TestUploadClaim(t *testing.T) {
 
 func TestUploadClaimWithInitialisedMap(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {"pageinfo":{"lastrevid":460},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P14","hash":"db735571fef70e4d199d40fe10609312fa8e5fa9","datavalue":{"value":"wot!","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"normal"}}
 `)
 	wikibase := NewClient(client)
@@ -245,7 +254,7 @@ func TestUploadClaimWithInitialisedMap(t *testing.T) {
 
 func TestUploadClaimWithExistingProperty(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
+	client := &MockNetworkClient{}
 	wikibase := NewClient(client)
 	wikibase.PropertyMap["test"] = "P14"
 	token := "insertokenhere"
@@ -268,8 +277,8 @@ func TestUploadClaimWithExistingProperty(t *testing.T) {
 
 func TestUploadClaimWithExistingPropertyButAllowRefresh(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {"pageinfo":{"lastrevid":460},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P14","hash":"db735571fef70e4d199d40fe10609312fa8e5fa9","datavalue":{"value":"wot!","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"normal"}}
 `)
 	wikibase := NewClient(client)
@@ -292,9 +301,71 @@ func TestUploadClaimWithExistingPropertyButAllowRefresh(t *testing.T) {
 	}
 }
 
+type AppendClaimTestStruct struct {
+	ItemHeader
+
+	Cites string `property:"cites,append"`
+}
+
+func TestUploadAppendClaimCreatesRatherThanUpdates(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"pageinfo":{"lastrevid":461},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P14","hash":"db735571fef70e4d199d40fe10609312fa8e5fa9","datavalue":{"value":"second source","type":"string"},"datatype":"string"},"type":"statement","id":"Q23$NEW","rank":"normal"}}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["cites"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := AppendClaimTestStruct{Cites: "second source"}
+	item.ID = "Q23"
+	item.PropertyIDs = map[string]string{"P14": "Q23$OLD"}
+
+	plans, err := wikibase.PlanClaimsWithRefresh(&item, true)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(plans) != 1 || plans[0].Action != ClaimActionCreate || len(plans[0].ClaimID) != 0 {
+		t.Errorf("Expected append field to be planned as a create: %v", plans)
+	}
+
+	err = wikibase.UploadClaimsForItem(&item, true)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+	if client.LastArgs()["action"] != "wbcreateclaim" || client.LastArgs()["entity"] != "Q23" {
+		t.Errorf("Expected a new claim to be created: %v", client.LastArgs())
+	}
+	if item.PropertyIDs["P14"] != "Q23$NEW" {
+		t.Errorf("Expected the new claim to be recorded: %v", item.PropertyIDs)
+	}
+
+	// Without refresh the claim already uploaded is left alone as before
+	plans, err = wikibase.PlanClaims(&item)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(plans) != 1 || plans[0].Action != ClaimActionSkip {
+		t.Errorf("Expected append field to be skipped without refresh: %v", plans)
+	}
+
+	// And when uploading all at once the existing claim ID is not sent, so a new claim is added
+	claims, err := wikibase.claimsForEntityEdit(context.Background(), reflect.ValueOf(item), false, reflect.ValueOf(item.PropertyIDs))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(claims) != 1 || len(claims[0].ID) != 0 {
+		t.Errorf("Expected append claim to have no ID: %v", claims)
+	}
+}
+
 func TestUploadClaimWithoutPointer(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
+	client := &MockNetworkClient{}
 	wikibase := NewClient(client)
 	wikibase.PropertyMap["test"] = "P14"
 	token := "insertokenhere"
@@ -311,7 +382,7 @@ func TestUploadClaimWithoutPointer(t *testing.T) {
 
 func TestUploadClaimWithArrayItem(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
+	client := &MockNetworkClient{}
 	wikibase := NewClient(client)
 	wikibase.PropertyMap["test"] = "P14"
 	token := "insertokenhere"
@@ -330,8 +401,8 @@ func TestUploadClaimWithArrayItem(t *testing.T) {
 
 func TestUploadClaimWithArrayItemPointer(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {"pageinfo":{"lastrevid":460},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P14","hash":"db735571fef70e4d199d40fe10609312fa8e5fa9","datavalue":{"value":"wot!","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"normal"}}
 `)
 	wikibase := NewClient(client)
@@ -365,8 +436,8 @@ type PointerPropertyClaimTestStruct struct {
 
 func TestUploadClaimNilPointer(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {"pageinfo":{"lastrevid":460},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P14","hash":"db735571fef70e4d199d40fe10609312fa8e5fa9","datavalue":{"value":"wot!","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"normal"}}
 `)
 	wikibase := NewClient(client)
@@ -383,15 +454,15 @@ func TestUploadClaimNilPointer(t *testing.T) {
 		t.Fatalf("We got an unexpected error: %v", err)
 	}
 
-	if client.MostRecentArgs["snaktype"] != "novalue" {
-		t.Errorf("We got unexpected arguments for nil property: %v", client.MostRecentArgs)
+	if client.LastArgs()["snaktype"] != "novalue" {
+		t.Errorf("We got unexpected arguments for nil property: %v", client.LastArgs())
 	}
 }
 
 func TestUploadClaimValidPointer(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {"pageinfo":{"lastrevid":460},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P14","hash":"db735571fef70e4d199d40fe10609312fa8e5fa9","datavalue":{"value":"wot!","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"normal"}}
 `)
 	wikibase := NewClient(client)
@@ -408,11 +479,11 @@ func TestUploadClaimValidPointer(t *testing.T) {
 		t.Fatalf("We got an unexpected error: %v", err)
 	}
 
-	if client.MostRecentArgs["snaktype"] != "value" {
-		t.Errorf("We got unexpected snaktype argument for non-nil property: %v", client.MostRecentArgs)
+	if client.LastArgs()["snaktype"] != "value" {
+		t.Errorf("We got unexpected snaktype argument for non-nil property: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["value"] != "\"foo\"" {
-		t.Errorf("We got unexpected value argument for non-nil property: %v", client.MostRecentArgs)
+	if client.LastArgs()["value"] != "\"foo\"" {
+		t.Errorf("We got unexpected value argument for non-nil property: %v", client.LastArgs())
 	}
 }
 
@@ -424,8 +495,8 @@ type SingleClaimWithoutInitialUploadTestStruct struct {
 
 func TestCreateItemWithOmitProperty(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {
     "entity": {
         "aliases": {},
@@ -457,31 +528,31 @@ func TestCreateItemWithOmitProperty(t *testing.T) {
 		t.Errorf("Got unexpected error: %v", err)
 	}
 	if item.ID != "Q7924" {
-		t.Errorf("ID did not match expected: %s", item)
+		t.Errorf("ID did not match expected: %v", item)
 	}
 	if len(item.PropertyIDs) != 0 {
 		t.Fatalf("Property map does not contain expected values: %v", item)
 	}
 
 	// Check that the request was also sane
-	if client.MostRecentArgs["action"] != "wbeditentity" {
-		t.Errorf("Unexpected action requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["action"] != "wbeditentity" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["token"] != token {
-		t.Errorf("Unexpected token requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["token"] != token {
+		t.Errorf("Unexpected token requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["new"] != "item" {
-		t.Errorf("Unexpected search requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["new"] != "item" {
+		t.Errorf("Unexpected search requested: %v", client.LastArgs())
 	}
-	if strings.Index(client.MostRecentArgs["data"], "wibble") != -1 {
-		t.Errorf("Unexpected data item in API call: %v", client.MostRecentArgs)
+	if strings.Index(client.LastArgs()["data"], "wibble") != -1 {
+		t.Errorf("Unexpected data item in API call: %v", client.LastArgs())
 	}
 }
 
 func TestUploadClaimWihtOmitProperty(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {"pageinfo":{"lastrevid":460},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P14","hash":"db735571fef70e4d199d40fe10609312fa8e5fa9","datavalue":{"value":"wot!","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"normal"}}
 `)
 	wikibase := NewClient(client)
@@ -505,7 +576,1142 @@ func TestUploadClaimWihtOmitProperty(t *testing.T) {
 	}
 
 	// Check that the request was also sane
-	if strings.Index(client.MostRecentArgs["data"], "wibble") != -1 {
-		t.Errorf("Unexpected data item in API call: %v", client.MostRecentArgs)
+	if strings.Index(client.LastArgs()["data"], "wibble") != -1 {
+		t.Errorf("Unexpected data item in API call: %v", client.LastArgs())
+	}
+}
+
+type PlanClaimsTestStruct struct {
+	ItemHeader
+
+	Name     string           `property:"name"`
+	Count    int              `property:"count"`
+	Missing  *string          `property:"missing"`
+	Parent   ItemPropertyType `property:"parent,omitoncreate"`
+	Untagged string
+}
+
+func TestSyncItemCreatesThenUploads(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"labels":{"en":{"language":"en","value":"Test"}},"descriptions":{},"aliases":{},"sitelinks":{},"claims":{
+    "P1":[{"mainsnak":{"snaktype":"value","property":"P1","datavalue":{"value":"blah","type":"string"}},"type":"statement","id":"Q23$NAME","rank":"normal"}],
+    "P2":[{"mainsnak":{"snaktype":"value","property":"P2","datavalue":{"value":{"amount":"+42","unit":"1"},"type":"quantity"}},"type":"statement","id":"Q23$COUNT","rank":"normal"}],
+    "P3":[{"mainsnak":{"snaktype":"novalue","property":"P3"},"type":"statement","id":"Q23$MISSING","rank":"normal"}]
+},"id":"Q23","type":"item","lastrevid":58},"success":1}
+`)
+	client.AddResponse(`
+{"pageinfo":{"lastrevid":59},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P4","datavalue":{"value":{"entity-type":"item","numeric-id":5,"id":"Q5"},"type":"wikibase-entityid"}},"type":"statement","id":"Q23$PARENT","rank":"normal"}}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["name"] = "P1"
+	wikibase.PropertyMap["count"] = "P2"
+	wikibase.PropertyMap["missing"] = "P3"
+	wikibase.PropertyMap["parent"] = "P4"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := PlanClaimsTestStruct{Name: "blah", Count: 42, Parent: "Q5"}
+
+	err := wikibase.SyncItem("Test", &item)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if item.ID != "Q23" {
+		t.Errorf("Expected the item ID to be set: %v", item.ID)
+	}
+	expected := map[string]string{"P1": "Q23$NAME", "P2": "Q23$COUNT", "P3": "Q23$MISSING", "P4": "Q23$PARENT"}
+	if !reflect.DeepEqual(item.PropertyIDs, expected) {
+		t.Errorf("Got unexpected claim IDs: %v", item.PropertyIDs)
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Expected a create and then one claim upload, got %d requests", client.InvocationCount)
+	}
+	if client.LastArgs()["action"] != "wbcreateclaim" || client.LastArgs()["property"] != "P4" {
+		t.Errorf("Expected the omitoncreate claim to be uploaded last: %v", client.LastArgs())
+	}
+}
+
+func TestSyncItemUpdatesExisting(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"pageinfo":{"lastrevid":60},"success":1}`)
+	client.AddResponse(`{"pageinfo":{"lastrevid":61},"success":1}`)
+	client.AddResponse(`{"pageinfo":{"lastrevid":62},"success":1}`)
+	client.AddResponse(`{"pageinfo":{"lastrevid":63},"success":1}`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["name"] = "P1"
+	wikibase.PropertyMap["count"] = "P2"
+	wikibase.PropertyMap["missing"] = "P3"
+	wikibase.PropertyMap["parent"] = "P4"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := PlanClaimsTestStruct{Name: "blah", Count: 43, Parent: "Q5"}
+	item.ID = "Q23"
+	item.PropertyIDs = map[string]string{"P1": "Q23$NAME", "P2": "Q23$COUNT", "P3": "Q23$MISSING", "P4": "Q23$PARENT"}
+
+	err := wikibase.SyncItem("Ignored", &item)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if item.ID != "Q23" {
+		t.Errorf("Item ID should not change: %v", item.ID)
+	}
+	if client.InvocationCount != 4 {
+		t.Errorf("Expected each claim to be updated, got %d requests", client.InvocationCount)
+	}
+	if client.LastArgs()["action"] != "wbsetclaimvalue" || client.LastArgs()["claim"] != "Q23$PARENT" {
+		t.Errorf("Expected existing claims to be updated: %v", client.LastArgs())
+	}
+}
+
+func TestSyncItemWithAppendFieldTwice(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	// First sync: the item doesn't have the value, so it is added
+	client.AddResponse(`{"claims":{}}`)
+	client.AddResponse(`
+{"pageinfo":{"lastrevid":461},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"first source","type":"string"},"datatype":"string"},"type":"statement","id":"Q23$FIRST","rank":"normal"}}
+`)
+	// Second sync: the value is already on the item, so nothing is written
+	client.AddResponse(`
+{"claims":{"P14":[{"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"first source","type":"string"},"datatype":"string"},"type":"statement","id":"Q23$FIRST","rank":"normal"}]}}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["cites"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := AppendClaimTestStruct{Cites: "first source"}
+	item.ID = "Q23"
+
+	err := wikibase.SyncItem("Ignored", &item)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 2 || client.LastArgs()["action"] != "wbcreateclaim" {
+		t.Fatalf("Expected the claim to be created: %v", client.LastArgs())
+	}
+	if item.PropertyIDs["P14"] != "Q23$FIRST" {
+		t.Errorf("Expected the new claim to be recorded: %v", item.PropertyIDs)
+	}
+
+	err = wikibase.SyncItem("Ignored", &item)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 3 || client.LastArgs()["action"] != "wbgetclaims" {
+		t.Errorf("Expected no claim to be added on the second sync: %v", client.LastArgs())
+	}
+}
+
+type ReplaceItemTestStruct struct {
+	ItemHeader
+
+	Label       string           `label:""`
+	FrenchLabel string           `label:"fr"`
+	Name        string           `property:"name"`
+	Count       int              `property:"count"`
+	Missing     *string          `property:"missing"`
+	Parent      ItemPropertyType `property:"parent,omitoncreate"`
+}
+
+func TestReplaceItem(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"labels":{"en":{"language":"en","value":"Test"}},"descriptions":{},"aliases":{},"sitelinks":{},"claims":{
+    "P1":[{"mainsnak":{"snaktype":"value","property":"P1","datavalue":{"value":"blah","type":"string"}},"type":"statement","id":"Q23$NAME2","rank":"normal"}],
+    "P2":[{"mainsnak":{"snaktype":"value","property":"P2","datavalue":{"value":{"amount":"+42","unit":"1"},"type":"quantity"}},"type":"statement","id":"Q23$COUNT2","rank":"normal"}],
+    "P3":[{"mainsnak":{"snaktype":"novalue","property":"P3"},"type":"statement","id":"Q23$MISSING2","rank":"normal"}],
+    "P4":[{"mainsnak":{"snaktype":"value","property":"P4","datavalue":{"value":{"entity-type":"item","numeric-id":5,"id":"Q5"},"type":"wikibase-entityid"}},"type":"statement","id":"Q23$PARENT2","rank":"normal"}]
+},"id":"Q23","type":"item","lastrevid":70},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["name"] = "P1"
+	wikibase.PropertyMap["count"] = "P2"
+	wikibase.PropertyMap["missing"] = "P3"
+	wikibase.PropertyMap["parent"] = "P4"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := ReplaceItemTestStruct{Label: "Test", FrenchLabel: "Essai", Name: "blah", Count: 42, Parent: "Q5"}
+	item.ID = "Q23"
+	item.PropertyIDs = map[string]string{"P1": "Q23$NAME", "P9": "Q23$STALE"}
+
+	err := wikibase.ReplaceItem(&item)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+
+	args := client.LastArgs()
+	if args["action"] != "wbeditentity" || args["id"] != "Q23" || args["clear"] != "1" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+	if _, ok := args["new"]; ok {
+		t.Errorf("Did not expect a new item to be requested: %v", args)
+	}
+	var data itemCreateData
+	err = json.Unmarshal([]byte(args["data"]), &data)
+	if err != nil {
+		t.Fatalf("Failed to decode data sent: %v", err)
+	}
+	if data.Labels["en"].Value != "Test" || data.Labels["fr"].Value != "Essai" || len(data.Claims) != 4 {
+		t.Errorf("Expected the labels and all claims to be sent: %v", args["data"])
+	}
+	for _, claim := range data.Claims {
+		if len(claim.ID) != 0 {
+			t.Errorf("Did not expect claim IDs to be sent: %v", args["data"])
+		}
+	}
+
+	expected := map[string]string{"P1": "Q23$NAME2", "P2": "Q23$COUNT2", "P3": "Q23$MISSING2", "P4": "Q23$PARENT2"}
+	if !reflect.DeepEqual(item.PropertyIDs, expected) {
+		t.Errorf("Expected claim IDs to be recaptured: %v", item.PropertyIDs)
+	}
+	if item.LastRevID != 70 {
+		t.Errorf("Expected the revision to be recorded: %v", item.LastRevID)
+	}
+}
+
+func TestReplaceItemWithoutID(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["name"] = "P1"
+
+	item := ReplaceItemTestStruct{Label: "Test", Name: "blah"}
+	err := wikibase.ReplaceItem(&item)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestReplaceItemWithoutLabel(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["name"] = "P1"
+
+	item := ReplaceItemTestStruct{Name: "blah"}
+	item.ID = "Q23"
+	err := wikibase.ReplaceItem(&item)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestPlanClaims(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["name"] = "P1"
+	wikibase.PropertyMap["count"] = "P2"
+	wikibase.PropertyMap["missing"] = "P3"
+	wikibase.PropertyMap["parent"] = "P4"
+
+	item := PlanClaimsTestStruct{Name: "blah", Count: 42, Parent: "Q5"}
+	item.ID = "Q23"
+	item.PropertyIDs = map[string]string{"P2": "Q23$COUNT"}
+
+	expected := []ClaimPlan{
+		{Field: "Name", PropertyLabel: "name", PropertyID: "P1", ClaimKey: "P1", Action: ClaimActionCreate,
+			EncodedValue: `"blah"`},
+		{Field: "Count", PropertyLabel: "count", PropertyID: "P2", ClaimKey: "P2", ClaimID: "Q23$COUNT",
+			Action: ClaimActionSkip, EncodedValue: `{"amount":"+42","unit":"1"}`},
+		{Field: "Missing", PropertyLabel: "missing", PropertyID: "P3", ClaimKey: "P3", Action: ClaimActionCreate},
+		{Field: "Parent", PropertyLabel: "parent", PropertyID: "P4", ClaimKey: "P4", Action: ClaimActionCreate,
+			EncodedValue: `{"entity-type":"item","numeric-id":5}`},
+	}
+
+	plans, err := wikibase.PlanClaims(&item)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(plans) != len(expected) {
+		t.Fatalf("We got the wrong number of plans: %v", plans)
+	}
+	for i, plan := range plans {
+		if plan != expected[i] {
+			t.Errorf("Plan %d was %v, expected %v", i, plan, expected[i])
+		}
+	}
+
+	// With refresh the existing claim should be updated rather than skipped
+	plans, err = wikibase.PlanClaimsWithRefresh(&item, true)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if plans[1].Action != ClaimActionUpdate {
+		t.Errorf("Expected existing claim to be updated: %v", plans[1])
+	}
+
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+	if item.PropertyIDs["P1"] != "" {
+		t.Errorf("Planning should not modify the item: %v", item.PropertyIDs)
+	}
+}
+
+func TestClaimID(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	wikibase.PropertyMap["other"] = "P15"
+
+	item := SingleClaimTestStruct{Test: "blah"}
+	item.ID = "Q23"
+
+	_, ok := wikibase.ClaimID(&item, "test")
+	if ok {
+		t.Errorf("Expected no claim ID before map is set")
+	}
+
+	item.PropertyIDs = map[string]string{"P14": "Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63"}
+
+	id, ok := wikibase.ClaimID(&item, "test")
+	if !ok {
+		t.Fatalf("Expected to find claim ID")
+	}
+	if id != "Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63" {
+		t.Errorf("We got the wrong claim ID: %v", id)
+	}
+
+	_, ok = wikibase.ClaimID(&item, "other")
+	if ok {
+		t.Errorf("Expected no claim ID for property without claim")
+	}
+	_, ok = wikibase.ClaimID(&item, "unmapped")
+	if ok {
+		t.Errorf("Expected no claim ID for unmapped property")
+	}
+	_, ok = wikibase.ClaimID(item, "test")
+	if ok {
+		t.Errorf("Expected no claim ID when not passed a pointer")
+	}
+}
+
+func TestRefreshLastRevID(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entities":{"Q11":{"pageid":20,"ns":120,"title":"Item:Q11","lastrevid":81,"modified":"2018-11-12T10:32:45Z","type":"item","id":"Q11"}},"success":1}
+`)
+	wikibase := NewClient(client)
+
+	item := SimpleItemTestStruct{}
+	item.ID = "Q11"
+	item.LastRevID = 55
+
+	err := wikibase.RefreshLastRevID(&item)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if item.LastRevID != 81 {
+		t.Errorf("Last revision ID did not match expected: %v", item)
+	}
+	if client.LastArgs()["ids"] != "Q11" || client.LastArgs()["props"] != "info" {
+		t.Errorf("Unexpected request: %v", client.LastArgs())
+	}
+}
+
+func TestGetEntity(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entities":{"Q11":{"pageid":20,"ns":120,"title":"Item:Q11","lastrevid":81,"type":"item","id":"Q11",
+    "labels":{"en":{"language":"en","value":"hello"},"fr":{"language":"fr","value":"bonjour"}},
+    "descriptions":{"en":{"language":"en","value":"a greeting"}},
+    "claims":{"P14":[{"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"wot!","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"normal"}]},
+    "sitelinks":{"enwiki":{"site":"enwiki","title":"Hello","badges":[]}}}},"success":1}
+`)
+	wikibase := NewClient(client)
+
+	entity, err := wikibase.GetEntity("Q11")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if entity.ID != "Q11" || entity.LastRevID != 81 || entity.RedirectedFrom != "" {
+		t.Errorf("Entity header was wrong: %v", entity)
+	}
+	if entity.Labels["fr"] != "bonjour" || entity.Descriptions["en"] != "a greeting" {
+		t.Errorf("Entity terms were wrong: %v", entity)
+	}
+	if len(entity.Claims["P14"]) != 1 || entity.Claims["P14"][0].ID != "Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63" {
+		t.Errorf("Entity claims were wrong: %v", entity.Claims)
+	}
+	if entity.Sitelinks["enwiki"] != "Hello" {
+		t.Errorf("Entity sitelinks were wrong: %v", entity.Sitelinks)
+	}
+	if client.LastArgs()["action"] != "wbgetentities" || client.LastArgs()["ids"] != "Q11" {
+		t.Errorf("Unexpected request: %v", client.LastArgs())
+	}
+}
+
+func TestGetEntityRedirected(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entities":{"Q12":{"pageid":20,"ns":120,"title":"Item:Q11","lastrevid":81,"type":"item","id":"Q11",
+    "redirects":{"from":"Q12","to":"Q11"},
+    "labels":{"en":{"language":"en","value":"hello"}}}},"success":1}
+`)
+	wikibase := NewClient(client)
+
+	entity, err := wikibase.GetEntity("Q12")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if entity.ID != "Q11" || entity.RedirectedFrom != "Q12" {
+		t.Errorf("Redirect was not reported: %v", entity)
+	}
+	if entity.Labels["en"] != "hello" {
+		t.Errorf("Target data was not returned: %v", entity)
+	}
+}
+
+func TestGetEntityRedirectedUnderTargetID(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entities":{"Q11":{"pageid":20,"ns":120,"title":"Item:Q11","lastrevid":81,"type":"item","id":"Q11",
+    "redirects":{"from":"Q12","to":"Q11"},
+    "labels":{"en":{"language":"en","value":"hello"}}}},"success":1}
+`)
+	wikibase := NewClient(client)
+
+	entity, err := wikibase.GetEntity("Q12")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if entity.ID != "Q11" || entity.RedirectedFrom != "Q12" {
+		t.Errorf("Redirect was not reported: %v", entity)
+	}
+}
+
+func TestUploadAllClaimsAtOnce(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"id":"Q23","type":"item","lastrevid":90,"labels":{},"descriptions":{},"aliases":{},"sitelinks":{},"claims":{
+    "P1":[{"mainsnak":{"snaktype":"value","property":"P1","datavalue":{"value":"blah","type":"string"},"datatype":"string"},"type":"statement","id":"Q23$NAME","rank":"normal"}],
+    "P2":[{"mainsnak":{"snaktype":"value","property":"P2","datavalue":{"value":{"amount":"+42","unit":"1"},"type":"quantity"},"datatype":"quantity"},"type":"statement","id":"Q23$COUNT","rank":"normal"}],
+    "P3":[{"mainsnak":{"snaktype":"novalue","property":"P3","datatype":"string"},"type":"statement","id":"Q23$OTHER","rank":"normal"},
+          {"mainsnak":{"snaktype":"novalue","property":"P3","datatype":"string"},"type":"statement","id":"Q23$MISSING","rank":"normal"}],
+    "P4":[{"mainsnak":{"snaktype":"value","property":"P4","datavalue":{"value":{"entity-type":"item","numeric-id":5},"type":"wikibase-entityid"},"datatype":"wikibase-item"},"type":"statement","id":"Q23$PARENT","rank":"normal"}]
+}},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["name"] = "P1"
+	wikibase.PropertyMap["count"] = "P2"
+	wikibase.PropertyMap["missing"] = "P3"
+	wikibase.PropertyMap["parent"] = "P4"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := PlanClaimsTestStruct{Name: "blah", Count: 42, Parent: "Q5"}
+	item.ID = "Q23"
+	item.PropertyIDs = map[string]string{"P2": "Q23$COUNT"}
+
+	err := wikibase.UploadAllClaimsAtOnce(&item)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+
+	if client.InvocationCount != 1 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+	args := client.LastArgs()
+	if args["action"] != "wbeditentity" || args["id"] != "Q23" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+	var data itemCreateData
+	err = json.Unmarshal([]byte(args["data"]), &data)
+	if err != nil {
+		t.Fatalf("Failed to decode data sent: %v", err)
+	}
+	if len(data.Claims) != 4 {
+		t.Fatalf("Expected all claims to be sent, including omitoncreate: %v", data.Claims)
+	}
+	if data.Claims[1].ID != "Q23$COUNT" {
+		t.Errorf("Expected existing claim ID to be sent: %v", data.Claims[1])
+	}
+	if len(data.Labels) != 0 {
+		t.Errorf("Did not expect labels to be sent: %v", data.Labels)
+	}
+
+	expected := map[string]string{"P1": "Q23$NAME", "P2": "Q23$COUNT", "P3": "Q23$MISSING", "P4": "Q23$PARENT"}
+	if !reflect.DeepEqual(item.PropertyIDs, expected) {
+		t.Errorf("We got the wrong property IDs: %v", item.PropertyIDs)
+	}
+	if item.LastRevID != 90 {
+		t.Errorf("Last revision ID was not updated: %v", item.LastRevID)
+	}
+}
+
+func TestCreateItemWithWhitespaceOnlyString(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{"P14":[{"mainsnak":{"snaktype":"novalue","property":"P14","datatype":"string"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"normal"}]},"descriptions":{},"id":"Q11","labels":{"en":{"language":"en","value":"blah"}},"lastrevid":55,"sitelinks":{},"type":"item"},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := SingleClaimTestStruct{Test: "   \n  "}
+	err := wikibase.CreateItemInstance("blah", &item)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+
+	var data itemCreateData
+	err = json.Unmarshal([]byte(client.LastArgs()["data"]), &data)
+	if err != nil {
+		t.Fatalf("Failed to decode data sent: %v", err)
+	}
+	if len(data.Claims) != 1 || data.Claims[0].MainSnak.SnakType != "novalue" || data.Claims[0].MainSnak.DataValue != nil {
+		t.Errorf("Expected a novalue claim: %v", data.Claims)
+	}
+}
+
+func TestUploadClaimWithWhitespaceOnlyString(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"pageinfo":{"lastrevid":460},"success":1,"claim":{"mainsnak":{"snaktype":"novalue","property":"P14","datatype":"string"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"normal"}}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := SingleClaimTestStruct{Test: "   \n  "}
+	item.ID = "Q23"
+	item.PropertyIDs = map[string]string{"P14": "Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63"}
+
+	err := wikibase.UploadClaimsForItem(&item, true)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.LastArgs()["action"] != "wbsetclaimvalue" || client.LastArgs()["snaktype"] != "novalue" {
+		t.Errorf("Expected a novalue update: %v", client.LastArgs())
+	}
+	if _, ok := client.LastArgs()["value"]; ok {
+		t.Errorf("Did not expect a value: %v", client.LastArgs())
+	}
+}
+
+func TestCreateItemWithOverLengthLabel(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	// Labels are measured in characters, not bytes, so 250 CJK characters is allowed
+	item := SimpleItemTestStruct{}
+	label := strings.Repeat("漢", 250)
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"Q11","labels":{},"lastrevid":55,"sitelinks":{},"type":"item"},"success":1}
+`)
+	err := wikibase.CreateItemInstance(label, &item)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if !strings.Contains(client.LastArgs()["data"], label) {
+		t.Errorf("Label was not sent unchanged: %v", client.LastArgs())
+	}
+
+	item = SimpleItemTestStruct{}
+	err = wikibase.CreateItemInstance(label+"字", &item)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if !strings.Contains(err.Error(), "250") {
+		t.Errorf("Error should mention the limit: %v", err)
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+type AliasTestStruct struct {
+	ItemHeader
+
+	Names       []string `alias:""`
+	FrenchNames []string `alias:"fr"`
+}
+
+func TestCreateItemWithAliases(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"Q11","labels":{"en":{"language":"en","value":"Douglas Adams"}},"lastrevid":55,"sitelinks":{},"type":"item"},"success":1}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := AliasTestStruct{
+		Names:       []string{"Douglas Noël Adams", "Douglas Adams", "DNA", " DNA ", ""},
+		FrenchNames: []string{"Douglas Adams"},
+	}
+	err := wikibase.CreateItemInstance("Douglas Adams", &item)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	var data itemCreateData
+	err = json.Unmarshal([]byte(client.LastArgs()["data"]), &data)
+	if err != nil {
+		t.Fatalf("Failed to decode data sent: %v", err)
+	}
+	expected := map[string][]itemLabel{
+		"en": {{Language: "en", Value: "Douglas Noël Adams"}, {Language: "en", Value: "DNA"}},
+		"fr": {{Language: "fr", Value: "Douglas Adams"}},
+	}
+	if !reflect.DeepEqual(data.Aliases, expected) {
+		t.Errorf("Got wrong aliases: %v", data.Aliases)
+	}
+}
+
+func TestCreateItemWithBadAliasField(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := struct {
+		ItemHeader
+		Name string `alias:""`
+	}{Name: "hello"}
+	err := wikibase.CreateItemInstance("blah", &item)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestRefreshAliases(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entities":{"Q11":{"type":"item","id":"Q11","aliases":{"en":[{"language":"en","value":"DNA"},{"language":"en","value":"Douglas Noël Adams"}]}}},"success":1}
+`)
+	wikibase := NewClient(client)
+
+	item := AliasTestStruct{FrenchNames: []string{"old"}}
+	item.ID = "Q11"
+	err := wikibase.RefreshAliases(&item)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(item.Names, []string{"DNA", "Douglas Noël Adams"}) {
+		t.Errorf("Got wrong aliases: %v", item.Names)
+	}
+	if len(item.FrenchNames) != 0 {
+		t.Errorf("Expected no French aliases: %v", item.FrenchNames)
+	}
+	if client.LastArgs()["props"] != "aliases" {
+		t.Errorf("Unexpected request: %v", client.LastArgs())
+	}
+}
+
+func TestGetEntityAtRevision(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"pages":{"20":{"pageid":20,"ns":120,"title":"Item:Q11","revisions":[{"revid":75,"parentid":74,
+    "slots":{"main":{"contentmodel":"wikibase-item","contentformat":"application/json",
+    "*":"{\"type\":\"item\",\"id\":\"Q11\",\"labels\":{\"en\":{\"language\":\"en\",\"value\":\"hello then\"}},\"descriptions\":[],\"aliases\":{},\"claims\":{},\"sitelinks\":{}}"}}}]}}}}
+`)
+	wikibase := NewClient(client)
+
+	entity, err := wikibase.GetEntityAtRevision("Q11", 75)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if entity.ID != "Q11" || entity.LastRevID != 75 {
+		t.Errorf("Entity header was wrong: %v", entity)
+	}
+	if entity.Labels["en"] != "hello then" {
+		t.Errorf("Entity terms were wrong: %v", entity)
+	}
+
+	args := client.LastArgs()
+	if args["action"] != "query" || args["prop"] != "revisions" || args["revids"] != "75" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+}
+
+func TestGetEntityAtRevisionOfOtherEntity(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"pages":{"21":{"pageid":21,"ns":120,"title":"Item:Q12","revisions":[{"revid":76,"parentid":0,
+    "slots":{"main":{"contentmodel":"wikibase-item","contentformat":"application/json",
+    "*":"{\"type\":\"item\",\"id\":\"Q12\",\"labels\":{},\"descriptions\":{},\"aliases\":{},\"claims\":{},\"sitelinks\":{}}"}}}]}}}}
+`)
+	wikibase := NewClient(client)
+
+	_, err := wikibase.GetEntityAtRevision("Q11", 76)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if !strings.Contains(err.Error(), "Item:Q12") {
+		t.Errorf("Error should say which entity the revision belongs to: %v", err)
+	}
+}
+
+func TestGetEntityAtMissingRevision(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"badrevids":{"999":{"revid":999,"missing":""}}}}
+`)
+	wikibase := NewClient(client)
+
+	_, err := wikibase.GetEntityAtRevision("Q11", 999)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+}
+
+func TestGetEntityHistory(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entities":{"Q11":{"pageid":20,"ns":120,"title":"Item:Q11","lastrevid":84,"modified":"2018-05-03T10:00:00Z","type":"item","id":"Q11"}},"success":1}
+`)
+	client.AddResponse(`
+{"continue":{"rvcontinue":"20180502130321|82","continue":"||"},"query":{"pages":{"20":{"pageid":20,"ns":120,"title":"Item:Q11","revisions":[
+    {"revid":84,"parentid":83,"user":"ContentMineBot","timestamp":"2018-05-03T10:00:00Z","comment":"/* wbsetclaim-update:2||1 */ [[Property:P14]]: wot!"},
+    {"revid":83,"parentid":82,"user":"Alice","timestamp":"2018-05-02T14:00:00Z","comment":"fix label"}
+]}}}}
+`)
+	client.AddResponse(`
+{"batchcomplete":"","query":{"pages":{"20":{"pageid":20,"ns":120,"title":"Item:Q11","revisions":[
+    {"revid":82,"parentid":0,"user":"ContentMineBot","timestamp":"2018-05-02T13:03:21Z","comment":"/* wbeditentity-create:0| */"}
+]}}}}
+`)
+	wikibase := NewClient(client)
+
+	revisions, err := wikibase.GetEntityHistory("Q11", 0)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("We got the wrong number of revisions: %v", revisions)
+	}
+	if revisions[0].RevID != 84 || revisions[0].ParentID != 83 || revisions[0].User != "ContentMineBot" {
+		t.Errorf("We got the wrong first revision: %v", revisions[0])
+	}
+	if revisions[1].Comment != "fix label" ||
+		!revisions[1].Timestamp.Equal(time.Date(2018, 5, 2, 14, 0, 0, 0, time.UTC)) {
+		t.Errorf("We got the wrong second revision: %v", revisions[1])
+	}
+	if revisions[2].RevID != 82 || revisions[2].ParentID != 0 {
+		t.Errorf("We got the wrong last revision: %v", revisions[2])
+	}
+
+	args := client.LastArgs()
+	if args["prop"] != "revisions" || args["titles"] != "Item:Q11" || args["rvcontinue"] != "20180502130321|82" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+}
+
+func TestGetEntityHistoryLimit(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entities":{"Q11":{"pageid":20,"ns":120,"title":"Item:Q11","lastrevid":84,"type":"item","id":"Q11"}},"success":1}
+`)
+	client.AddResponse(`
+{"continue":{"rvcontinue":"20180502130321|82","continue":"||"},"query":{"pages":{"20":{"pageid":20,"ns":120,"title":"Item:Q11","revisions":[
+    {"revid":84,"parentid":83,"user":"ContentMineBot","timestamp":"2018-05-03T10:00:00Z","comment":""},
+    {"revid":83,"parentid":82,"user":"Alice","timestamp":"2018-05-02T14:00:00Z","comment":"fix label"}
+]}}}}
+`)
+	wikibase := NewClient(client)
+
+	revisions, err := wikibase.GetEntityHistory("Q11", 2)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Errorf("We got the wrong number of revisions: %v", revisions)
+	}
+	if client.InvocationCount != 2 || client.LastArgs()["rvlimit"] != "2" {
+		t.Errorf("Unexpected requests: %v", client)
+	}
+}
+
+type IndirectHeaderBase struct {
+	ItemHeader
+	Source string
+}
+
+type IndirectHeaderTestStruct struct {
+	IndirectHeaderBase
+
+	Test string `property:"test"`
+}
+
+type PointerHeaderTestStruct struct {
+	*ItemHeader
+
+	Test string `property:"test"`
+}
+
+func TestUploadClaimWithIndirectHeader(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := IndirectHeaderTestStruct{Test: "blah"}
+	item.ID = "Q23"
+
+	err := wikibase.UploadClaimsForItem(&item, false)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if item.PropertyIDs["P14"] != "Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63" {
+		t.Errorf("We got the wrong property ID: %v", item.PropertyIDs)
+	}
+}
+
+func TestCreateItemWithPointerHeader(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"Q11","labels":{"en":{"language":"en","value":"blah"}},"lastrevid":55,"sitelinks":{},"type":"item"},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := PointerHeaderTestStruct{}
+	err := wikibase.CreateItemInstance("blah", &item)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if item.ItemHeader == nil || item.ID != "Q11" || item.LastRevID != 55 {
+		t.Errorf("Header was not filled in: %v", item.ItemHeader)
+	}
+}
+
+func TestItemHeaderErrors(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+
+	named := struct {
+		Header ItemHeader
+		Test   string `property:"test"`
+	}{}
+	err := wikibase.UploadClaimsForItem(&named, false)
+	if err == nil || !strings.Contains(err.Error(), "must be embedded") {
+		t.Errorf("We expected an error about the named header: %v", err)
+	}
+
+	type OtherBase struct {
+		ItemHeader
+	}
+	twice := struct {
+		*IndirectHeaderBase
+		*OtherBase
+	}{&IndirectHeaderBase{}, &OtherBase{}}
+	err = wikibase.UploadClaimsForItem(&twice, false)
+	if err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("We expected an error about the ambiguous header: %v", err)
+	}
+
+	none := struct {
+		Test string `property:"test"`
+	}{}
+	err = wikibase.UploadClaimsForItem(&none, false)
+	if err == nil {
+		t.Errorf("We expected an error")
+	}
+
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+type NoValueTestStruct struct {
+	ItemHeader
+
+	Children int    `property:"number of children,novalue"`
+	Siblings int    `property:"number of siblings"`
+	Name     string `property:"name,novalue"`
+}
+
+func TestCreateItemWithNoValueOption(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"Q11","labels":{"en":{"language":"en","value":"blah"}},"lastrevid":55,"sitelinks":{},"type":"item"},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["number of children"] = "P14"
+	wikibase.PropertyMap["number of siblings"] = "P15"
+	wikibase.PropertyMap["name"] = "P16"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := NoValueTestStruct{Name: "Douglas"}
+	err := wikibase.CreateItemInstance("blah", &item)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	var data itemCreateData
+	err = json.Unmarshal([]byte(client.LastArgs()["data"]), &data)
+	if err != nil {
+		t.Fatalf("Failed to decode data sent: %v", err)
+	}
+	if len(data.Claims) != 3 {
+		t.Fatalf("Expected all claims to be created: %v", data.Claims)
+	}
+	snaktypes := make(map[string]string)
+	for _, claim := range data.Claims {
+		snaktypes[claim.MainSnak.Property] = claim.MainSnak.SnakType
+	}
+	expected := map[string]string{"P14": "novalue", "P15": "value", "P16": "value"}
+	if !reflect.DeepEqual(snaktypes, expected) {
+		t.Errorf("We got the wrong snak types: %v", snaktypes)
+	}
+}
+
+func TestUploadClaimWithNoValueOption(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["number of children"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := struct {
+		ItemHeader
+		Children int `property:"number of children,novalue"`
+	}{}
+	item.ID = "Q23"
+
+	err := wikibase.UploadClaimsForItem(&item, false)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 1 {
+		t.Fatalf("Got unexpected invocation count: %v", client)
+	}
+	args := client.LastArgs()
+	if args["property"] != "P14" || args["snaktype"] != "novalue" {
+		t.Errorf("Expected novalue claim to be created: %v", args)
+	}
+	if _, ok := args["value"]; ok {
+		t.Errorf("Did not expect a value: %v", args)
+	}
+}
+
+type MultiClaimTestStruct struct {
+	ItemHeader
+
+	Name      string `property:"name"`
+	OtherName string `property:"name"`
+}
+
+func TestCreateItemWithMultipleClaimsForProperty(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"aliases":{},"descriptions":{},"id":"Q11","labels":{"en":{"language":"en","value":"blah"}},"lastrevid":55,"sitelinks":{},"type":"item",
+    "claims":{"P14":[
+        {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"first","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$FIRST","rank":"normal"},
+        {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"second","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$SECOND","rank":"normal"}
+    ]}},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["name"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := MultiClaimTestStruct{Name: "first", OtherName: "second"}
+	err := wikibase.CreateItemInstance("blah", &item)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"P14": "Q11$FIRST", "P14#1": "Q11$SECOND"}
+	if !reflect.DeepEqual(item.PropertyIDs, expected) {
+		t.Errorf("We got the wrong property IDs: %v", item.PropertyIDs)
+	}
+
+	// Both fields are now known, so neither should be created again
+	plans, err := wikibase.PlanClaims(&item)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(plans) != 2 || plans[0].ClaimID != "Q11$FIRST" || plans[1].ClaimID != "Q11$SECOND" ||
+		plans[0].Action != ClaimActionSkip || plans[1].Action != ClaimActionSkip {
+		t.Errorf("We got the wrong plans: %v", plans)
+	}
+}
+
+type MultipleClaimTestStruct struct {
+	ItemHeader
+
+	First  string `property:"first"`
+	Second string `property:"second"`
+	Third  string `property:"third"`
+}
+
+// cancellingNetworkClient cancels a context once it has made a set number of requests.
+type cancellingNetworkClient struct {
+	MockNetworkClient
+
+	cancel func()
+	after  int
+}
+
+func (c *cancellingNetworkClient) Post(args map[string]string) (io.ReadCloser, error) {
+	res, err := c.MockNetworkClient.Post(args)
+	if c.InvocationCount == c.after {
+		c.cancel()
+	}
+	return res, err
+}
+
+func TestUploadClaimsCancelledMidLoop(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &cancellingNetworkClient{cancel: cancel, after: 1}
+	client.AddResponse(`
+{"pageinfo":{"lastrevid":460},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"one","type":"string"},"datatype":"string"},"type":"statement","id":"Q23$FIRST","rank":"normal"}}
+`)
+	client.AddResponse(`
+{"pageinfo":{"lastrevid":461},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P15","datavalue":{"value":"two","type":"string"},"datatype":"string"},"type":"statement","id":"Q23$SECOND","rank":"normal"}}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["first"] = "P14"
+	wikibase.PropertyMap["second"] = "P15"
+	wikibase.PropertyMap["third"] = "P16"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := MultipleClaimTestStruct{First: "one", Second: "two", Third: "three"}
+	item.ID = "Q23"
+
+	err := wikibase.UploadClaimsForItemWithContext(ctx, &item, false)
+	if err != context.Canceled {
+		t.Fatalf("Expected the upload to be cancelled, got: %v", err)
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Expected no claims to be sent after cancelling: %v", client.InvocationCount)
+	}
+	if len(item.PropertyIDs) != 1 || item.PropertyIDs["P14"] != "Q23$FIRST" {
+		t.Errorf("Expected only the first claim to be recorded: %v", item.PropertyIDs)
+	}
+}
+
+func TestCreateItemCancelled(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P19"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	item := SingleClaimTestStruct{Test: "wibble"}
+	err := wikibase.CreateItemInstanceWithContext(ctx, "blah", &item)
+	if err != context.Canceled {
+		t.Fatalf("Expected the create to be cancelled, got: %v", err)
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+	if len(item.ID) != 0 {
+		t.Errorf("Expected no item ID to be set: %v", item)
+	}
+}
+
+type DescribeItemTestStruct struct {
+	ItemHeader
+
+	Title   string           `property:"title"`
+	Author  ItemPropertyType `property:"author"`
+	Website *url.URL         `property:"website"`
+	Pages   *int             `property:"pages"`
+	Died    time.Time        `property:"died"`
+}
+
+func TestDescribeItem(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["title"] = "P1476"
+	wikibase.PropertyMap["author"] = "P50"
+	wikibase.PropertyMap["website"] = "P856"
+	wikibase.PropertyMap["pages"] = "P1104"
+	wikibase.PropertyMap["died"] = "P570"
+
+	website, _ := url.Parse("https://example.org/book")
+	item := DescribeItemTestStruct{
+		Title:   "So Long",
+		Author:  "Q42",
+		Website: website,
+		Died:    time.Date(2001, 5, 11, 0, 0, 0, 0, time.UTC),
+	}
+	item.ID = "Q100"
+	item.PropertyIDs = map[string]string{"P1476": "Q100$1", "P50": "Q100$2"}
+
+	report, err := wikibase.DescribeItem(&item)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	expected := "Item Q100\n" +
+		"  title (P1476) [Q100$1]: So Long\n" +
+		"  author (P50) [Q100$2]: Q42\n" +
+		"  website (P856) [not uploaded]: https://example.org/book\n" +
+		"  pages (P1104) [not uploaded]: no value\n" +
+		"  died (P570) [not uploaded]: 2001-05-11 00:00:00 +0000 UTC\n"
+	if report != expected {
+		t.Errorf("We got an unexpected report:\n%s", report)
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+
+	// Properties that have not been mapped are an error
+	delete(wikibase.PropertyMap, "died")
+	_, err = wikibase.DescribeItem(&item)
+	if err == nil {
+		t.Errorf("We expected an error for an unmapped property")
 	}
 }
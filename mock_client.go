@@ -0,0 +1,88 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// MockNetworkClient is an in-memory implementation of NetworkClientInterface that can be passed to NewClient so that
+// code built on this library can be unit tested without a Wikibase server. Queue up the raw JSON responses you expect
+// the server to send with AddResponse and AddError, and they will be returned in order for each Get or Post call made.
+type MockNetworkClient struct {
+	InvocationCount int
+
+	responses []mockNetworkClientResponse
+	lastArgs  map[string]string
+	lock      sync.Mutex
+}
+
+type mockNetworkClientResponse struct {
+	data string
+	err  error
+}
+
+func (c *MockNetworkClient) innerCall(args map[string]string) (io.ReadCloser, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.lastArgs = args
+
+	if c.InvocationCount >= len(c.responses) {
+		return nil, fmt.Errorf("Mock client has no response queued for request %d: %v", c.InvocationCount, args)
+	}
+
+	resp := c.responses[c.InvocationCount]
+	c.InvocationCount += 1
+
+	if resp.err != nil {
+		return nil, resp.err
+	}
+
+	return ioutil.NopCloser(bytes.NewBuffer([]byte(resp.data))), nil
+}
+
+func (c *MockNetworkClient) Get(args map[string]string) (io.ReadCloser, error) {
+	return c.innerCall(args)
+}
+
+func (c *MockNetworkClient) Post(args map[string]string) (io.ReadCloser, error) {
+	return c.innerCall(args)
+}
+
+// AddResponse queues up the body of a response to be returned by a future request.
+func (c *MockNetworkClient) AddResponse(data string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.responses = append(c.responses, mockNetworkClientResponse{data: data})
+}
+
+// AddError queues up a network error to be returned by a future request.
+func (c *MockNetworkClient) AddError(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.responses = append(c.responses, mockNetworkClientResponse{err: err})
+}
+
+// LastArgs returns the arguments passed to the most recent Get or Post call, or nil if no calls have been made.
+func (c *MockNetworkClient) LastArgs() map[string]string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lastArgs
+}
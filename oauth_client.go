@@ -15,10 +15,16 @@
 package wikibase
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mrjones/oauth"
 )
@@ -51,8 +57,76 @@ type OAuthInformation struct {
 type OAuthNetworkClient struct {
 	APIURL string
 
+	// If greater than zero, requests that take longer than this, including reading the response, will fail rather
+	// than hanging indefinitely on an unresponsive server.
+	Timeout time.Duration
+
 	AccessToken *oauth.AccessToken
-	consumer    *oauth.Consumer
+	consumer    oauthConsumer
+
+	consumerKey  string
+	authorizeURL string
+}
+
+// oauthConsumer is the subset of the oauth.Consumer methods we use, so that they can be replaced in tests.
+type oauthConsumer interface {
+	Get(url string, userParams map[string]string, token *oauth.AccessToken) (*http.Response, error)
+	Post(url string, userParams map[string]string, token *oauth.AccessToken) (*http.Response, error)
+	GetRequestTokenAndUrl(callbackURL string) (*oauth.RequestToken, string, error)
+	AuthorizeToken(rtoken *oauth.RequestToken, verificationCode string) (*oauth.AccessToken, error)
+}
+
+// oauthHTTPClient is used by the OAuth consumer to make requests, so that we can apply the timeout set on the
+// network client at the time of the request.
+type oauthHTTPClient struct {
+	network_client *OAuthNetworkClient
+}
+
+func (c *oauthHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	client := http.Client{Timeout: c.network_client.Timeout}
+
+	// Large responses such as those from wbgetentities compress well. Setting this ourselves stops the transport
+	// doing it for us, so we must also decompress ourselves.
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = decompressResponse(response)
+	if err != nil {
+		response.Body.Close()
+		return nil, err
+	}
+	return response, nil
+}
+
+// gzipReadCloser closes both the decompressor and the underlying response body.
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (r *gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.body.Close()
+}
+
+// decompressResponse replaces the body of the response with a decompressed version if the server sent it gzipped.
+func decompressResponse(response *http.Response) error {
+	if !strings.EqualFold(response.Header.Get("Content-Encoding"), "gzip") {
+		return nil
+	}
+	reader, err := gzip.NewReader(response.Body)
+	if err != nil {
+		return err
+	}
+	response.Body = &gzipReadCloser{Reader: reader, body: response.Body}
+	response.Header.Del("Content-Encoding")
+	response.Header.Del("Content-Length")
+	response.ContentLength = -1
+	return nil
 }
 
 // Factory method for creating a new client
@@ -69,10 +143,37 @@ func LoadOauthInformation(path string) (OAuthInformation, error) {
 	return info, err
 }
 
+// SaveOauthInformation writes the OAuth information to the file at path in the format read by LoadOauthInformation.
+// As the file contains secrets it is only made readable by the current user.
+func SaveOauthInformation(path string, info OAuthInformation) error {
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	// The file may have existed already with looser permissions
+	err = f.Chmod(0600)
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
 func NewOAuthNetworkClient(oauthInfo OAuthInformation, urlbase string) *OAuthNetworkClient {
 
 	res := OAuthNetworkClient{
-		APIURL: fmt.Sprintf("%s/w/api.php", urlbase),
+		APIURL:       fmt.Sprintf("%s/w/api.php", urlbase),
+		consumerKey:  oauthInfo.Consumer.Key,
+		authorizeURL: fmt.Sprintf("%s/wiki/Special:OAuth/authorize", urlbase),
 	}
 
 	if oauthInfo.Access != nil {
@@ -80,18 +181,100 @@ func NewOAuthNetworkClient(oauthInfo OAuthInformation, urlbase string) *OAuthNet
 		res.AccessToken = &aToken
 	}
 
-	res.consumer = oauth.NewConsumer(
+	consumer := oauth.NewConsumer(
 		oauthInfo.Consumer.Key,
 		oauthInfo.Consumer.Secret,
 		oauth.ServiceProvider{
 			RequestTokenUrl:   fmt.Sprintf("%s/wiki/Special:OAuth/initiate", urlbase),
-			AuthorizeTokenUrl: fmt.Sprintf("%s/wiki/Special:OAuth/authorize", urlbase),
+			AuthorizeTokenUrl: res.authorizeURL,
 			AccessTokenUrl:    fmt.Sprintf("%s/wiki/Special:OAuth/token", urlbase),
 		})
+	consumer.HttpClient = &oauthHTTPClient{network_client: &res}
+	res.consumer = consumer
 
 	return &res
 }
 
+// OAuth handshake
+//
+// If you only have consumer credentials, these methods let you get an access token for a user. Call GetRequestToken,
+// send the user to the AuthorizationURL for that token, and then pass the verification code they are shown to
+// GetAccessToken. The returned access token can be stored in OAuthInformation.Access for future runs.
+
+// GetRequestToken starts the OAuth handshake by getting a new request token from the server.
+func (client *OAuthNetworkClient) GetRequestToken() (*oauth.RequestToken, error) {
+	// MediaWiki only supports out of band verification, so we don't provide a callback
+	request_token, _, err := client.consumer.GetRequestTokenAndUrl("oob")
+	if err != nil {
+		return nil, err
+	}
+	return request_token, nil
+}
+
+// AuthorizationURL returns the URL the user must visit to authorise the request token. MediaWiki will show the user
+// a verification code once they have done so.
+func (client *OAuthNetworkClient) AuthorizationURL(request_token *oauth.RequestToken) string {
+	params := url.Values{}
+	params.Set("oauth_token", request_token.Token)
+	params.Set("oauth_consumer_key", client.consumerKey)
+	return fmt.Sprintf("%s?%s", client.authorizeURL, params.Encode())
+}
+
+// GetAccessToken completes the OAuth handshake by exchanging the authorised request token and the verification code
+// the user was shown for an access token. The client will use the new access token for all future requests.
+func (client *OAuthNetworkClient) GetAccessToken(request_token *oauth.RequestToken, verifier string) (*AccessToken, error) {
+	access_token, err := client.consumer.AuthorizeToken(request_token, verifier)
+	if err != nil {
+		return nil, err
+	}
+	client.AccessToken = access_token
+	return &AccessToken{Token: access_token.Token, Secret: access_token.Secret}, nil
+}
+
+// HTTPError is returned by the network client when the server responds with a status other than 200 OK. If the
+// server sent a Retry-After header, such as with a 429 or 503 response, RetryAfter is how long it asked us to wait.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("Go a %d response: %s", e.StatusCode, e.Status)
+}
+
+// Is allows errors.Is to match 429 Too Many Requests responses against ErrRateLimited.
+func (e *HTTPError) Is(target error) bool {
+	return target == ErrRateLimited && e.StatusCode == http.StatusTooManyRequests
+}
+
+// newHTTPError makes the error for a response with a status other than 200 OK.
+func newHTTPError(response *http.Response) *HTTPError {
+	return &HTTPError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		RetryAfter: parseRetryAfter(response.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter decodes a Retry-After header, which is either a number of seconds or an HTTP date. Zero is
+// returned if the header is missing or not valid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if len(header) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil && when.After(now) {
+		return when.Sub(now)
+	}
+	return 0
+}
+
 // Network action requests
 //
 // These methods should do as little as possible beyond abstracting the network protocol to enable us
@@ -108,7 +291,8 @@ func (client *OAuthNetworkClient) Get(args map[string]string) (io.ReadCloser, er
 	}
 
 	if response.StatusCode != 200 {
-		return nil, fmt.Errorf("Go a %d response: %s", response.StatusCode, response.Status)
+		response.Body.Close()
+		return nil, newHTTPError(response)
 	}
 
 	return response.Body, nil
@@ -125,7 +309,8 @@ func (client *OAuthNetworkClient) Post(args map[string]string) (io.ReadCloser, e
 	}
 
 	if response.StatusCode != 200 {
-		return nil, fmt.Errorf("Go a %d response: %s", response.StatusCode, response.Status)
+		response.Body.Close()
+		return nil, newHTTPError(response)
 	}
 
 	return response.Body, nil
@@ -0,0 +1,283 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mrjones/oauth"
+)
+
+type mockOAuthConsumer struct {
+	callbackURL  string
+	requestToken *oauth.RequestToken
+	verifier     string
+}
+
+func (c *mockOAuthConsumer) Get(url string, userParams map[string]string, token *oauth.AccessToken) (*http.Response, error) {
+	return nil, fmt.Errorf("Not implemented")
+}
+
+func (c *mockOAuthConsumer) Post(url string, userParams map[string]string, token *oauth.AccessToken) (*http.Response, error) {
+	return nil, fmt.Errorf("Not implemented")
+}
+
+func (c *mockOAuthConsumer) GetRequestTokenAndUrl(callbackURL string) (*oauth.RequestToken, string, error) {
+	c.callbackURL = callbackURL
+	return &oauth.RequestToken{Token: "requesttoken", Secret: "requestsecret"}, "http://example.com/ignored", nil
+}
+
+func (c *mockOAuthConsumer) AuthorizeToken(rtoken *oauth.RequestToken, verificationCode string) (*oauth.AccessToken, error) {
+	c.requestToken = rtoken
+	c.verifier = verificationCode
+	if verificationCode != "verifier" {
+		return nil, fmt.Errorf("Bad verifier")
+	}
+	return &oauth.AccessToken{Token: "accesstoken", Secret: "accesssecret"}, nil
+}
+
+func TestOAuthNetworkClientTimeout(t *testing.T) {
+
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+	defer close(done)
+
+	info := OAuthInformation{Consumer: ConsumerInformation{Key: "key", Secret: "secret"}}
+	client := NewOAuthNetworkClient(info, server.URL)
+	client.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, err := client.Get(map[string]string{"action": "query"})
+	if err == nil {
+		t.Fatalf("We expected a timeout error")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Request took too long to time out: %v", time.Since(start))
+	}
+}
+
+func TestOAuthNetworkClientNoTimeout(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	info := OAuthInformation{Consumer: ConsumerInformation{Key: "key", Secret: "secret"}}
+	client := NewOAuthNetworkClient(info, server.URL)
+	client.Timeout = 2 * time.Second
+
+	response, err := client.Get(map[string]string{"action": "query"})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	response.Close()
+}
+
+func TestOAuthHandshake(t *testing.T) {
+
+	info := OAuthInformation{Consumer: ConsumerInformation{Key: "key", Secret: "secret"}}
+	client := NewOAuthNetworkClient(info, "http://localhost:8181")
+	consumer := &mockOAuthConsumer{}
+	client.consumer = consumer
+
+	request_token, err := client.GetRequestToken()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if request_token.Token != "requesttoken" {
+		t.Errorf("Got wrong request token: %v", request_token)
+	}
+	if consumer.callbackURL != "oob" {
+		t.Errorf("Expected out of band callback, got %s", consumer.callbackURL)
+	}
+
+	auth_url, err := url.Parse(client.AuthorizationURL(request_token))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if auth_url.Path != "/wiki/Special:OAuth/authorize" {
+		t.Errorf("Got wrong authorization URL: %v", auth_url)
+	}
+	if auth_url.Query().Get("oauth_token") != "requesttoken" || auth_url.Query().Get("oauth_consumer_key") != "key" {
+		t.Errorf("Got wrong authorization URL parameters: %v", auth_url)
+	}
+
+	access_token, err := client.GetAccessToken(request_token, "verifier")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if consumer.requestToken != request_token || consumer.verifier != "verifier" {
+		t.Errorf("Consumer was not passed the request token and verifier")
+	}
+	if access_token.Token != "accesstoken" || access_token.Secret != "accesssecret" {
+		t.Errorf("Got wrong access token: %v", access_token)
+	}
+	if client.AccessToken == nil || client.AccessToken.Token != "accesstoken" {
+		t.Errorf("Client access token was not updated: %v", client.AccessToken)
+	}
+}
+
+func TestOAuthHandshakeBadVerifier(t *testing.T) {
+
+	info := OAuthInformation{Consumer: ConsumerInformation{Key: "key", Secret: "secret"}}
+	client := NewOAuthNetworkClient(info, "http://localhost:8181")
+	client.consumer = &mockOAuthConsumer{}
+
+	request_token, err := client.GetRequestToken()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	_, err = client.GetAccessToken(request_token, "wrong")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.AccessToken != nil {
+		t.Errorf("Client access token should not be set: %v", client.AccessToken)
+	}
+}
+
+func TestSaveAndLoadOauthInformation(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "oauth.json")
+
+	info := OAuthInformation{
+		Consumer: ConsumerInformation{Key: "key", Secret: "secret"},
+		Access:   &AccessToken{Token: "accesstoken", Secret: "accesssecret"},
+	}
+
+	err := SaveOauthInformation(path, info)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if stat.Mode().Perm() != 0600 {
+		t.Errorf("File has wrong permissions: %v", stat.Mode())
+	}
+
+	loaded, err := LoadOauthInformation(path)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if loaded.Consumer != info.Consumer {
+		t.Errorf("Consumer did not round trip: %v", loaded.Consumer)
+	}
+	if loaded.Access == nil || *loaded.Access != *info.Access {
+		t.Errorf("Access token did not round trip: %v", loaded.Access)
+	}
+}
+
+func TestSaveOauthInformationTightensPermissions(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "oauth.json")
+
+	err := ioutil.WriteFile(path, []byte("{}"), 0644)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	err = SaveOauthInformation(path, OAuthInformation{Consumer: ConsumerInformation{Key: "key", Secret: "secret"}})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if stat.Mode().Perm() != 0600 {
+		t.Errorf("File has wrong permissions: %v", stat.Mode())
+	}
+}
+
+func TestDecompressResponse(t *testing.T) {
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write([]byte(`{"batchcomplete":"","query":{"tokens":{"csrftoken":"insertokenhere"}}}`))
+	writer.Close()
+
+	response := &http.Response{
+		Header: http.Header{"Content-Encoding": []string{"gzip"}},
+		Body:   ioutil.NopCloser(&buf),
+	}
+	err := decompressResponse(response)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	var token tokenRequestResponse
+	err = json.NewDecoder(response.Body).Decode(&token)
+	if err != nil {
+		t.Fatalf("Failed to decode decompressed body: %v", err)
+	}
+	if token.Query.Tokens.CSRFToken == nil || *token.Query.Tokens.CSRFToken != "insertokenhere" {
+		t.Errorf("Got wrong token: %v", token)
+	}
+	response.Body.Close()
+}
+
+func TestOAuthNetworkClientGzip(t *testing.T) {
+
+	var accept_encoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept_encoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "gzip")
+		writer := gzip.NewWriter(w)
+		writer.Write([]byte(`{"batchcomplete":"","query":{"tokens":{"csrftoken":"insertokenhere"}}}`))
+		writer.Close()
+	}))
+	defer server.Close()
+
+	info := OAuthInformation{Consumer: ConsumerInformation{Key: "key", Secret: "secret"}}
+	wikibase := NewClient(NewOAuthNetworkClient(info, server.URL))
+
+	token, err := wikibase.GetEditingToken()
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if token != "insertokenhere" {
+		t.Errorf("Got wrong token: %s", token)
+	}
+	if accept_encoding != "gzip" {
+		t.Errorf("Expected gzip to be requested, got %s", accept_encoding)
+	}
+}
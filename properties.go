@@ -18,9 +18,13 @@ import (
 	"encoding"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/url"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // If you're trying to encode structs to properties then you should use these types
@@ -36,10 +40,41 @@ type ItemClaim struct {
 }
 
 type QuantityClaim struct {
-	Amount string `json:"amount"`
-	Unit   string `json:"unit"`
+	Amount     string `json:"amount"`
+	Unit       string `json:"unit"`
+	UpperBound string `json:"upperBound,omitempty"`
+	LowerBound string `json:"lowerBound,omitempty"`
 }
 
+// Quantity can be used as a field type to upload quantity claims with a unit and measurement precision. Precision is
+// the uncertainty either side of the amount, so 9.81 with a precision of 0.01 is uploaded with bounds of 9.80 and
+// 9.82, and the amount and bounds are written to the number of decimal places the precision implies. A zero
+// precision means the amount is exact, and no bounds are sent. If Unit is not set the quantity has no unit.
+type Quantity struct {
+	Amount    float64
+	Precision float64
+	Unit      ItemPropertyType
+}
+
+// Precision values for TimeDataClaim as defined by Wikibase.
+const (
+	TimePrecisionMillennium = 6
+	TimePrecisionCentury    = 7
+	TimePrecisionDecade     = 8
+	TimePrecisionYear       = 9
+	TimePrecisionMonth      = 10
+	TimePrecisionDay        = 11
+	TimePrecisionHour       = 12
+	TimePrecisionMinute     = 13
+	TimePrecisionSecond     = 14
+)
+
+// The item IDs on Wikidata of the calendar models used for time claims.
+const (
+	GregorianCalendar ItemPropertyType = "Q1985727"
+	JulianCalendar    ItemPropertyType = "Q1985786"
+)
+
 type TimeDataClaim struct {
 	Time          string `json:"time"`
 	TimeZone      int    `json:"timezone"`
@@ -49,9 +84,53 @@ type TimeDataClaim struct {
 	CalendarModel string `json:"calendarmodel"`
 }
 
+// GlobeCoordinate can be used as a field type to upload globe-coordinate claims. Precision is in degrees. If Globe is
+// not set then the client's DefaultGlobe is used, or Earth if that is not set either.
+type GlobeCoordinate struct {
+	Latitude  float64
+	Longitude float64
+	Precision float64
+	Globe     ItemPropertyType
+}
+
+// MonolingualText can be used as a field type to upload monolingualtext claims. If Language is not set then the
+// client's language is used. Whitespace in the text is tidied as for strings, unless the property tag has a "raw"
+// clause, which keeps the whitespace as is for text such as poetry or addresses where line breaks matter.
+type MonolingualText struct {
+	Text     string
+	Language string
+}
+
+type MonolingualTextClaim struct {
+	Text     string `json:"text"`
+	Language string `json:"language"`
+}
+
+// HistoricalTime can be used as a field type to upload time claims that time.Time can't represent, such as dates BCE.
+// Year is signed, with 44 BCE being -44, and there is no year zero. Month and Day are zero if not known. If Precision
+// is zero it is taken from the most precise part given, and if Calendar is not set the Gregorian calendar is used.
+type HistoricalTime struct {
+	Year      int64
+	Month     int
+	Day       int
+	Precision int
+	Calendar  ItemPropertyType
+}
+
+// EarthGlobe is the item ID of Earth on Wikidata, and is the globe used for coordinates if no other is specified.
+const EarthGlobe ItemPropertyType = "Q2"
+
+type GlobeCoordinateClaim struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Precision float64 `json:"precision"`
+	Globe     string  `json:"globe"`
+}
+
 type propertyCreate struct {
-	Labels   map[string]itemLabel `json:"labels"`
-	DataType string               `json:"datatype"`
+	Labels       map[string]itemLabel `json:"labels"`
+	Descriptions map[string]itemLabel `json:"descriptions,omitempty"`
+	DataType     string               `json:"datatype"`
 }
 
 // Loading item and property labels from structs
@@ -60,36 +139,70 @@ type propertyCreate struct {
 // populate the Wikibase client structs internal map of labels to Item IDs. The client will use this when performing
 // ORM like operations on structures to upload to Wikibase.
 func (c *Client) MapItemConfigurationByLabel(label string, create_if_not_there bool) error {
+	_, _, err := c.mapItemByLabel(label, create_if_not_there)
+	return err
+}
+
+// EnsureItem returns the ID of the item with the exact matching label on Wikibase, creating a new item with that
+// label if one does not exist already. The ID is also stored in the client's item map.
+func (c *Client) EnsureItem(label string) (ItemPropertyType, error) {
+	id, _, err := c.mapItemByLabel(label, true)
+	return id, err
+}
+
+// EnsureItemWithStatus is like EnsureItem, but also reports whether the item was newly created by this call rather
+// than matched to an existing item, which is useful for keeping an audit log of what a run created.
+func (c *Client) EnsureItemWithStatus(label string) (ItemPropertyType, bool, error) {
+	return c.mapItemByLabel(label, true)
+}
+
+func (c *Client) mapItemByLabel(label string, create_if_not_there bool) (ItemPropertyType, bool, error) {
 	labels, err := c.FetchItemIDsForLabel(label)
 	if err != nil {
-		return err
+		return "", false, err
 	}
+	created := false
 	switch len(labels) {
 	case 0:
 		if !create_if_not_there {
-			return fmt.Errorf("No item ID was found for %s", label)
+			return "", false, fmt.Errorf("No item ID was found for %s", label)
 		} else {
 			create_struct := struct {
 				ItemHeader
 			}{}
 			err := c.CreateItemInstance(label, &create_struct)
 			if err != nil {
-				return err
+				return "", false, err
 			}
 			c.ItemMap[label] = create_struct.ID
+			created = true
 		}
 	case 1:
 		c.ItemMap[label] = ItemPropertyType(labels[0])
 	default:
-		return fmt.Errorf("Multiple item IDs found for %s: %v", labels, labels)
+		return "", false, fmt.Errorf("Multiple item IDs found for %s: %v", label, labels)
 	}
-	return nil
+	return c.ItemMap[label], created, nil
 }
 
 // MapPropertyAndItemConfiguration will take a pointer to a Go structure that has the embedded wikibase header and
 // item and property tags on its fields and create a map that goes from the labels in the tags to the Item and Property
-// IDs used by Wikibase.
+// IDs used by Wikibase. Labels already in the client's maps, such as those shared with a struct mapped earlier, are
+// not looked up again.
 func (c *Client) MapPropertyAndItemConfiguration(i interface{}, create_if_not_there bool) error {
+	return c.mapConfiguration(i, create_if_not_there, false)
+}
+
+// MapAllPropertyAndItemConfiguration is like MapPropertyAndItemConfiguration, but rather than stopping at the first
+// label that fails to map, it attempts every label and returns a MappingErrors with all the failures. The labels that
+// were mapped are still stored in the client's maps, so calling this again will only retry the failed ones.
+func (c *Client) MapAllPropertyAndItemConfiguration(i interface{}, create_if_not_there bool) error {
+	return c.mapConfiguration(i, create_if_not_there, true)
+}
+
+func (c *Client) mapConfiguration(i interface{}, create_if_not_there bool, keep_going bool) error {
+
+	failures := make(map[string]error)
 
 	t := reflect.TypeOf(i)
 	for i := 0; i < t.NumField(); i++ {
@@ -100,84 +213,392 @@ func (c *Client) MapPropertyAndItemConfiguration(i interface{}, create_if_not_th
 			parts := strings.Split(tag, ",")
 			tag = parts[0]
 
-			labels, err := c.FetchPropertyIDsForLabel(tag)
-			if err != nil {
-				return err
-			}
-			switch len(labels) {
-			case 0:
-				if !create_if_not_there {
-					return fmt.Errorf("No property ID was found for %s", tag)
-				} else {
-					// attempt to create the property
-					id, err := c.createPropertyWithLabel(tag, f)
-					if err != nil {
+			if _, ok := c.PropertyMap[tag]; !ok {
+				err := c.mapPropertyByTag(tag, f, create_if_not_there)
+				if err != nil {
+					if !keep_going {
 						return err
 					}
-					c.PropertyMap[tag] = id
+					failures[tag] = err
 				}
-			case 1:
-				c.PropertyMap[tag] = labels[0]
-			default:
-				return fmt.Errorf("Multiple property IDs found for %s: %v", tag, labels)
 			}
 		}
 
 		tag = f.Tag.Get("item")
-		if len(tag) > 0 {
+		if _, ok := c.ItemMap[tag]; len(tag) > 0 && !ok {
 			err := c.MapItemConfigurationByLabel(tag, create_if_not_there)
 			if err != nil {
-				return err
+				if !keep_going {
+					return err
+				}
+				failures[tag] = err
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return &MappingErrors{Errors: failures}
+	}
+	return nil
+}
+
+// ValidatePropertyMap checks that every property tag on the struct has an entry in the client's property map,
+// without making any network requests, so that missing mappings are found before starting an upload rather than
+// part way through. If any are missing an UnmappedPropertiesError listing their labels is returned. The struct can
+// be passed by value or by pointer.
+func (c *Client) ValidatePropertyMap(i interface{}) error {
+
+	t := reflect.TypeOf(i)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("Expected a struct or pointer to a struct, not %v", t)
+	}
+
+	unmapped := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("property")
+		if len(tag) == 0 {
+			continue
+		}
+		label := strings.Split(tag, ",")[0]
+		if _, ok := c.PropertyMap[label]; !ok {
+			unmapped = append(unmapped, label)
+		}
+	}
+
+	if len(unmapped) > 0 {
+		return &UnmappedPropertiesError{Labels: unmapped}
+	}
+	return nil
+}
+
+// ValidateStruct checks that the tags on a struct are coherent, without needing a client or making any network
+// requests, so that data models can be checked cheaply in unit tests. It checks that every property field has a Go
+// type that can be uploaded, that tag labels and options are valid, that fields sharing a property label agree on its
+// datatype, and that alias, label, and item tags are well formed. All the problems found are reported in the error.
+func ValidateStruct(i interface{}) error {
+
+	t := reflect.TypeOf(i)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("Expected a struct or pointer to a struct, not %v", t)
+	}
+
+	problems := make([]string, 0)
+	datatypes := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if tag, ok := f.Tag.Lookup("property"); ok {
+			problems = append(problems, validatePropertyTag(f, tag, datatypes)...)
+		}
+
+		if _, ok := f.Tag.Lookup("alias"); ok && f.Type != reflect.TypeOf([]string{}) {
+			problems = append(problems, fmt.Sprintf("alias field %s must be a []string, not %v", f.Name, f.Type))
+		}
+
+		if _, ok := f.Tag.Lookup("label"); ok && f.Type.Kind() != reflect.String {
+			problems = append(problems, fmt.Sprintf("label field %s must be a string, not %v", f.Name, f.Type))
+		}
+
+		if label, ok := f.Tag.Lookup("item"); ok && len(strings.TrimSpace(label)) == 0 {
+			problems = append(problems, fmt.Sprintf("item tag on field %s has no label", f.Name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Struct %v has invalid tags: %s", t, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validatePropertyTag returns the problems with the property tag on a field. Datatypes records the datatype of each
+// label seen so far, to check fields sharing a label agree.
+func validatePropertyTag(f reflect.StructField, tag string, datatypes map[string]string) []string {
+
+	problems := make([]string, 0)
+
+	parts := strings.Split(tag, ",")
+	label := parts[0]
+	for _, candidate := range strings.Split(label, "|") {
+		if len(candidate) == 0 || strings.TrimSpace(candidate) != candidate {
+			problems = append(problems, fmt.Sprintf("property tag on field %s has an empty or padded label %q",
+				f.Name, label))
+			break
+		}
+	}
+
+	datatype, err := goTypeToWikibaseType(f)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("field %s: %v", f.Name, err))
+	} else if len(label) > 0 {
+		if existing, ok := datatypes[label]; ok && existing != datatype {
+			problems = append(problems, fmt.Sprintf("field %s is %s but another field for property %s is %s",
+				f.Name, datatype, label, existing))
+		} else {
+			datatypes[label] = datatype
+		}
+	}
+
+	precisions := 0
+	for _, option := range parts[1:] {
+		switch {
+		case option == "omitoncreate" || option == "novalue" || option == "append":
+		case option == "inferprecision" || option == "precision=year" || option == "precision=month" ||
+			option == "precision=day":
+			precisions += 1
+			if strings.TrimPrefix(fmt.Sprintf("%v", f.Type), "*") != "time.Time" {
+				problems = append(problems, fmt.Sprintf("field %s has time option %s but is not a time.Time",
+					f.Name, option))
+			}
+		case option == "raw":
+			if datatype != "monolingualtext" {
+				problems = append(problems, fmt.Sprintf("field %s has raw option but is not monolingual text", f.Name))
 			}
+		case strings.HasPrefix(option, "desc="):
+		case strings.HasPrefix(option, "label="):
+			if len(strings.TrimSpace(strings.TrimPrefix(option, "label="))) == 0 {
+				problems = append(problems, fmt.Sprintf("field %s has an empty label option", f.Name))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("field %s has unknown property tag option %q", f.Name, option))
 		}
 	}
+	if precisions > 1 {
+		problems = append(problems, fmt.Sprintf("field %s has more than one precision option", f.Name))
+	}
+
+	return problems
+}
+
+// mapPropertyByTag finds the property ID for the label in a property tag and stores it in the property map. The tag
+// may list several labels separated by "|", in which case each is tried in turn and the first one found on the
+// server is used. If none are found and create_if_not_there is set, the property is created with the first label.
+func (c *Client) mapPropertyByTag(tag string, f reflect.StructField, create_if_not_there bool) error {
+
+	candidates := strings.Split(tag, "|")
+	override := propertyLabelOverrideForField(f)
+	if len(override) > 0 {
+		// Look for the label the property would have been created with first, so it is found again on later runs
+		candidates = append([]string{override}, candidates...)
+	}
+	for _, label := range candidates {
+		labels, err := c.FetchPropertyIDsForLabel(label)
+		if err != nil {
+			return err
+		}
+		switch len(labels) {
+		case 0:
+			continue
+		case 1:
+			c.PropertyMap[tag] = labels[0]
+			c.PropertyMap[label] = labels[0]
+			c.ResolvedPropertyLabels[tag] = label
+			return nil
+		default:
+			return fmt.Errorf("Multiple property IDs found for %s: %v", label, labels)
+		}
+	}
+
+	if !create_if_not_there {
+		return fmt.Errorf("No property ID was found for %s", tag)
+	}
 
+	// attempt to create the property
+	label := candidates[0]
+	id, err := c.createPropertyWithLabel(label, f)
+	if err != nil {
+		return err
+	}
+	c.PropertyMap[tag] = id
+	c.PropertyMap[label] = id
+	c.ResolvedPropertyLabels[tag] = label
 	return nil
 }
 
 // Conversation functions
 
 func StringClaimToAPIData(value string) (*string, error) {
-	// wikibase does not accept zero length strings, so treat them as no value
-	if len(value) == 0 {
-		return nil, nil
-	}
 	// wikibase does not like complex whitespace in strings, nor anything with
 	// leading/training spaces, so do some tidying
 	value = strings.Join(strings.Fields(value), " ")
+	// wikibase does not accept zero length strings, so treat them as no value,
+	// including strings that were only whitespace before tidying
+	if len(value) == 0 {
+		return nil, nil
+	}
 	return &value, nil
 }
 
+// RegisterValueNormalizer sets a function that is applied to string values for the property with the given label
+// before they are encoded for Wikibase, for example to canonicalise identifiers. The label is as used in struct tags,
+// and for tags with fallback labels either the whole tag or the label found on the server can be used. Registering
+// nil removes any normalizer for the property. Values are still tidied of whitespace after normalization.
+func (c *Client) RegisterValueNormalizer(property_label string, fn func(string) string) {
+	c.valueNormalizersLock.Lock()
+	defer c.valueNormalizersLock.Unlock()
+
+	if fn == nil {
+		delete(c.valueNormalizers, property_label)
+		return
+	}
+	if c.valueNormalizers == nil {
+		c.valueNormalizers = make(map[string]func(string) string)
+	}
+	c.valueNormalizers[property_label] = fn
+}
+
+// normalizeStringValue applies any normalizer registered for the property label to the value.
+func (c *Client) normalizeStringValue(property_label string, value string) string {
+	c.valueNormalizersLock.RLock()
+	fn, ok := c.valueNormalizers[property_label]
+	if !ok {
+		fn, ok = c.valueNormalizers[c.ResolvedPropertyLabels[property_label]]
+	}
+	c.valueNormalizersLock.RUnlock()
+
+	if !ok {
+		return value
+	}
+	return fn(value)
+}
+
+// propertyLabelForField returns the property label from the field's tag, or the field name for fields made up to
+// encode a value for a property by label, which have no tag.
+func propertyLabelForField(f reflect.StructField) string {
+	tag, ok := f.Tag.Lookup("property")
+	if !ok {
+		return f.Name
+	}
+	return strings.Split(tag, ",")[0]
+}
+
+// DefaultEntityTypePrefixes maps the prefixes used on entity IDs to their entity type, as used on Wikidata and
+// default Wikibase installs. Instances that use other prefixes can set their own mapping on the client.
+var DefaultEntityTypePrefixes = map[string]string{
+	"Q": "item",
+	"P": "property",
+	"L": "lexeme",
+}
+
+// DefaultConceptBaseURI is the start of the URIs Wikidata uses for its entities, which are used in values such as the
+// units of quantities.
+const DefaultConceptBaseURI = "http://www.wikidata.org/entity/"
+
+// conceptBaseURI returns the start of the URIs the client's wiki uses for its entities.
+func (c *Client) conceptBaseURI() string {
+	if len(c.ConceptBaseURI) > 0 {
+		return c.ConceptBaseURI
+	}
+	return DefaultConceptBaseURI
+}
+
+// DefaultEntityNamespaces maps entity types to the namespace their pages are in, as on default Wikibase installs.
+// Wikidata keeps items in the main namespace, which can be configured on the client with an empty namespace.
+var DefaultEntityNamespaces = map[string]string{
+	"item":     "Item",
+	"property": "Property",
+	"lexeme":   "Lexeme",
+}
+
+// ItemClaimToAPIData encodes an entity reference for the API, setting the entity-type based on the prefix of the ID:
+// Q numbers are items, P numbers are properties, and L numbers are lexemes.
 func ItemClaimToAPIData(value ItemPropertyType) (ItemClaim, error) {
+	return entityClaimToAPIData(value, DefaultEntityTypePrefixes)
+}
+
+// entityClaimToAPIData encodes an entity reference using the provided mapping of ID prefix to entity type. If more
+// than one prefix matches the ID then the longest is used.
+func entityClaimToAPIData(value ItemPropertyType, prefixes map[string]string) (ItemClaim, error) {
 
 	if len(value) == 0 {
-		return ItemClaim{}, fmt.Errorf("We expected an item ID, but got an empty string")
+		return ItemClaim{}, fmt.Errorf("We expected an entity ID, but got an empty string")
 	}
 
-	runes := []rune(value)
-	if runes[0] != 'Q' {
-		return ItemClaim{}, fmt.Errorf("We expected a Q number not %s (starts with %v)", value, runes[0])
+	prefix := ""
+	for p := range prefixes {
+		if len(p) > len(prefix) && strings.HasPrefix(string(value), p) {
+			prefix = p
+		}
+	}
+	if len(prefix) == 0 {
+		return ItemClaim{}, fmt.Errorf("We expected an entity ID with a known prefix not %s", value)
 	}
 
-	parts := strings.Split(string(value), "Q")
-	if len(parts) != 2 {
-		return ItemClaim{}, fmt.Errorf("We expected a Q number not %s (splits as %v)", value, parts)
+	number := string(value)[len(prefix):]
+	if len(number) == 0 {
+		return ItemClaim{}, fmt.Errorf("Entity ID %s has no number after the %s prefix", value, prefix)
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return ItemClaim{}, fmt.Errorf("Entity ID %s must be %s followed only by digits", value, prefix)
+		}
+	}
+	if number[0] == '0' {
+		return ItemClaim{}, fmt.Errorf("Entity ID %s must not have a leading zero", value)
 	}
 
-	id, err := strconv.Atoi(parts[1])
+	id, err := strconv.Atoi(number)
 	if err != nil {
-		return ItemClaim{}, err
+		return ItemClaim{}, fmt.Errorf("Entity ID %s is not valid: %v", value, err)
 	}
 
-	item := ItemClaim{EntityType: "item", NumericID: id}
+	item := ItemClaim{EntityType: prefixes[prefix], NumericID: id}
 
 	return item, nil
 }
 
+// entityClaimToAPIData encodes an entity reference using the prefixes configured on the client.
+func (c *Client) entityClaimToAPIData(value ItemPropertyType) (ItemClaim, error) {
+	prefixes := c.EntityTypePrefixes
+	if prefixes == nil {
+		prefixes = DefaultEntityTypePrefixes
+	}
+	return entityClaimToAPIData(value, prefixes)
+}
+
 func QuantityClaimToAPIData(value int) (QuantityClaim, error) {
 
+	amount := strconv.Itoa(value)
+	if value >= 0 {
+		amount = "+" + amount
+	}
+	quantity := QuantityClaim{
+		Amount: amount,
+		Unit:   "1",
+	}
+
+	return quantity, nil
+}
+
+// QuantityFloatClaimToAPIData encodes a float as a quantity with no unit, writing the amount as a signed decimal with
+// as many digits as are needed to round trip the value, and never in scientific notation.
+func QuantityFloatClaimToAPIData(value float64) (QuantityClaim, error) {
+	return quantityFloatClaimToAPIData(value, 64)
+}
+
+// quantityFloatClaimToAPIData encodes a float that was bit_size bits originally, so that float32 values are not
+// written with the extra digits they gain from being widened to float64.
+func quantityFloatClaimToAPIData(value float64, bit_size int) (QuantityClaim, error) {
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return QuantityClaim{}, fmt.Errorf("Quantity amount %v is not a number", value)
+	}
+	if value == 0 {
+		// Avoid writing negative zero as "-0"
+		value = 0
+	}
+
+	amount := strconv.FormatFloat(value, 'f', -1, bit_size)
+	if !strings.HasPrefix(amount, "-") {
+		amount = "+" + amount
+	}
 	quantity := QuantityClaim{
-		Amount: strconv.Itoa(value),
+		Amount: amount,
 		Unit:   "1",
 	}
 
@@ -188,27 +609,393 @@ func TimeDataClaimToAPIData(value string) (TimeDataClaim, error) {
 
 	time_data := TimeDataClaim{
 		Time:          fmt.Sprintf("+0000000%s", value),
-		Precision:     11,
+		Precision:     TimePrecisionDay,
 		CalendarModel: "http://www.wikidata.org/entity/Q1985727",
 	}
 
 	return time_data, nil
 }
 
+var fullTimeRegexp = regexp.MustCompile(`^([+-]?)([0-9]+)(?:-([0-9]{2})(?:-([0-9]{2})(?:T([0-9]{2}):([0-9]{2}):([0-9]{2})Z?)?)?)?$`)
+
+// FullTimeClaimToAPIData encodes a time given as an ISO 8601 style string with the precision and calendar model
+// stated explicitly rather than inferred. The time can be just a year, such as "1066", a year and month, a date, or a
+// full "+1066-10-14T00:00:00Z" style timestamp, and years can be signed for dates BCE. Parts that are not given are
+// sent as zero, as Wikibase does for imprecise times, but the time must include all the parts the precision needs. If
+// calendar is empty then the Gregorian calendar is used. The time is not converted between calendars.
+func FullTimeClaimToAPIData(iso8601 string, precision int, calendar ItemPropertyType) (TimeDataClaim, error) {
+	return fullTimeClaimToAPIData(iso8601, precision, calendar, DefaultEntityTypePrefixes)
+}
+
+// fullTimeClaimToAPIData encodes a time as for FullTimeClaimToAPIData, checking the calendar is an item using the
+// provided mapping of ID prefix to entity type.
+func fullTimeClaimToAPIData(iso8601 string, precision int, calendar ItemPropertyType,
+	prefixes map[string]string) (TimeDataClaim, error) {
+
+	if precision < 0 || precision > TimePrecisionSecond {
+		return TimeDataClaim{}, fmt.Errorf("Time precision %d is not valid", precision)
+	}
+
+	parts := fullTimeRegexp.FindStringSubmatch(iso8601)
+	if parts == nil {
+		return TimeDataClaim{}, fmt.Errorf("Time %s is not a valid ISO 8601 time", iso8601)
+	}
+
+	sign := parts[1]
+	if len(sign) == 0 {
+		sign = "+"
+	}
+	year := strings.TrimLeft(parts[2], "0")
+	if len(year) == 0 {
+		return TimeDataClaim{}, fmt.Errorf("Time %s has no year zero in Wikibase", iso8601)
+	}
+	if len(year) > 11 {
+		return TimeDataClaim{}, fmt.Errorf("Time %s has a year out of range", iso8601)
+	}
+
+	// work out how precise the time given is, and fill in the missing parts with zeros
+	given := TimePrecisionYear
+	fields := []string{parts[3], parts[4], parts[5], parts[6], parts[7]}
+	for index, field := range fields {
+		if len(field) == 0 {
+			fields[index] = "00"
+		} else {
+			given = TimePrecisionMonth + index
+		}
+	}
+	if given == TimePrecisionHour {
+		// hours, minutes, and seconds are all given together
+		given = TimePrecisionSecond
+	}
+	if precision > given {
+		return TimeDataClaim{}, fmt.Errorf("Time %s is not precise enough for precision %d", iso8601, precision)
+	}
+	month, day := fields[0], fields[1]
+	if month > "12" || fields[2] > "23" || fields[3] > "59" || fields[4] > "59" {
+		return TimeDataClaim{}, fmt.Errorf("Time %s is not a valid ISO 8601 time", iso8601)
+	}
+
+	if len(calendar) == 0 {
+		calendar = GregorianCalendar
+	}
+	claim, err := entityClaimToAPIData(calendar, prefixes)
+	if err != nil {
+		return TimeDataClaim{}, err
+	}
+	if claim.EntityType != "item" {
+		return TimeDataClaim{}, fmt.Errorf("Calendar must be an item, not %s", calendar)
+	}
+
+	// The day must be in the month, allowing for leap years in the calendar
+	if day != "00" {
+		month_number, _ := strconv.Atoi(month)
+		day_number, _ := strconv.Atoi(day)
+		year_number, _ := strconv.ParseInt(year, 10, 64)
+		if sign == "-" {
+			// there is no year zero, so 1 BCE is a leap year like 4 CE
+			year_number = 1 - year_number
+		}
+		if month_number == 0 || day_number > daysInMonth(year_number, month_number, calendar == JulianCalendar) {
+			return TimeDataClaim{}, fmt.Errorf("Time %s is not a valid date", iso8601)
+		}
+	}
+
+	time_data := TimeDataClaim{
+		Time:          fmt.Sprintf("%s%011s-%s-%sT%s:%s:%sZ", sign, year, month, day, fields[2], fields[3], fields[4]),
+		Precision:     precision,
+		CalendarModel: fmt.Sprintf("http://www.wikidata.org/entity/%s", calendar),
+	}
+
+	return time_data, nil
+}
+
+// fullTimeClaimToAPIData encodes a time as for FullTimeClaimToAPIData using the prefixes configured on the client.
+func (c *Client) fullTimeClaimToAPIData(iso8601 string, precision int,
+	calendar ItemPropertyType) (TimeDataClaim, error) {
+	prefixes := c.EntityTypePrefixes
+	if prefixes == nil {
+		prefixes = DefaultEntityTypePrefixes
+	}
+	return fullTimeClaimToAPIData(iso8601, precision, calendar, prefixes)
+}
+
+// daysInMonth returns the number of days in the month of the year in the Julian or Gregorian calendar, with years
+// numbered astronomically, so that 1 BCE is year zero.
+func daysInMonth(year int64, month int, julian bool) int {
+	switch month {
+	case 2:
+		if year%4 != 0 || (!julian && year%100 == 0 && year%400 != 0) {
+			return 28
+		}
+		return 29
+	case 4, 6, 9, 11:
+		return 30
+	default:
+		return 31
+	}
+}
+
+// MonolingualTextClaimToAPIData encodes monolingual text, which must have a language. Unless raw is set the
+// whitespace in the text is tidied as StringClaimToAPIData does. Text that is empty or only whitespace is treated
+// as no value, and nil is returned.
+func MonolingualTextClaimToAPIData(value MonolingualText, raw bool) (*MonolingualTextClaim, error) {
+
+	if len(value.Language) == 0 {
+		return nil, fmt.Errorf("Monolingual text must have a language")
+	}
+
+	text := value.Text
+	if !raw {
+		text = strings.Join(strings.Fields(text), " ")
+	}
+	if len(strings.TrimSpace(text)) == 0 {
+		return nil, nil
+	}
+
+	return &MonolingualTextClaim{Text: text, Language: value.Language}, nil
+}
+
+// monolingualTextClaimToAPIData encodes monolingual text for a field, using the client's language if the value has
+// none.
+func (c *Client) monolingualTextClaimToAPIData(f reflect.StructField, value MonolingualText) (
+	*MonolingualTextClaim, error) {
+	if len(value.Language) == 0 {
+		value.Language = c.labelLanguage(WikiBaseItem)
+	}
+	return MonolingualTextClaimToAPIData(value, isRawTextField(f))
+}
+
+// isRawTextField returns true if the field's property tag has the "raw" clause.
+func isRawTextField(f reflect.StructField) bool {
+	return hasPropertyTagOption(f, "raw")
+}
+
+// hasPropertyTagOption returns true if the field's property tag has the given clause after the label.
+func hasPropertyTagOption(f reflect.StructField, option string) bool {
+	value, ok := propertyTagOptionValue(f, option)
+	return ok && len(value) == 0
+}
+
+// propertyTagOptionValue returns the rest of the first clause after the label in the field's property tag that
+// starts with prefix, such as the description in "desc=...", and false if there is no such clause.
+func propertyTagOptionValue(f reflect.StructField, prefix string) (string, bool) {
+	parts := strings.Split(f.Tag.Get("property"), ",")
+	for _, part := range parts[1:] {
+		if strings.HasPrefix(part, prefix) {
+			return strings.TrimPrefix(part, prefix), true
+		}
+	}
+	return "", false
+}
+
+// formatQuantityAmount formats an amount with a sign, as Wikibase expects, to the given number of decimal places, or
+// as few as are needed if decimals is negative.
+func formatQuantityAmount(amount float64, decimals int) string {
+	formatted := strconv.FormatFloat(amount, 'f', decimals, 64)
+	if !strings.HasPrefix(formatted, "-") {
+		formatted = "+" + formatted
+	}
+	return formatted
+}
+
+// QuantityWithPrecisionClaimToAPIData encodes a quantity with bounds set from its precision. The unit is given as a
+// Wikidata entity URI.
+func QuantityWithPrecisionClaimToAPIData(value Quantity) (QuantityClaim, error) {
+	return quantityWithPrecisionClaimToAPIData(value, DefaultConceptBaseURI)
+}
+
+// quantityWithPrecisionClaimToAPIData encodes a quantity as for QuantityWithPrecisionClaimToAPIData, with the unit as
+// a URI starting with concept_base.
+func quantityWithPrecisionClaimToAPIData(value Quantity, concept_base string) (QuantityClaim, error) {
+
+	if math.IsNaN(value.Amount) || math.IsInf(value.Amount, 0) {
+		return QuantityClaim{}, fmt.Errorf("Quantity amount %v is not a number", value.Amount)
+	}
+	if value.Precision < 0 || math.IsNaN(value.Precision) || math.IsInf(value.Precision, 0) {
+		return QuantityClaim{}, fmt.Errorf("Quantity precision %v must be a positive number", value.Precision)
+	}
+
+	unit := "1"
+	if len(value.Unit) > 0 {
+		unit = concept_base + string(value.Unit)
+	}
+
+	if value.Precision == 0 {
+		return QuantityClaim{Amount: formatQuantityAmount(value.Amount, -1), Unit: unit}, nil
+	}
+
+	// Enough decimal places to show the precision, allowing for a little floating point error in the log
+	decimals := int(math.Ceil(-math.Log10(value.Precision) - 1e-9))
+	if decimals < 0 {
+		decimals = 0
+	}
+
+	quantity := QuantityClaim{
+		Amount:     formatQuantityAmount(value.Amount, decimals),
+		Unit:       unit,
+		UpperBound: formatQuantityAmount(value.Amount+value.Precision, decimals),
+		LowerBound: formatQuantityAmount(value.Amount-value.Precision, decimals),
+	}
+
+	return quantity, nil
+}
+
+// quantityWithPrecisionClaimToAPIData encodes a quantity as for QuantityWithPrecisionClaimToAPIData, with the unit
+// as a URI starting with the client's concept base URI.
+func (c *Client) quantityWithPrecisionClaimToAPIData(value Quantity) (QuantityClaim, error) {
+	return quantityWithPrecisionClaimToAPIData(value, c.conceptBaseURI())
+}
+
+// booleanItem returns the item configured on the client for the bool value.
+func (c *Client) booleanItem(value bool) (ItemPropertyType, error) {
+	item := c.BooleanFalseItem
+	if value {
+		item = c.BooleanTrueItem
+	}
+	if len(item) == 0 {
+		return "", fmt.Errorf("No item configured for bool value %v, set BooleanTrueItem and BooleanFalseItem", value)
+	}
+	return item, nil
+}
+
+// HistoricalTimeClaimToAPIData encodes a time with a signed year, emitting "-00000000044-03-15T00:00:00Z" style
+// timestamps for dates BCE.
+func HistoricalTimeClaimToAPIData(value HistoricalTime) (TimeDataClaim, error) {
+	return historicalTimeClaimToAPIData(value, DefaultEntityTypePrefixes)
+}
+
+// historicalTimeClaimToAPIData encodes a time as for HistoricalTimeClaimToAPIData, checking the calendar is an item
+// using the provided mapping of ID prefix to entity type.
+func historicalTimeClaimToAPIData(value HistoricalTime, prefixes map[string]string) (TimeDataClaim, error) {
+
+	if value.Year == 0 {
+		return TimeDataClaim{}, fmt.Errorf("There is no year zero in Wikibase")
+	}
+	if value.Month < 0 || value.Month > 12 || value.Day < 0 || value.Day > 31 {
+		return TimeDataClaim{}, fmt.Errorf("Time %d-%d-%d is not a valid date", value.Year, value.Month, value.Day)
+	}
+	if value.Day > 0 && value.Month == 0 {
+		return TimeDataClaim{}, fmt.Errorf("Time %d-%d-%d has a day but no month", value.Year, value.Month, value.Day)
+	}
+
+	precision := value.Precision
+	if precision == 0 {
+		precision = TimePrecisionYear
+		if value.Day > 0 {
+			precision = TimePrecisionDay
+		} else if value.Month > 0 {
+			precision = TimePrecisionMonth
+		}
+	}
+
+	sign := "+"
+	year := value.Year
+	if year < 0 {
+		sign = "-"
+		year = -year
+	}
+	iso8601 := fmt.Sprintf("%s%d-%02d-%02d", sign, year, value.Month, value.Day)
+
+	return fullTimeClaimToAPIData(iso8601, precision, value.Calendar, prefixes)
+}
+
+// historicalTimeClaimToAPIData encodes a time as for HistoricalTimeClaimToAPIData using the prefixes configured on
+// the client.
+func (c *Client) historicalTimeClaimToAPIData(value HistoricalTime) (TimeDataClaim, error) {
+	prefixes := c.EntityTypePrefixes
+	if prefixes == nil {
+		prefixes = DefaultEntityTypePrefixes
+	}
+	return historicalTimeClaimToAPIData(value, prefixes)
+}
+
+// URLClaimToAPIData encodes a URL for a url property, which must be absolute.
+func URLClaimToAPIData(value url.URL) (string, error) {
+	if !value.IsAbs() {
+		return "", fmt.Errorf("URL claims must be absolute, not %s", value.String())
+	}
+	return value.String(), nil
+}
+
+// GlobeCoordinateClaimToAPIData encodes a coordinate, with the globe given as a Wikidata entity URI.
+func GlobeCoordinateClaimToAPIData(value GlobeCoordinate) (GlobeCoordinateClaim, error) {
+	return globeCoordinateClaimToAPIData(value, DefaultEntityTypePrefixes, DefaultConceptBaseURI)
+}
+
+// globeCoordinateClaimToAPIData encodes a coordinate as for GlobeCoordinateClaimToAPIData, checking the globe is an
+// item using the provided mapping of ID prefix to entity type, and giving it as a URI starting with concept_base. If
+// no globe is given then Earth is used, with the Wikidata URI that Wikibase uses for Earth on every wiki.
+func globeCoordinateClaimToAPIData(value GlobeCoordinate, prefixes map[string]string,
+	concept_base string) (GlobeCoordinateClaim, error) {
+
+	if value.Latitude < -90.0 || value.Latitude > 90.0 {
+		return GlobeCoordinateClaim{}, fmt.Errorf("Latitude %f is out of range", value.Latitude)
+	}
+	if value.Longitude < -360.0 || value.Longitude > 360.0 {
+		return GlobeCoordinateClaim{}, fmt.Errorf("Longitude %f is out of range", value.Longitude)
+	}
+
+	globe := value.Globe
+	if len(globe) == 0 {
+		globe = EarthGlobe
+		prefixes = DefaultEntityTypePrefixes
+		concept_base = DefaultConceptBaseURI
+	}
+	claim, err := entityClaimToAPIData(globe, prefixes)
+	if err != nil {
+		return GlobeCoordinateClaim{}, err
+	}
+	if claim.EntityType != "item" {
+		return GlobeCoordinateClaim{}, fmt.Errorf("Globe must be an item, not %s", globe)
+	}
+
+	coordinate := GlobeCoordinateClaim{
+		Latitude:  value.Latitude,
+		Longitude: value.Longitude,
+		Precision: value.Precision,
+		Globe:     concept_base + string(globe),
+	}
+
+	return coordinate, nil
+}
+
+// globeCoordinateClaimToAPIData encodes the coordinate, using the client's DefaultGlobe if the coordinate doesn't
+// specify one, and its entity prefixes and concept base URI for the globe.
+func (c *Client) globeCoordinateClaimToAPIData(value GlobeCoordinate) (GlobeCoordinateClaim, error) {
+	if len(value.Globe) == 0 && len(c.DefaultGlobe) > 0 {
+		value.Globe = c.DefaultGlobe
+	}
+	prefixes := c.EntityTypePrefixes
+	if prefixes == nil {
+		prefixes = DefaultEntityTypePrefixes
+	}
+	return globeCoordinateClaimToAPIData(value, prefixes, c.conceptBaseURI())
+}
+
 // Upload properties for structs
 
 func (c *Client) CreateClaimOnItem(item ItemPropertyType, property_id string, encoded_data []byte) (string, error) {
+	claim, err := c.CreateClaimOnItemWithResult(item, property_id, encoded_data)
+	if err != nil {
+		return "", err
+	}
+	return claim.ID, nil
+}
+
+// CreateClaimOnItemWithResult is like CreateClaimOnItem, but returns the claim as created by the server rather than
+// just its ID, which includes the hash and datatype of the main snak needed for some later edits.
+func (c *Client) CreateClaimOnItemWithResult(item ItemPropertyType, property_id string, encoded_data []byte) (*Claim, error) {
 
 	if len(item) == 0 {
-		return "", fmt.Errorf("Item ID must not be an empty string.")
+		return nil, fmt.Errorf("Item ID must not be an empty string.")
 	}
 	if len(property_id) == 0 {
-		return "", fmt.Errorf("Property ID must not be an empty string.")
+		return nil, fmt.Errorf("Property ID must not be an empty string.")
 	}
 
 	editToken, terr := c.GetEditingToken()
 	if terr != nil {
-		return "", terr
+		return nil, terr
 	}
 
 	args := map[string]string{
@@ -225,30 +1012,231 @@ func (c *Client) CreateClaimOnItem(item ItemPropertyType, property_id string, en
 		args["value"] = string(encoded_data)
 	}
 
-	response, err := c.client.Post(args)
+	// If an attempt times out after the server committed it then retrying would create a duplicate claim, so look
+	// for an equivalent claim before retrying. This can't tell a claim that existed already from one made by the
+	// earlier attempt, but either way a duplicate is not wanted.
+	check := func() ([]byte, error) {
+		claims, err := c.getClaimsForProperty(item, property_id)
+		if err != nil {
+			return nil, err
+		}
+		for _, claim := range claims {
+			if snakHasEncodedValue(claim.MainSnak, encoded_data) {
+				return json.Marshal(setCreateResponse{Success: 1, Claim: claim})
+			}
+		}
+		return nil, nil
+	}
+
+	response, err := c.editPostWithRetryCheck(args, check)
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer response.Close()
 
 	var res setCreateResponse
 	err = json.NewDecoder(response).Decode(&res)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if res.Error != nil {
-		return "", fmt.Errorf("Failed to process claim %s on %s with data %v: %v", property_id, item,
+		return nil, fmt.Errorf("Failed to process claim %s on %s with data %v: %v", property_id, item,
 			string(encoded_data), res.Error)
 	}
 
 	if res.Success != 1 {
-		return "", fmt.Errorf("We got an unexpected success value adding claim %s on %s with data %v: %v", property_id,
+		return nil, fmt.Errorf("We got an unexpected success value adding claim %s on %s with data %v: %v", property_id,
 			item, string(encoded_data), res)
 	}
 
-	return res.Claim.ID, nil
+	return &res.Claim, nil
+}
+
+// snakHasEncodedValue returns true if the snak has the value encoded as for CreateClaimOnItem, where no data means
+// "no value". The server adds fields to some values, such as the ID of an item and the sign of a quantity, and pads or
+// trims the years of times, so for values that are objects only the fields sent are compared, amounts are compared
+// without any sign, and times are compared without leading zeros on the year.
+func snakHasEncodedValue(snak Snak, encoded_data []byte) bool {
+	if len(encoded_data) == 0 {
+		return snak.SnakType == "novalue"
+	}
+	if snak.SnakType != "value" || snak.DataValue == nil {
+		return false
+	}
+
+	var stored, sent interface{}
+	if json.Unmarshal(snak.DataValue.Value, &stored) != nil || json.Unmarshal(encoded_data, &sent) != nil {
+		return false
+	}
+	sent_fields, ok := sent.(map[string]interface{})
+	if !ok {
+		return reflect.DeepEqual(stored, sent)
+	}
+	stored_fields, ok := stored.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for key, value := range sent_fields {
+		stored_value := stored_fields[key]
+		if key == "amount" {
+			stored_amount, _ := stored_value.(string)
+			sent_amount, _ := value.(string)
+			if strings.TrimPrefix(stored_amount, "+") != strings.TrimPrefix(sent_amount, "+") {
+				return false
+			}
+		} else if key == "time" {
+			stored_time, _ := stored_value.(string)
+			sent_time, _ := value.(string)
+			if trimTimeYear(stored_time) != trimTimeYear(sent_time) {
+				return false
+			}
+		} else if !reflect.DeepEqual(stored_value, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// trimTimeYear removes the leading zeros from the year of a Wikibase timestamp such as "+00000002001-05-11T00:00:00Z".
+func trimTimeYear(timestamp string) string {
+	if len(timestamp) == 0 || (timestamp[0] != '+' && timestamp[0] != '-') {
+		return timestamp
+	}
+	year := strings.TrimLeft(timestamp[1:], "0")
+	if strings.HasPrefix(year, "-") {
+		year = "0" + year
+	}
+	return timestamp[:1] + year
+}
+
+// createClaimByLabel looks up the property ID for the label and creates a claim with the provided value on the
+// item. A nil value will be created as a "no value" claim.
+func (c *Client) createClaimByLabel(item ItemPropertyType, property_label string, value interface{}) (string, error) {
+
+	property_id, ok := c.PropertyMap[property_label]
+	if !ok {
+		return "", fmt.Errorf("No property map for property label %s", property_label)
+	}
+
+	var data []byte
+	if !isNilValue(value) {
+		var err error
+		data, err = json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return c.CreateClaimOnItem(item, property_id, data)
+}
+
+// isNilValue returns true if the value is nil, or is a pointer, map, slice, interface, channel, or function that is
+// nil.
+func isNilValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Chan, reflect.Func:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// CreateStringClaim creates a new claim on the item for the property with the given label, which must already be in
+// the client's property map. An empty string is created as a "no value" claim.
+func (c *Client) CreateStringClaim(item ItemPropertyType, property_label string, value string) (string, error) {
+	claim, err := StringClaimToAPIData(c.normalizeStringValue(property_label, value))
+	if err != nil {
+		return "", err
+	}
+	return c.createClaimByLabel(item, property_label, claim)
+}
+
+// CreateItemClaim creates a new claim on the item for the property with the given label, which must already be in
+// the client's property map, that refers to another entity.
+func (c *Client) CreateItemClaim(item ItemPropertyType, property_label string, value ItemPropertyType) (string, error) {
+	claim, err := c.entityClaimToAPIData(value)
+	if err != nil {
+		return "", err
+	}
+	return c.createClaimByLabel(item, property_label, &claim)
+}
+
+// CreateQuantityClaim creates a new claim on the item for the property with the given label, which must already be
+// in the client's property map.
+func (c *Client) CreateQuantityClaim(item ItemPropertyType, property_label string, value int) (string, error) {
+	claim, err := QuantityClaimToAPIData(value)
+	if err != nil {
+		return "", err
+	}
+	return c.createClaimByLabel(item, property_label, &claim)
+}
+
+// CreateTimeClaim creates a new claim on the item for the property with the given label, which must already be in
+// the client's property map. The time is uploaded with day precision.
+func (c *Client) CreateTimeClaim(item ItemPropertyType, property_label string, value time.Time) (string, error) {
+	b, err := value.MarshalText()
+	if err != nil {
+		return "", err
+	}
+	claim, err := TimeDataClaimToAPIData(string(b))
+	if err != nil {
+		return "", err
+	}
+	return c.createClaimByLabel(item, property_label, &claim)
+}
+
+// CreateTimeClaimFull creates a new claim on the item for the property with the given label, which must already be
+// in the client's property map, with the time, precision, and calendar model given explicitly rather than inferred.
+// See FullTimeClaimToAPIData for the formats of time accepted.
+func (c *Client) CreateTimeClaimFull(item ItemPropertyType, property_label string, iso8601 string, precision int,
+	calendar ItemPropertyType) (string, error) {
+	claim, err := c.fullTimeClaimToAPIData(iso8601, precision, calendar)
+	if err != nil {
+		return "", err
+	}
+	return c.createClaimByLabel(item, property_label, &claim)
+}
+
+// SetClaimByLabel sets the value of the claim for the property with the given label on the item, creating a new claim
+// if the item does not have one for that property already, or updating the existing claim if it does. The value can be
+// of any type supported by the struct tag based upload, and a nil value will be set as "no value".
+func (c *Client) SetClaimByLabel(item ItemPropertyType, property_label string, value interface{}) error {
+
+	property_id, ok := c.PropertyMap[property_label]
+	if !ok {
+		return fmt.Errorf("No property map for property label %s", property_label)
+	}
+
+	var data []byte
+	if value != nil {
+		f := reflect.StructField{Name: property_label, Type: reflect.TypeOf(value)}
+		var err error
+		data, err = c.getDataForClaim(f, reflect.ValueOf(value))
+		if err != nil {
+			return fmt.Errorf("Failed to marshal %s on %s: %v", property_id, item, err)
+		}
+	}
+
+	claims, err := c.getClaimsForProperty(item, property_id)
+	if err != nil {
+		return err
+	}
+
+	switch len(claims) {
+	case 0:
+		_, err = c.CreateClaimOnItem(item, property_id, data)
+		return err
+	case 1:
+		return c.updateClaim(claims[0].ID, data)
+	default:
+		return fmt.Errorf("Item %s has multiple claims for %s, so not sure which to set", item, property_id)
+	}
 }
 
 func (c *Client) updateClaim(claim_id string, encoded_data []byte) error {
@@ -275,7 +1263,7 @@ func (c *Client) updateClaim(claim_id string, encoded_data []byte) error {
 		args["value"] = string(encoded_data)
 	}
 
-	response, err := c.client.Post(args)
+	response, err := c.editPost(args)
 
 	if err != nil {
 		return err
@@ -302,11 +1290,16 @@ func (c *Client) updateClaim(claim_id string, encoded_data []byte) error {
 
 }
 
-func getDataForClaim(f reflect.StructField, value reflect.Value) ([]byte, error) {
+func (c *Client) getDataForClaim(f reflect.StructField, value reflect.Value) ([]byte, error) {
+
+	// now work out how to encode this. We currently support: string, int and float (as quantity), Time (as TimeData),
+	// ItemPropertyType and bool (as an item), url.URL, GlobeCoordinate, HistoricalTime, MonolingualText, and
+	// Quantity. If the field is a pointer and nil we set no value, otherwise we use the deference value. Everything else
+	// we just raise an error on.
 
-	// now work out how to encode this. We currently support: string, int (as quantity), Time (as TimeData),
-	// and ItemPropertyType (as an item). If the field is a pointer and nil we set no value, otherwise we
-	// use the deference value. Everything else we just raise an error on.
+	if isNoValueField(f, value) {
+		return nil, nil
+	}
 
 	var data []byte
 
@@ -339,9 +1332,13 @@ func getDataForClaim(f reflect.StructField, value reflect.Value) ([]byte, error)
 		if claim_err != nil {
 			return nil, claim_err
 		}
+		claim.Precision, claim_err = timePrecisionForField(f, value)
+		if claim_err != nil {
+			return nil, claim_err
+		}
 		return json.Marshal(claim)
 	case "string":
-		claim, claim_err := StringClaimToAPIData(value.String())
+		claim, claim_err := StringClaimToAPIData(c.normalizeStringValue(propertyLabelForField(f), value.String()))
 		if claim_err != nil {
 			return nil, claim_err
 		}
@@ -356,17 +1353,105 @@ func getDataForClaim(f reflect.StructField, value reflect.Value) ([]byte, error)
 			return nil, claim_err
 		}
 		return json.Marshal(claim)
+	case "float64", "float32":
+		claim, claim_err := quantityFloatClaimToAPIData(value.Float(), value.Type().Bits())
+		if claim_err != nil {
+			return nil, claim_err
+		}
+		return json.Marshal(claim)
 	case "wikibase.ItemPropertyType":
-		claim, claim_err := ItemClaimToAPIData(ItemPropertyType(value.String()))
+		claim, claim_err := c.entityClaimToAPIData(ItemPropertyType(value.String()))
 		if claim_err != nil {
 			return nil, claim_err
 		}
 		return json.Marshal(claim)
+	case "bool":
+		item, item_err := c.booleanItem(value.Bool())
+		if item_err != nil {
+			return nil, item_err
+		}
+		claim, claim_err := c.entityClaimToAPIData(item)
+		if claim_err != nil {
+			return nil, claim_err
+		}
+		return json.Marshal(claim)
+	case "url.URL":
+		claim, claim_err := URLClaimToAPIData(value.Interface().(url.URL))
+		if claim_err != nil {
+			return nil, claim_err
+		}
+		return json.Marshal(claim)
+	case "wikibase.GlobeCoordinate":
+		claim, claim_err := c.globeCoordinateClaimToAPIData(value.Interface().(GlobeCoordinate))
+		if claim_err != nil {
+			return nil, claim_err
+		}
+		return json.Marshal(claim)
+	case "wikibase.HistoricalTime":
+		claim, claim_err := c.historicalTimeClaimToAPIData(value.Interface().(HistoricalTime))
+		if claim_err != nil {
+			return nil, claim_err
+		}
+		return json.Marshal(claim)
+	case "wikibase.Quantity":
+		claim, claim_err := c.quantityWithPrecisionClaimToAPIData(value.Interface().(Quantity))
+		if claim_err != nil {
+			return nil, claim_err
+		}
+		return json.Marshal(claim)
+	case "wikibase.MonolingualText":
+		claim, claim_err := c.monolingualTextClaimToAPIData(f, value.Interface().(MonolingualText))
+		if claim_err != nil {
+			return nil, claim_err
+		}
+		if claim == nil {
+			return nil, nil
+		}
+		return json.Marshal(claim)
 	default:
 		return nil, fmt.Errorf("Tried to upload property of unrecognised type %s", full_type_name)
 	}
 }
 
+// timePrecisionForField works out the precision to use for a time.Time field. By default this is day precision,
+// but the property tag can either state it explicitly with "precision=year", "precision=month", or "precision=day",
+// or ask for it to be inferred with "inferprecision". When inferring, a time that is midnight UTC on the first of
+// January is taken to be year precision, midnight UTC on the first of any other month is taken to be month
+// precision, and anything else is day precision.
+func timePrecisionForField(f reflect.StructField, value reflect.Value) (int, error) {
+
+	parts := strings.Split(f.Tag.Get("property"), ",")
+	for _, option := range parts[1:] {
+		switch option {
+		case "precision=year":
+			return TimePrecisionYear, nil
+		case "precision=month":
+			return TimePrecisionMonth, nil
+		case "precision=day":
+			return TimePrecisionDay, nil
+		case "inferprecision":
+			t, ok := value.Interface().(time.Time)
+			if !ok {
+				return 0, fmt.Errorf("Can only infer precision on time.Time values, not %v", value.Type())
+			}
+			t = t.UTC()
+			if t.Hour() != 0 || t.Minute() != 0 || t.Second() != 0 || t.Nanosecond() != 0 || t.Day() != 1 {
+				return TimePrecisionDay, nil
+			}
+			if t.Month() == time.January {
+				return TimePrecisionYear, nil
+			}
+			return TimePrecisionMonth, nil
+		default:
+			if strings.HasPrefix(option, "precision=") {
+				return 0, fmt.Errorf("Unrecognised time precision %s", option)
+			}
+		}
+	}
+
+	return TimePrecisionDay, nil
+}
+
 func goTypeToWikibaseType(f reflect.StructField) (string, error) {
 	full_type_name := fmt.Sprintf("%v", f.Type)
 	if full_type_name[0] == '*' {
@@ -378,25 +1463,120 @@ func goTypeToWikibaseType(f reflect.StructField) (string, error) {
 		return "time", nil
 	case "string":
 		return "string", nil
-	case "int":
+	case "int", "float64", "float32":
 		return "quantity", nil
-	case "wikibase.ItemPropertyType":
+	case "wikibase.ItemPropertyType", "bool":
 		return "wikibase-item", nil
+	case "url.URL":
+		return "url", nil
+	case "wikibase.GlobeCoordinate":
+		return "globe-coordinate", nil
+	case "wikibase.HistoricalTime":
+		return "time", nil
+	case "wikibase.MonolingualText":
+		return "monolingualtext", nil
+	case "wikibase.Quantity":
+		return "quantity", nil
 	default:
 		return "", fmt.Errorf("Tried to convert property of unrecognised type %s", full_type_name)
 	}
 }
 
-func (c *Client) createPropertyWithLabel(label string, f reflect.StructField) (string, error) {
+// WikibaseDataTypes lists the property datatypes known to Wikibase, not all of which may be enabled on any
+// particular server.
+var WikibaseDataTypes = []string{
+	"commonsMedia",
+	"edtf",
+	"entity-schema",
+	"external-id",
+	"geo-shape",
+	"globe-coordinate",
+	"math",
+	"monolingualtext",
+	"musical-notation",
+	"quantity",
+	"string",
+	"tabular-data",
+	"time",
+	"url",
+	"wikibase-form",
+	"wikibase-item",
+	"wikibase-lexeme",
+	"wikibase-property",
+	"wikibase-sense",
+}
 
-	if len(label) == 0 {
-		return "", fmt.Errorf("Property label must not be an empty string.")
+func isKnownDataType(datatype string) bool {
+	for _, t := range WikibaseDataTypes {
+		if t == datatype {
+			return true
+		}
 	}
+	return false
+}
+
+// CreateProperty creates a new property on Wikibase with the given label and datatype, returning the new P number.
+// The datatype must be one of those in WikibaseDataTypes.
+func (c *Client) CreateProperty(label string, datatype string) (string, error) {
+	if !isKnownDataType(datatype) {
+		return "", fmt.Errorf("Unrecognised property datatype %s", datatype)
+	}
+	return c.createProperty(label, datatype, "")
+}
 
+// isNoValueField returns true if the field's property tag has the "novalue" clause and the value is the zero value
+// for its type, in which case it should be uploaded as a "no value" claim.
+func isNoValueField(f reflect.StructField, value reflect.Value) bool {
+	return hasPropertyTagOption(f, "novalue") &&
+		reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface())
+}
+
+// propertyDescriptionForField returns the description in the "desc=" option of the field's property tag, if any. As
+// tag options are separated by commas, the description can not contain commas.
+func propertyDescriptionForField(f reflect.StructField) string {
+	description, _ := propertyTagOptionValue(f, "desc=")
+	return description
+}
+
+// propertyLabelOverrideForField returns the label in the "label=" option of the field's property tag, if any, which
+// is used in place of the tag key when creating the property. Like descriptions, it can not contain commas.
+func propertyLabelOverrideForField(f reflect.StructField) string {
+	label, _ := propertyTagOptionValue(f, "label=")
+	return label
+}
+
+func (c *Client) createPropertyWithLabel(label string, f reflect.StructField) (string, error) {
 	datatype, err := goTypeToWikibaseType(f)
 	if err != nil {
 		return "", err
 	}
+	if c.BeforeCreateProperty != nil {
+		err = c.BeforeCreateProperty(label, datatype)
+		if err != nil {
+			return "", fmt.Errorf("Creation of property %s was vetoed: %v", label, err)
+		}
+	}
+	return c.createProperty(label, datatype, propertyDescriptionForField(f))
+}
+
+func (c *Client) createProperty(label string, datatype string, description string) (string, error) {
+
+	if len(label) == 0 {
+		return "", fmt.Errorf("Property label must not be an empty string.")
+	}
+	if c.AllowedCreateDatatypes != nil {
+		allowed := false
+		for _, t := range c.AllowedCreateDatatypes {
+			if t == datatype {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "", fmt.Errorf("Creating properties of datatype %s is not allowed, only %v", datatype,
+				c.AllowedCreateDatatypes)
+		}
+	}
 
 	editToken, terr := c.GetEditingToken()
 	if terr != nil {
@@ -404,8 +1584,11 @@ func (c *Client) createPropertyWithLabel(label string, f reflect.StructField) (s
 	}
 
 	create := propertyCreate{DataType: datatype, Labels: make(map[string]itemLabel, 0)}
-	l := itemLabel{Language: "en", Value: label}
-	create.Labels["en"] = l
+	language := c.labelLanguage(WikiBaseProperty)
+	create.Labels[language] = itemLabel{Language: language, Value: label}
+	if len(description) > 0 {
+		create.Descriptions = map[string]itemLabel{language: {Language: language, Value: description}}
+	}
 	b, berr := json.Marshal(create)
 	if berr != nil {
 		return "", berr
@@ -419,7 +1602,7 @@ func (c *Client) createPropertyWithLabel(label string, f reflect.StructField) (s
 		"bot":    "1",
 	}
 
-	response, err := c.client.Post(args)
+	response, err := c.editPost(args)
 
 	if err != nil {
 		return "", err
@@ -433,12 +1616,13 @@ func (c *Client) createPropertyWithLabel(label string, f reflect.StructField) (s
 	}
 
 	if res.Error != nil {
-		return "", fmt.Errorf("Failed to create property %s: %v", label, res.Error)
+		return "", fmt.Errorf("Failed to create property %s: %w", label, res.Error)
 	}
 
 	if res.Success != 1 {
 		return "", fmt.Errorf("We got an unexpected success creating property %s: %v", label, res)
 	}
+	c.clearKnownMissingLabel(WikiBaseProperty, label)
 
 	return string(res.Entity.ID), nil
 }
@@ -15,8 +15,12 @@
 package wikibase
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -31,8 +35,8 @@ type SimpleTestStruct struct {
 
 func TestParseSimpleStruct(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {
     "batchcomplete": "",
     "query": {
@@ -47,7 +51,7 @@ func TestParseSimpleStruct(t *testing.T) {
     }
 }
 `)
-	client.addDataResponse(`
+	client.AddResponse(`
 {
     "batchcomplete": "",
     "query": {
@@ -76,8 +80,8 @@ func TestParseSimpleStruct(t *testing.T) {
 
 func TestParseSimpleStructErrors(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addErrorResponse(fmt.Errorf("Oops"))
+	client := &MockNetworkClient{}
+	client.AddError(fmt.Errorf("Oops"))
 	wikibase := NewClient(client)
 
 	err := wikibase.MapPropertyAndItemConfiguration(SimpleTestStruct{}, false)
@@ -88,8 +92,8 @@ func TestParseSimpleStructErrors(t *testing.T) {
 
 func TestParseSimpleStructWithCreateOnOneProperty(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {
     "batchcomplete": "",
     "query": {
@@ -104,7 +108,7 @@ func TestParseSimpleStructWithCreateOnOneProperty(t *testing.T) {
     }
 }
 `)
-	client.addDataResponse(`
+	client.AddResponse(`
 {
     "batchcomplete": "",
     "query": {
@@ -112,7 +116,7 @@ func TestParseSimpleStructWithCreateOnOneProperty(t *testing.T) {
     }
 }
 `)
-	client.addDataResponse(`
+	client.AddResponse(`
 {
     "entity": {
         "aliases": {},
@@ -147,8 +151,8 @@ func TestParseSimpleStructWithCreateOnOneProperty(t *testing.T) {
 
 func TestMapItemByName(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {
     "batchcomplete": "",
     "requestid": "42",
@@ -178,8 +182,8 @@ func TestMapItemByName(t *testing.T) {
 
 func TestMapItemByNameNoMatchNoCreate(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {
     "batchcomplete": "",
     "requestid": "42",
@@ -199,8 +203,8 @@ func TestMapItemByNameNoMatchNoCreate(t *testing.T) {
 
 func TestMapItemByNameNoMatchWithCreate(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {
     "batchcomplete": "",
     "requestid": "42",
@@ -210,7 +214,7 @@ func TestMapItemByNameNoMatchWithCreate(t *testing.T) {
     }
 }
 `)
-	client.addDataResponse(`
+	client.AddResponse(`
 {
     "entity": {
         "aliases": {},
@@ -244,6 +248,338 @@ func TestMapItemByNameNoMatchWithCreate(t *testing.T) {
 	}
 }
 
+type FallbackLabelTestStruct struct {
+	Birthday time.Time `property:"birth date|date of birth"`
+}
+
+func TestParseStructWithFallbackLabels(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[]}}
+`)
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Property:P7","pageid":11,"displaytext":"date of birth"}]}}
+`)
+	wikibase := NewClient(client)
+
+	err := wikibase.MapPropertyAndItemConfiguration(FallbackLabelTestStruct{}, false)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+
+	if wikibase.PropertyMap["birth date|date of birth"] != "P7" {
+		t.Errorf("Tag was not mapped to property: %v", wikibase.PropertyMap)
+	}
+	if wikibase.PropertyMap["date of birth"] != "P7" {
+		t.Errorf("Resolved label was not mapped to property: %v", wikibase.PropertyMap)
+	}
+	if wikibase.ResolvedPropertyLabels["birth date|date of birth"] != "date of birth" {
+		t.Errorf("Resolved label was not recorded: %v", wikibase.ResolvedPropertyLabels)
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestParseStructWithFallbackLabelsNoneFound(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[]}}
+`)
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[]}}
+`)
+	wikibase := NewClient(client)
+
+	err := wikibase.MapPropertyAndItemConfiguration(FallbackLabelTestStruct{}, false)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+}
+
+func TestParseStructWithVetoedPropertyCreation(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[]}}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	var vetoed_label, vetoed_datatype string
+	wikibase.BeforeCreateProperty = func(label string, datatype string) error {
+		vetoed_label = label
+		vetoed_datatype = datatype
+		return fmt.Errorf("Schema version does not allow new properties")
+	}
+
+	err := wikibase.MapPropertyAndItemConfiguration(SimpleTestStruct{}, true)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if !strings.Contains(err.Error(), "Schema version does not allow new properties") {
+		t.Errorf("Expected hook error to be returned: %v", err)
+	}
+	if vetoed_label != "propname" || vetoed_datatype != "string" {
+		t.Errorf("Hook got wrong arguments: %s %s", vetoed_label, vetoed_datatype)
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+	if _, ok := wikibase.PropertyMap["propname"]; ok {
+		t.Errorf("Property should not have been mapped: %v", wikibase.PropertyMap)
+	}
+}
+
+type DescribedPropertyTestStruct struct {
+	Mass int `property:"mass,desc=measured mass in grams,omitoncreate"`
+}
+
+func TestParseStructCreatesPropertyWithDescription(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[]}}
+`)
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{"en":{"language":"en","value":"measured mass in grams"}},"id":"P26","labels":{"en":{"language":"en","value":"mass"}},"lastrevid":4,"type":"property"},"success":1}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.MapPropertyAndItemConfiguration(DescribedPropertyTestStruct{}, true)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if wikibase.PropertyMap["mass"] != "P26" {
+		t.Errorf("Property was not mapped: %v", wikibase.PropertyMap)
+	}
+
+	var create propertyCreate
+	err = json.Unmarshal([]byte(client.LastArgs()["data"]), &create)
+	if err != nil {
+		t.Fatalf("Failed to decode data sent: %v", err)
+	}
+	if create.Descriptions["en"].Value != "measured mass in grams" {
+		t.Errorf("Description was not sent: %v", client.LastArgs()["data"])
+	}
+	if create.Labels["en"].Value != "mass" || create.DataType != "quantity" {
+		t.Errorf("Unexpected property created: %v", client.LastArgs()["data"])
+	}
+}
+
+type LabelledPropertyTestStruct struct {
+	Mass int `property:"mass,label=measured mass (g),omitoncreate"`
+}
+
+func TestParseStructCreatesPropertyWithLabelOverride(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[]}}
+`)
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[]}}
+`)
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"P26","labels":{"en":{"language":"en","value":"measured mass (g)"}},"lastrevid":4,"type":"property"},"success":1}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.MapPropertyAndItemConfiguration(LabelledPropertyTestStruct{}, true)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if wikibase.PropertyMap["mass"] != "P26" {
+		t.Errorf("Property was not mapped under the tag key: %v", wikibase.PropertyMap)
+	}
+
+	var create propertyCreate
+	err = json.Unmarshal([]byte(client.LastArgs()["data"]), &create)
+	if err != nil {
+		t.Fatalf("Failed to decode data sent: %v", err)
+	}
+	if create.Labels["en"].Value != "measured mass (g)" {
+		t.Errorf("Override label was not sent: %v", client.LastArgs()["data"])
+	}
+	if client.InvocationCount != 3 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestParseStructFindsPropertyByLabelOverride(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":122,"title":"Property:P26","pageid":30,"displaytext":"measured mass (g)"}]}}
+`)
+	wikibase := NewClient(client)
+
+	err := wikibase.MapPropertyAndItemConfiguration(LabelledPropertyTestStruct{}, false)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if wikibase.PropertyMap["mass"] != "P26" {
+		t.Errorf("Property was not mapped under the tag key: %v", wikibase.PropertyMap)
+	}
+	if client.LastArgs()["wbssearch"] != "measured mass (g)" {
+		t.Errorf("Expected lookup by the override label: %v", client.LastArgs())
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestParseStructWithDisallowedDatatype(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[]}}
+`)
+	wikibase := NewClient(client)
+	wikibase.AllowedCreateDatatypes = []string{"string", "wikibase-item"}
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.MapPropertyAndItemConfiguration(DescribedPropertyTestStruct{}, true)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if !strings.Contains(err.Error(), "quantity") {
+		t.Errorf("Error should mention the datatype: %v", err)
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestCreatePropertyWithAllowedDatatype(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"P26","labels":{"en":{"language":"en","value":"homepage"}},"lastrevid":4,"type":"property"},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.AllowedCreateDatatypes = []string{"url"}
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateProperty("homepage", "url")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+
+	_, err = wikibase.CreateProperty("population", "quantity")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestEnsureItemExisting(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Item:Q4","pageid":11,"displaytext":"blah"}]}}
+`)
+	wikibase := NewClient(client)
+
+	id, err := wikibase.EnsureItem("blah")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if id != "Q4" {
+		t.Errorf("We got the wrong ID: %v", id)
+	}
+	if wikibase.ItemMap["blah"] != "Q4" {
+		t.Errorf("Our item map was not updated: %v", wikibase.ItemMap)
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestEnsureItemCreates(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[]}}
+`)
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"Q11","labels":{"en":{"language":"en","value":"blah"}},"lastrevid":55,"sitelinks":{},"type":"item"},"success":1}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	id, err := wikibase.EnsureItem("blah")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if id != "Q11" {
+		t.Errorf("We got the wrong ID: %v", id)
+	}
+	if wikibase.ItemMap["blah"] != "Q11" {
+		t.Errorf("Our item map was not updated: %v", wikibase.ItemMap)
+	}
+	if client.LastArgs()["action"] != "wbeditentity" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+}
+
+func TestEnsureItemWithStatusExisting(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Item:Q4","pageid":11,"displaytext":"blah"}]}}
+`)
+	wikibase := NewClient(client)
+
+	id, created, err := wikibase.EnsureItemWithStatus("blah")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if id != "Q4" {
+		t.Errorf("We got the wrong ID: %v", id)
+	}
+	if created {
+		t.Errorf("Matched item should not be reported as created")
+	}
+}
+
+func TestEnsureItemWithStatusCreates(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[]}}
+`)
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"Q11","labels":{"en":{"language":"en","value":"blah"}},"lastrevid":55,"sitelinks":{},"type":"item"},"success":1}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	id, created, err := wikibase.EnsureItemWithStatus("blah")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if id != "Q11" {
+		t.Errorf("We got the wrong ID: %v", id)
+	}
+	if !created {
+		t.Errorf("New item should be reported as created")
+	}
+}
+
 // Tests for API Encoding of claims
 
 func TestStringClaimEncode(t *testing.T) {
@@ -278,6 +614,19 @@ func TestStringClaimWhitespaceEncode(t *testing.T) {
 	}
 }
 
+func TestWhitespaceOnlyStringClaimEncode(t *testing.T) {
+
+	const testdata = "   \n  "
+
+	v, err := StringClaimToAPIData(testdata)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if v != nil {
+		t.Errorf("Expected nil return, got %s", *v)
+	}
+}
+
 func TestZeroLengthStringClaimEncode(t *testing.T) {
 
 	const testdata = ""
@@ -298,8 +647,63 @@ func TestItemClaimEncode(t *testing.T) {
 	}
 }
 
-func TestPropertyAsItemClaimEncode(t *testing.T) {
-	_, err := ItemClaimToAPIData("P42")
+func TestEntityTypeClaimEncode(t *testing.T) {
+
+	tests := []struct {
+		value       ItemPropertyType
+		entity_type string
+	}{
+		{"Q42", "item"},
+		{"P42", "property"},
+		{"L42", "lexeme"},
+	}
+
+	for _, test := range tests {
+		claim, err := ItemClaimToAPIData(test.value)
+		if err != nil {
+			t.Fatalf("We got an unexpected error: %v", err)
+		}
+		if claim.EntityType != test.entity_type {
+			t.Errorf("Expected entity type %s for %s, got %s", test.entity_type, test.value, claim.EntityType)
+		}
+		if claim.NumericID != 42 {
+			t.Errorf("Expected numeric ID 42 for %s, got %d", test.value, claim.NumericID)
+		}
+	}
+}
+
+func TestCustomEntityTypePrefixClaimEncode(t *testing.T) {
+
+	wikibase := NewClient(&MockNetworkClient{})
+	wikibase.EntityTypePrefixes = map[string]string{
+		"C":  "item",
+		"CP": "property",
+	}
+
+	claim, err := wikibase.entityClaimToAPIData("CP42")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if claim.EntityType != "property" || claim.NumericID != 42 {
+		t.Errorf("Got unexpected claim: %v", claim)
+	}
+
+	claim, err = wikibase.entityClaimToAPIData("C42")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if claim.EntityType != "item" || claim.NumericID != 42 {
+		t.Errorf("Got unexpected claim: %v", claim)
+	}
+
+	_, err = wikibase.entityClaimToAPIData("Q42")
+	if err == nil {
+		t.Errorf("We expected an error")
+	}
+}
+
+func TestUnknownEntityTypeClaimEncode(t *testing.T) {
+	_, err := ItemClaimToAPIData("X42")
 	if err == nil {
 		t.Fatalf("We got an expected an error")
 	}
@@ -312,11 +716,76 @@ func TestInvalidItemClaimEncode(t *testing.T) {
 	}
 }
 
+func TestMalformedItemClaimEncode(t *testing.T) {
+
+	malformed := []ItemPropertyType{"Q42Q", "Q", "Q0x1", "QQ", "Q-42", "Q+42", "Q042", "Q 42"}
+	for _, value := range malformed {
+		_, err := ItemClaimToAPIData(value)
+		if err == nil {
+			t.Errorf("We expected an error for %s", value)
+		} else if !strings.Contains(err.Error(), string(value)) {
+			t.Errorf("Expected error for %s to mention the ID: %v", value, err)
+		}
+	}
+
+	claim, err := ItemClaimToAPIData("Q42")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if claim.EntityType != "item" || claim.NumericID != 42 {
+		t.Errorf("Got unexpected claim: %v", claim)
+	}
+}
+
 func TestQuntityClaimEncode(t *testing.T) {
-	_, err := QuantityClaimToAPIData(42)
+	claim, err := QuantityClaimToAPIData(42)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if claim.Amount != "+42" {
+		t.Errorf("We got the wrong amount: %v", claim)
+	}
+
+	claim, err = QuantityClaimToAPIData(-7)
 	if err != nil {
 		t.Fatalf("We got an unexpected error: %v", err)
 	}
+	if claim.Amount != "-7" {
+		t.Errorf("We got the wrong amount: %v", claim)
+	}
+}
+
+func TestQuantityFloatClaimEncode(t *testing.T) {
+
+	cases := []struct {
+		value  float64
+		amount string
+	}{
+		{42.5, "+42.5"},
+		{-3.25, "-3.25"},
+		{0, "+0"},
+		{1e21, "+1000000000000000000000"},
+		{1.5e-7, "+0.00000015"},
+		{-6.02e23, "-602000000000000000000000"},
+	}
+	for _, c := range cases {
+		claim, err := QuantityFloatClaimToAPIData(c.value)
+		if err != nil {
+			t.Fatalf("We got an unexpected error for %v: %v", c.value, err)
+		}
+		if claim.Amount != c.amount || claim.Unit != "1" {
+			t.Errorf("Expected %s for %v, got %v", c.amount, c.value, claim)
+		}
+	}
+
+	_, err := QuantityFloatClaimToAPIData(math.NaN())
+	if err == nil {
+		t.Errorf("We expected an error for NaN")
+	}
+	_, err = QuantityFloatClaimToAPIData(math.Inf(1))
+	if err == nil {
+		t.Errorf("We expected an error for infinity")
+	}
 }
 
 func TestTimeDataClaimEncode(t *testing.T) {
@@ -337,6 +806,8 @@ type marshalTestStruct struct {
 	G *time.Time
 	H *ItemPropertyType
 	I string
+	J float64
+	K float32
 }
 
 func TestMarshalInternal(t *testing.T) {
@@ -353,8 +824,11 @@ func TestMarshalInternal(t *testing.T) {
 		G: nil,
 		H: &b,
 		I: "", // wikidata doesn't cope with zero length strings, so we should return no value for this
+		J: 7.25,
+		K: 0.1,
 	}
-	expectData := []bool{true, true, true, true, false, true, false, true, false}
+	expectData := []bool{true, true, true, true, false, true, false, true, false, true, true}
+	wikibase := NewClient(&MockNetworkClient{})
 
 	r := reflect.TypeOf(s)
 	v := reflect.ValueOf(s)
@@ -362,7 +836,7 @@ func TestMarshalInternal(t *testing.T) {
 		field := r.Field(i)
 		value := v.Field(i)
 
-		data, err := getDataForClaim(field, value)
+		data, err := wikibase.getDataForClaim(field, value)
 		if err != nil {
 			t.Fatalf("Failed to marshal claim %d: %v", i, err)
 		}
@@ -370,13 +844,28 @@ func TestMarshalInternal(t *testing.T) {
 			t.Fatalf("We got no data for field %d", i)
 		}
 	}
+
+	// Floats keep their fractional part, and float32 values don't gain digits from being widened
+	for name, expected := range map[string]string{
+		"J": `{"amount":"+7.25","unit":"1"}`,
+		"K": `{"amount":"+0.1","unit":"1"}`,
+	} {
+		field, _ := r.FieldByName(name)
+		data, err := wikibase.getDataForClaim(field, v.FieldByName(name))
+		if err != nil {
+			t.Fatalf("Failed to marshal claim %s: %v", name, err)
+		}
+		if string(data) != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, name, data)
+		}
+	}
 }
 
 func TestTypeConversion(t *testing.T) {
 
 	s := marshalTestStruct{}
 	expectData := []string{"string", "quantity", "time", "wikibase-item", "quantity",
-		"quantity", "time", "wikibase-item", "string"}
+		"quantity", "time", "wikibase-item", "string", "quantity", "quantity"}
 
 	r := reflect.TypeOf(s)
 	for i := 0; i < r.NumField(); i++ {
@@ -391,3 +880,1267 @@ func TestTypeConversion(t *testing.T) {
 		}
 	}
 }
+
+type timePrecisionTestStruct struct {
+	Default  time.Time  `property:"default"`
+	Inferred time.Time  `property:"inferred,inferprecision"`
+	Pointer  *time.Time `property:"pointer,inferprecision"`
+	Explicit time.Time  `property:"explicit,precision=month"`
+	Bad      time.Time  `property:"bad,precision=decade"`
+}
+
+func TestTimePrecisionInference(t *testing.T) {
+
+	r := reflect.TypeOf(timePrecisionTestStruct{})
+	field, _ := r.FieldByName("Inferred")
+
+	tests := []struct {
+		value     time.Time
+		precision int
+	}{
+		{time.Date(1976, time.January, 1, 0, 0, 0, 0, time.UTC), TimePrecisionYear},
+		{time.Date(1976, time.June, 1, 0, 0, 0, 0, time.UTC), TimePrecisionMonth},
+		{time.Date(1976, time.June, 6, 0, 0, 0, 0, time.UTC), TimePrecisionDay},
+		{time.Date(1976, time.January, 1, 13, 45, 2, 0, time.UTC), TimePrecisionDay},
+	}
+
+	for _, test := range tests {
+		precision, err := timePrecisionForField(field, reflect.ValueOf(test.value))
+		if err != nil {
+			t.Fatalf("We got an unexpected error: %v", err)
+		}
+		if precision != test.precision {
+			t.Errorf("Expected precision %d for %v, got %d", test.precision, test.value, precision)
+		}
+	}
+}
+
+func TestTimePrecisionDefaultIsDay(t *testing.T) {
+
+	r := reflect.TypeOf(timePrecisionTestStruct{})
+	field, _ := r.FieldByName("Default")
+
+	precision, err := timePrecisionForField(field, reflect.ValueOf(time.Date(1976, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if precision != TimePrecisionDay {
+		t.Errorf("Expected day precision, got %d", precision)
+	}
+}
+
+func TestTimePrecisionExplicit(t *testing.T) {
+
+	r := reflect.TypeOf(timePrecisionTestStruct{})
+	field, _ := r.FieldByName("Explicit")
+
+	precision, err := timePrecisionForField(field, reflect.ValueOf(time.Now()))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if precision != TimePrecisionMonth {
+		t.Errorf("Expected month precision, got %d", precision)
+	}
+
+	field, _ = r.FieldByName("Bad")
+	_, err = timePrecisionForField(field, reflect.ValueOf(time.Now()))
+	if err == nil {
+		t.Errorf("We expected an error")
+	}
+}
+
+func TestMarshalTimeWithInferredPrecision(t *testing.T) {
+
+	d := time.Date(1976, time.June, 1, 0, 0, 0, 0, time.UTC)
+	s := timePrecisionTestStruct{Pointer: &d}
+
+	wikibase := NewClient(&MockNetworkClient{})
+	field, _ := reflect.TypeOf(s).FieldByName("Pointer")
+	data, err := wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Pointer"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), fmt.Sprintf(`"precision":%d`, TimePrecisionMonth)) {
+		t.Errorf("Expected month precision in encoded data: %s", data)
+	}
+}
+
+// Tests for the direct claim creation helpers
+
+const testClaimCreateResponse = `
+{"pageinfo":{"lastrevid":460},"success":1,"claim":{"mainsnak":{"snaktype":"value","property":"P14","hash":"db735571fef70e4d199d40fe10609312fa8e5fa9","datavalue":{"value":"wot!","type":"string"},"datatype":"string"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"normal"}}
+`
+
+func TestCreateClaimOnItemWithResult(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	claim, err := wikibase.CreateClaimOnItemWithResult("Q11", "P14", []byte(`"wot!"`))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if claim.ID != "Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63" || claim.Rank != RankNormal || claim.Type != "statement" {
+		t.Errorf("We got the wrong claim: %v", claim)
+	}
+	if claim.MainSnak.Hash != "db735571fef70e4d199d40fe10609312fa8e5fa9" || claim.MainSnak.DataType != "string" ||
+		claim.MainSnak.Property != "P14" {
+		t.Errorf("We got the wrong main snak: %v", claim.MainSnak)
+	}
+	value, err := claim.MainSnak.DataValue.StringValue()
+	if err != nil || value != "wot!" {
+		t.Errorf("We got the wrong value: %v %v", value, err)
+	}
+}
+
+func TestCreateStringClaim(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	id, err := wikibase.CreateStringClaim("Q11", "test", " wot! ")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if id != "Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63" {
+		t.Errorf("We got the wrong claim ID: %v", id)
+	}
+
+	if client.LastArgs()["action"] != "wbcreateclaim" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["property"] != "P14" {
+		t.Errorf("Unexpected property requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["value"] != `"wot!"` {
+		t.Errorf("Unexpected value requested: %v", client.LastArgs())
+	}
+}
+
+func TestCreateEmptyStringClaim(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateStringClaim("Q11", "test", "")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.LastArgs()["snaktype"] != "novalue" {
+		t.Errorf("Unexpected snaktype requested: %v", client.LastArgs())
+	}
+}
+
+func TestCreateClaimWithUnmappedLabel(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateStringClaim("Q11", "test", "wot!")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestCreateItemClaim(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateItemClaim("Q11", "test", "Q42")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.LastArgs()["value"] != `{"entity-type":"item","numeric-id":42}` {
+		t.Errorf("Unexpected value requested: %v", client.LastArgs())
+	}
+}
+
+func TestCreateQuantityClaim(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateQuantityClaim("Q11", "test", 42)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.LastArgs()["value"] != `{"amount":"+42","unit":"1"}` {
+		t.Errorf("Unexpected value requested: %v", client.LastArgs())
+	}
+}
+
+func TestCreateTimeClaim(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateTimeClaim("Q11", "test", time.Date(1976, time.June, 6, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(client.LastArgs()["value"], `"time":"+00000001976-06-06T00:00:00Z"`) {
+		t.Errorf("Unexpected value requested: %v", client.LastArgs())
+	}
+}
+
+func TestSetClaimByLabelCreates(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"claims":{}}`)
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetClaimByLabel("Q11", "test", "wot!")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+	if client.LastArgs()["action"] != "wbcreateclaim" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["value"] != `"wot!"` {
+		t.Errorf("Unexpected value requested: %v", client.LastArgs())
+	}
+}
+
+func TestSetClaimByLabelUpdates(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"claims":{"P14":[{"mainsnak":{"snaktype":"value","property":"P14","hash":"db735571fef70e4d199d40fe10609312fa8e5fa9","datatype":"quantity"},"type":"statement","id":"Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63","rank":"normal"}]}}
+`)
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetClaimByLabel("Q11", "test", 42)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.LastArgs()["action"] != "wbsetclaimvalue" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["claim"] != "Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63" {
+		t.Errorf("Unexpected claim requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["value"] != `{"amount":"+42","unit":"1"}` {
+		t.Errorf("Unexpected value requested: %v", client.LastArgs())
+	}
+}
+
+func TestSetClaimByLabelUnsupportedType(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+
+	err := wikibase.SetClaimByLabel("Q11", "test", complex(4, 2))
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+type globeCoordinateTestStruct struct {
+	Location GlobeCoordinate `property:"location"`
+}
+
+func TestGlobeCoordinateClaimEncode(t *testing.T) {
+
+	claim, err := GlobeCoordinateClaimToAPIData(GlobeCoordinate{Latitude: 52.2, Longitude: 0.12, Precision: 0.01})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if claim.Globe != "http://www.wikidata.org/entity/Q2" {
+		t.Errorf("Expected Earth as the globe: %v", claim)
+	}
+
+	_, err = GlobeCoordinateClaimToAPIData(GlobeCoordinate{Latitude: 92.2, Longitude: 0.12})
+	if err == nil {
+		t.Errorf("We expected an error")
+	}
+}
+
+func TestGlobeCoordinateWithDefaultGlobe(t *testing.T) {
+
+	wikibase := NewClient(&MockNetworkClient{})
+	wikibase.DefaultGlobe = "Q111"
+
+	s := globeCoordinateTestStruct{Location: GlobeCoordinate{Latitude: -4.5, Longitude: 137.4, Precision: 0.1}}
+	field, _ := reflect.TypeOf(s).FieldByName("Location")
+	data, err := wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Location"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"globe":"http://www.wikidata.org/entity/Q111"`) {
+		t.Errorf("Expected default globe in encoded data: %s", data)
+	}
+
+	// An explicit globe takes priority over the default
+	s.Location.Globe = "Q405"
+	data, err = wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Location"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"globe":"http://www.wikidata.org/entity/Q405"`) {
+		t.Errorf("Expected explicit globe in encoded data: %s", data)
+	}
+
+	datatype, err := goTypeToWikibaseType(field)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if datatype != "globe-coordinate" {
+		t.Errorf("Got unexpected datatype: %s", datatype)
+	}
+}
+
+func TestConceptBaseURI(t *testing.T) {
+
+	wikibase := NewClient(&MockNetworkClient{})
+	wikibase.ConceptBaseURI = "https://example.org/entity/"
+
+	s := globeCoordinateTestStruct{Location: GlobeCoordinate{Latitude: -4.5, Longitude: 137.4, Precision: 0.1}}
+	field, _ := reflect.TypeOf(s).FieldByName("Location")
+	data, err := wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Location"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"globe":"http://www.wikidata.org/entity/Q2"`) {
+		t.Errorf("Expected Wikibase's standard Earth globe in encoded data: %s", data)
+	}
+
+	s.Location.Globe = "Q405"
+	data, err = wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Location"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"globe":"https://example.org/entity/Q405"`) {
+		t.Errorf("Expected globe from the concept base URI in encoded data: %s", data)
+	}
+
+	q := struct {
+		Weight Quantity `property:"weight"`
+	}{Weight: Quantity{Amount: 9.81, Precision: 0.01, Unit: "Q11573"}}
+	field, _ = reflect.TypeOf(q).FieldByName("Weight")
+	data, err = wikibase.getDataForClaim(field, reflect.ValueOf(q).FieldByName("Weight"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"unit":"https://example.org/entity/Q11573"`) {
+		t.Errorf("Expected unit from the concept base URI in encoded data: %s", data)
+	}
+}
+
+func TestGlobeCoordinateWithInvalidDefaultGlobe(t *testing.T) {
+
+	wikibase := NewClient(&MockNetworkClient{})
+	wikibase.DefaultGlobe = "P111"
+
+	s := globeCoordinateTestStruct{Location: GlobeCoordinate{Latitude: -4.5, Longitude: 137.4, Precision: 0.1}}
+	field, _ := reflect.TypeOf(s).FieldByName("Location")
+	_, err := wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Location"))
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+}
+
+func TestCreateProperty(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"P26","labels":{"en":{"language":"en","value":"homepage"}},"lastrevid":4,"type":"property"},"success":1}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	id, err := wikibase.CreateProperty("homepage", "url")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if id != "P26" {
+		t.Errorf("We got the wrong ID: %v", id)
+	}
+
+	if client.LastArgs()["action"] != "wbeditentity" || client.LastArgs()["new"] != "property" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+	if !strings.Contains(client.LastArgs()["data"], `"datatype":"url"`) {
+		t.Errorf("Unexpected data requested: %v", client.LastArgs())
+	}
+}
+
+func TestCreatePropertyWithPropertyLabelLanguage(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"P26","labels":{"de":{"language":"de","value":"Homepage"}},"lastrevid":4,"type":"property"},"success":1}
+`)
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"Q11","labels":{"cy":{"language":"cy","value":"helo"}},"lastrevid":5,"type":"item"},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.Language = "cy"
+	wikibase.PropertyLabelLanguage = "de"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateProperty("Homepage", "url")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(client.LastArgs()["data"], `"labels":{"de":{"language":"de","value":"Homepage"}}`) {
+		t.Errorf("Property label not in property language: %v", client.LastArgs())
+	}
+
+	item := struct {
+		ItemHeader
+	}{}
+	err = wikibase.CreateItemInstance("helo", &item)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(client.LastArgs()["data"], `"labels":{"cy":{"language":"cy","value":"helo"}}`) {
+		t.Errorf("Item label not in client language: %v", client.LastArgs())
+	}
+}
+
+func TestCreatePropertyDefaultsToClientLanguage(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"P26","labels":{"cy":{"language":"cy","value":"hafan"}},"lastrevid":4,"type":"property"},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.Language = "cy"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateProperty("hafan", "url")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(client.LastArgs()["data"], `"labels":{"cy":{"language":"cy","value":"hafan"}}`) {
+		t.Errorf("Property label not in client language: %v", client.LastArgs())
+	}
+}
+
+func TestCreatePropertyInvalidDataType(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateProperty("homepage", "website")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+type urlTestStruct struct {
+	Homepage url.URL  `property:"homepage"`
+	Source   *url.URL `property:"source"`
+}
+
+func TestURLClaimEncode(t *testing.T) {
+
+	homepage, _ := url.Parse("https://contentmine.org/about?a=b")
+	s := urlTestStruct{Homepage: *homepage}
+	wikibase := NewClient(&MockNetworkClient{})
+
+	field, _ := reflect.TypeOf(s).FieldByName("Homepage")
+	data, err := wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Homepage"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if string(data) != `"https://contentmine.org/about?a=b"` {
+		t.Errorf("Got unexpected encoded data: %s", data)
+	}
+
+	// nil pointers should be no value
+	field, _ = reflect.TypeOf(s).FieldByName("Source")
+	data, err = wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Source"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if data != nil {
+		t.Errorf("Expected no data for nil URL: %s", data)
+	}
+
+	datatype, err := goTypeToWikibaseType(field)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if datatype != "url" {
+		t.Errorf("Got unexpected datatype: %s", datatype)
+	}
+}
+
+func TestRelativeURLClaimEncode(t *testing.T) {
+
+	source, _ := url.Parse("/about")
+	s := urlTestStruct{Source: source}
+	wikibase := NewClient(&MockNetworkClient{})
+
+	field, _ := reflect.TypeOf(s).FieldByName("Source")
+	_, err := wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Source"))
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+}
+
+func TestValueNormalizerOnUpload(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+	wikibase.RegisterValueNormalizer("test", func(value string) string {
+		return strings.ToUpper(strings.TrimPrefix(value, "https://doi.org/"))
+	})
+
+	item := SingleClaimTestStruct{Test: "https://doi.org/10.1000/abc "}
+	item.ID = "Q23"
+
+	err := wikibase.UploadClaimsForItem(&item, false)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.LastArgs()["value"] != `"10.1000/ABC"` {
+		t.Errorf("Unexpected value requested: %v", client.LastArgs())
+	}
+}
+
+func TestValueNormalizerOnlyForProperty(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+	wikibase.RegisterValueNormalizer("other", strings.ToUpper)
+
+	_, err := wikibase.CreateStringClaim("Q11", "test", "wot!")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.LastArgs()["value"] != `"wot!"` {
+		t.Errorf("Unexpected value requested: %v", client.LastArgs())
+	}
+
+	wikibase.RegisterValueNormalizer("test", strings.ToUpper)
+	wikibase.RegisterValueNormalizer("test", nil)
+	client.AddResponse(testClaimCreateResponse)
+	_, err = wikibase.CreateStringClaim("Q11", "test", "wot!")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.LastArgs()["value"] != `"wot!"` {
+		t.Errorf("Normalizer was not removed: %v", client.LastArgs())
+	}
+}
+
+func TestValueNormalizerOnCreate(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"aliases":{},"claims":{},"descriptions":{},"id":"Q11","labels":{"en":{"language":"en","value":"blah"}},"lastrevid":55,"sitelinks":{},"type":"item"},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["test"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+	wikibase.RegisterValueNormalizer("test", strings.ToUpper)
+
+	item := SingleClaimTestStruct{Test: "blah"}
+	err := wikibase.CreateItemInstance("blah", &item)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if !strings.Contains(client.LastArgs()["data"], `"value":"BLAH"`) {
+		t.Errorf("Value was not normalized: %v", client.LastArgs()["data"])
+	}
+}
+
+type SharedLabelTestStruct struct {
+	Name  string `property:"propname,desc=The name"`
+	Other string `property:"other"`
+	Kind  string `item:"thing"`
+}
+
+type OtherSharedLabelTestStruct struct {
+	Name string `property:"propname"`
+	Kind string `item:"thing"`
+}
+
+func TestParseStructsSharingLabels(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Property:P23","pageid":11,"displaytext":"propname"}]}}
+`)
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Property:P24","pageid":12,"displaytext":"other"}]}}
+`)
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Item:Q5","pageid":13,"displaytext":"thing"}]}}
+`)
+	wikibase := NewClient(client)
+
+	err := wikibase.MapPropertyAndItemConfiguration(SharedLabelTestStruct{}, false)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 3 {
+		t.Fatalf("Got unexpected invocation count: %v", client)
+	}
+
+	err = wikibase.MapPropertyAndItemConfiguration(OtherSharedLabelTestStruct{}, false)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 3 {
+		t.Errorf("Shared labels were looked up again: %v", client)
+	}
+	if wikibase.PropertyMap["propname"] != "P23" || wikibase.ItemMap["thing"] != "Q5" {
+		t.Errorf("Maps were wrong: %v %v", wikibase.PropertyMap, wikibase.ItemMap)
+	}
+}
+
+func TestValidatePropertyMap(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["propname"] = "P23"
+
+	err := wikibase.ValidatePropertyMap(&SimpleTestStruct{})
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	unmapped, ok := err.(*UnmappedPropertiesError)
+	if !ok {
+		t.Fatalf("We got the wrong error type: %v", err)
+	}
+	if !reflect.DeepEqual(unmapped.Labels, []string{"address"}) {
+		t.Errorf("We got the wrong unmapped labels: %v", unmapped.Labels)
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+
+	wikibase.PropertyMap["address"] = "P5"
+	err = wikibase.ValidatePropertyMap(SimpleTestStruct{})
+	if err != nil {
+		t.Errorf("We got an unexpected error: %v", err)
+	}
+}
+
+func TestFullTimeClaimYearPrecision(t *testing.T) {
+
+	claim, err := FullTimeClaimToAPIData("1066", TimePrecisionYear, "")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	expected := TimeDataClaim{
+		Time:          "+00000001066-00-00T00:00:00Z",
+		Precision:     TimePrecisionYear,
+		CalendarModel: "http://www.wikidata.org/entity/Q1985727",
+	}
+	if claim != expected {
+		t.Errorf("We got the wrong claim: %v", claim)
+	}
+
+	claim, err = FullTimeClaimToAPIData("-0500", TimePrecisionCentury, "")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if claim.Time != "-00000000500-00-00T00:00:00Z" || claim.Precision != TimePrecisionCentury {
+		t.Errorf("We got the wrong claim: %v", claim)
+	}
+}
+
+type historicalTimeTestStruct struct {
+	Died HistoricalTime `property:"date of death"`
+}
+
+func TestHistoricalTimeBCE(t *testing.T) {
+
+	claim, err := HistoricalTimeClaimToAPIData(HistoricalTime{Year: -44, Month: 3, Day: 15, Calendar: JulianCalendar})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	expected := TimeDataClaim{
+		Time:          "-00000000044-03-15T00:00:00Z",
+		Precision:     TimePrecisionDay,
+		CalendarModel: "http://www.wikidata.org/entity/Q1985786",
+	}
+	if claim != expected {
+		t.Errorf("We got the wrong claim: %v", claim)
+	}
+
+	claim, err = HistoricalTimeClaimToAPIData(HistoricalTime{Year: -3000})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if claim.Time != "-00000003000-00-00T00:00:00Z" || claim.Precision != TimePrecisionYear {
+		t.Errorf("We got the wrong claim: %v", claim)
+	}
+
+	_, err = HistoricalTimeClaimToAPIData(HistoricalTime{Year: 0})
+	if err == nil {
+		t.Errorf("We expected an error for year zero")
+	}
+	_, err = HistoricalTimeClaimToAPIData(HistoricalTime{Year: -44, Day: 15})
+	if err == nil {
+		t.Errorf("We expected an error for a day without a month")
+	}
+
+	// And as a struct field
+	wikibase := NewClient(&MockNetworkClient{})
+	s := historicalTimeTestStruct{Died: HistoricalTime{Year: -44, Month: 3, Day: 15}}
+	field, _ := reflect.TypeOf(s).FieldByName("Died")
+	data, err := wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Died"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"time":"-00000000044-03-15T00:00:00Z"`) {
+		t.Errorf("Expected BCE time in encoded data: %s", data)
+	}
+	datatype, err := goTypeToWikibaseType(field)
+	if err != nil || datatype != "time" {
+		t.Errorf("Got unexpected datatype: %s %v", datatype, err)
+	}
+	if err := ValidateStruct(s); err != nil {
+		t.Errorf("We got an unexpected error: %v", err)
+	}
+}
+
+type quantityTestStruct struct {
+	Gravity Quantity `property:"acceleration"`
+}
+
+func TestQuantityWithPrecision(t *testing.T) {
+
+	claim, err := QuantityWithPrecisionClaimToAPIData(Quantity{Amount: 9.81, Precision: 0.01, Unit: "Q11573"})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	expected := QuantityClaim{
+		Amount:     "+9.81",
+		Unit:       "http://www.wikidata.org/entity/Q11573",
+		UpperBound: "+9.82",
+		LowerBound: "+9.80",
+	}
+	if claim != expected {
+		t.Errorf("We got the wrong claim: %v", claim)
+	}
+
+	// Trailing zeros are kept to show the precision
+	claim, err = QuantityWithPrecisionClaimToAPIData(Quantity{Amount: 2, Precision: 0.05})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	expected = QuantityClaim{Amount: "+2.00", Unit: "1", UpperBound: "+2.05", LowerBound: "+1.95"}
+	if claim != expected {
+		t.Errorf("We got the wrong claim: %v", claim)
+	}
+
+	claim, err = QuantityWithPrecisionClaimToAPIData(Quantity{Amount: -1200, Precision: 50})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	expected = QuantityClaim{Amount: "-1200", Unit: "1", UpperBound: "-1150", LowerBound: "-1250"}
+	if claim != expected {
+		t.Errorf("We got the wrong claim: %v", claim)
+	}
+
+	// Exact quantities have no bounds
+	claim, err = QuantityWithPrecisionClaimToAPIData(Quantity{Amount: 1.5})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	expected = QuantityClaim{Amount: "+1.5", Unit: "1"}
+	if claim != expected {
+		t.Errorf("We got the wrong claim: %v", claim)
+	}
+
+	_, err = QuantityWithPrecisionClaimToAPIData(Quantity{Amount: 1, Precision: -0.1})
+	if err == nil {
+		t.Errorf("We expected an error for a negative precision")
+	}
+
+	// And as a struct field
+	wikibase := NewClient(&MockNetworkClient{})
+	s := quantityTestStruct{Gravity: Quantity{Amount: 9.81, Precision: 0.01}}
+	field, _ := reflect.TypeOf(s).FieldByName("Gravity")
+	data, err := wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Gravity"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if string(data) != `{"amount":"+9.81","unit":"1","upperBound":"+9.82","lowerBound":"+9.80"}` {
+		t.Errorf("We got unexpected encoded data: %s", data)
+	}
+	value, err := wikibase.getItemCreateClaimValue(field, reflect.ValueOf(s).FieldByName("Gravity"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if value.Type != "quantity" {
+		t.Errorf("We got the wrong data value type: %v", value)
+	}
+	if err := ValidateStruct(s); err != nil {
+		t.Errorf("We got an unexpected error: %v", err)
+	}
+}
+
+type booleanTestStruct struct {
+	OpenAccess bool  `property:"openaccess"`
+	Reviewed   *bool `property:"reviewed"`
+}
+
+func TestBooleanClaim(t *testing.T) {
+
+	wikibase := NewClient(&MockNetworkClient{})
+	reviewed := false
+	s := booleanTestStruct{OpenAccess: true, Reviewed: &reviewed}
+	r := reflect.TypeOf(s)
+	v := reflect.ValueOf(s)
+
+	// Without the items configured we can't encode bools
+	field, _ := r.FieldByName("OpenAccess")
+	_, err := wikibase.getDataForClaim(field, v.FieldByName("OpenAccess"))
+	if err == nil {
+		t.Errorf("We expected an error without the bool items configured")
+	}
+	_, err = wikibase.getItemCreateClaimValue(field, v.FieldByName("OpenAccess"))
+	if err == nil {
+		t.Errorf("We expected an error without the bool items configured")
+	}
+
+	wikibase.BooleanTrueItem = "Q100"
+	wikibase.BooleanFalseItem = "Q101"
+
+	for name, expected := range map[string]string{
+		"OpenAccess": `{"entity-type":"item","numeric-id":100}`,
+		"Reviewed":   `{"entity-type":"item","numeric-id":101}`,
+	} {
+		field, _ := r.FieldByName(name)
+		data, err := wikibase.getDataForClaim(field, v.FieldByName(name))
+		if err != nil {
+			t.Fatalf("We got an unexpected error for %s: %v", name, err)
+		}
+		if string(data) != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, name, data)
+		}
+
+		value, err := wikibase.getItemCreateClaimValue(field, v.FieldByName(name))
+		if err != nil {
+			t.Fatalf("We got an unexpected error for %s: %v", name, err)
+		}
+		if value.Type != "wikibase-entityid" {
+			t.Errorf("We got the wrong data value type for %s: %v", name, value)
+		}
+		encoded, _ := json.Marshal(value.Value)
+		if string(encoded) != expected {
+			t.Errorf("Expected %s for %s on create, got %s", expected, name, encoded)
+		}
+
+		datatype, err := goTypeToWikibaseType(field)
+		if err != nil || datatype != "wikibase-item" {
+			t.Errorf("Got unexpected datatype for %s: %s %v", name, datatype, err)
+		}
+	}
+
+	if err := ValidateStruct(s); err != nil {
+		t.Errorf("We got an unexpected error: %v", err)
+	}
+}
+
+func TestSetClaimByLabelBoolean(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"claims": {}}`)
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["openaccess"] = "P14"
+	wikibase.BooleanTrueItem = "Q100"
+	wikibase.BooleanFalseItem = "Q101"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetClaimByLabel("Q11", "openaccess", false)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.LastArgs()["value"] != `{"entity-type":"item","numeric-id":101}` {
+		t.Errorf("Unexpected value requested: %v", client.LastArgs())
+	}
+}
+
+func TestCreateClaimByLabelPlainValues(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["thing"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	var nil_string *string
+	values := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"wot!", `"wot!"`},
+		{ItemClaim{EntityType: "item", NumericID: 101}, `{"entity-type":"item","numeric-id":101}`},
+		{42, `42`},
+		{nil_string, ""},
+		{nil, ""},
+	}
+	for _, test := range values {
+		client.AddResponse(testClaimCreateResponse)
+		_, err := wikibase.createClaimByLabel("Q11", "thing", test.value)
+		if err != nil {
+			t.Fatalf("We got an unexpected error for %v: %v", test.value, err)
+		}
+		if client.LastArgs()["value"] != test.expected {
+			t.Errorf("Unexpected value requested for %v: %v", test.value, client.LastArgs())
+		}
+	}
+}
+
+func TestFullTimeClaimJulianCalendar(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["date of birth"] = "P14"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateTimeClaimFull("Q11", "date of birth", "1564-02-15", TimePrecisionDay, JulianCalendar)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+
+	var claim TimeDataClaim
+	err = json.Unmarshal([]byte(client.LastArgs()["value"]), &claim)
+	if err != nil {
+		t.Fatalf("Failed to decode value sent: %v", err)
+	}
+	expected := TimeDataClaim{
+		Time:          "+00000001564-02-15T00:00:00Z",
+		Precision:     TimePrecisionDay,
+		CalendarModel: "http://www.wikidata.org/entity/Q1985786",
+	}
+	if claim != expected {
+		t.Errorf("We got the wrong claim: %v", claim)
+	}
+}
+
+func TestFullTimeClaimInvalid(t *testing.T) {
+
+	inputs := []struct {
+		time      string
+		precision int
+		calendar  ItemPropertyType
+	}{
+		{"1066", TimePrecisionDay, ""},
+		{"1066-13-01", TimePrecisionDay, ""},
+		{"0000-01-01", TimePrecisionDay, ""},
+		{"14 October 1066", TimePrecisionDay, ""},
+		{"1066-10-14", 15, ""},
+		{"1066-10-14", TimePrecisionDay, "P5"},
+		{"2001-00-05", TimePrecisionDay, ""},
+		{"2001-02-29", TimePrecisionDay, ""},
+		{"2001-02-31", TimePrecisionDay, ""},
+		{"2001-04-31", TimePrecisionDay, ""},
+		{"1900-02-29", TimePrecisionDay, ""},
+		{"-0002-02-29", TimePrecisionDay, ""},
+	}
+	for _, input := range inputs {
+		_, err := FullTimeClaimToAPIData(input.time, input.precision, input.calendar)
+		if err == nil {
+			t.Errorf("We expected an error for %v", input)
+		}
+	}
+}
+
+func TestFullTimeClaimLeapDays(t *testing.T) {
+
+	inputs := []struct {
+		time     string
+		calendar ItemPropertyType
+	}{
+		{"2000-02-29", ""},
+		{"2004-02-29", ""},
+		{"1900-02-29", JulianCalendar},
+		{"-0001-02-29", ""},
+		{"2001-01-31", ""},
+		{"2001-12-31", ""},
+	}
+	for _, input := range inputs {
+		_, err := FullTimeClaimToAPIData(input.time, TimePrecisionDay, input.calendar)
+		if err != nil {
+			t.Errorf("Got unexpected error for %v: %v", input, err)
+		}
+	}
+}
+
+func TestFullTimeClaimUsesClientPrefixes(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.PropertyMap["date of birth"] = "P14"
+	wikibase.EntityTypePrefixes = map[string]string{"I": "item", "P": "property"}
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateTimeClaimFull("I11", "date of birth", "1564-02-15", TimePrecisionDay, "Q1985786")
+	if err == nil {
+		t.Fatalf("We expected an error for a calendar not using the client's prefixes")
+	}
+
+	client.AddResponse(testClaimCreateResponse)
+	_, err = wikibase.CreateTimeClaimFull("I11", "date of birth", "1564-02-15", TimePrecisionDay, "I7")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !strings.Contains(client.LastArgs()["value"], `"calendarmodel":"http://www.wikidata.org/entity/I7"`) {
+		t.Errorf("Unexpected value requested: %v", client.LastArgs())
+	}
+}
+
+type ManyLabelsTestStruct struct {
+	First  string `property:"first"`
+	Second string `property:"second"`
+	Third  string `property:"third"`
+	Kind   string `item:"thing"`
+}
+
+func TestMapAllPropertyAndItemConfiguration(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Property:P1","pageid":11,"displaytext":"first"}]}}
+`)
+	client.AddError(fmt.Errorf("Connection reset"))
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Property:P3","pageid":13,"displaytext":"third"}]}}
+`)
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Item:Q4","pageid":14,"displaytext":"thing"}]}}
+`)
+	wikibase := NewClient(client)
+
+	err := wikibase.MapAllPropertyAndItemConfiguration(ManyLabelsTestStruct{}, false)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	mapping_err, ok := err.(*MappingErrors)
+	if !ok {
+		t.Fatalf("We got the wrong error type: %v", err)
+	}
+	if len(mapping_err.Errors) != 1 || mapping_err.Errors["second"] == nil {
+		t.Errorf("We got the wrong failures: %v", mapping_err.Errors)
+	}
+	if client.InvocationCount != 4 {
+		t.Errorf("Expected every label to be tried: %v", client)
+	}
+	if wikibase.PropertyMap["first"] != "P1" || wikibase.PropertyMap["third"] != "P3" || wikibase.ItemMap["thing"] != "Q4" {
+		t.Errorf("Successful lookups were not stored: %v %v", wikibase.PropertyMap, wikibase.ItemMap)
+	}
+
+	// Trying again only looks up the label that failed
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Property:P2","pageid":12,"displaytext":"second"}]}}
+`)
+	err = wikibase.MapAllPropertyAndItemConfiguration(ManyLabelsTestStruct{}, false)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 5 || wikibase.PropertyMap["second"] != "P2" {
+		t.Errorf("Retry did not map the failed label: %v %v", client, wikibase.PropertyMap)
+	}
+}
+
+type ValidModelTestStruct struct {
+	ItemHeader
+
+	Name     string           `property:"name,desc=The name"`
+	Born     time.Time        `property:"birth date|date of birth,inferprecision,omitoncreate"`
+	Died     *time.Time       `property:"date of death,precision=year"`
+	Children int              `property:"number of children,novalue"`
+	Parent   ItemPropertyType `property:"parent"`
+	Nickname string           `property:"name"`
+	Aliases  []string         `alias:"fr"`
+	Kind     string           `item:"human"`
+	Unused   float64
+}
+
+func TestValidateStruct(t *testing.T) {
+
+	err := ValidateStruct(ValidModelTestStruct{})
+	if err != nil {
+		t.Errorf("We got an unexpected error: %v", err)
+	}
+	err = ValidateStruct(&ValidModelTestStruct{})
+	if err != nil {
+		t.Errorf("We got an unexpected error: %v", err)
+	}
+}
+
+func TestValidateStructInvalid(t *testing.T) {
+
+	cases := []struct {
+		name  string
+		model interface{}
+	}{
+		{"unsupported type", struct {
+			Value complex128 `property:"value"`
+		}{}},
+		{"empty label", struct {
+			Value string `property:",omitoncreate"`
+		}{}},
+		{"empty fallback label", struct {
+			Value string `property:"birth date|"`
+		}{}},
+		{"unknown option", struct {
+			Value string `property:"value,omitoncraete"`
+		}{}},
+		{"precision on non-time", struct {
+			Value int `property:"value,precision=year"`
+		}{}},
+		{"two precisions", struct {
+			Value time.Time `property:"value,precision=year,inferprecision"`
+		}{}},
+		{"conflicting datatypes", struct {
+			Value string `property:"value"`
+			Other int    `property:"value"`
+		}{}},
+		{"bad alias field", struct {
+			Names string `alias:""`
+		}{}},
+		{"empty item tag", struct {
+			Kind string `item:""`
+		}{}},
+		{"not a struct", "hello"},
+	}
+
+	for _, c := range cases {
+		if err := ValidateStruct(c.model); err == nil {
+			t.Errorf("We expected an error for %s", c.name)
+		}
+	}
+}
+
+type monolingualTextTestStruct struct {
+	Motto   MonolingualText `property:"motto"`
+	Address MonolingualText `property:"address,raw"`
+}
+
+func TestMonolingualTextRawAndNormalized(t *testing.T) {
+
+	text := "Roses are red,\n  violets are blue"
+
+	claim, err := MonolingualTextClaimToAPIData(MonolingualText{Text: text, Language: "en"}, false)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if claim.Text != "Roses are red, violets are blue" || claim.Language != "en" {
+		t.Errorf("We got the wrong normalized claim: %v", claim)
+	}
+
+	claim, err = MonolingualTextClaimToAPIData(MonolingualText{Text: text, Language: "en"}, true)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if claim.Text != text {
+		t.Errorf("We got the wrong raw claim: %v", claim)
+	}
+
+	claim, err = MonolingualTextClaimToAPIData(MonolingualText{Text: " \n ", Language: "en"}, true)
+	if err != nil || claim != nil {
+		t.Errorf("Expected whitespace only text to be no value: %v %v", claim, err)
+	}
+	_, err = MonolingualTextClaimToAPIData(MonolingualText{Text: text}, false)
+	if err == nil {
+		t.Errorf("We expected an error for text with no language")
+	}
+
+	// As struct fields, the raw clause applies only to its own field, and the client's language is the default
+	wikibase := NewClient(&MockNetworkClient{})
+	wikibase.Language = "fr"
+	s := monolingualTextTestStruct{
+		Motto:   MonolingualText{Text: text},
+		Address: MonolingualText{Text: "1 Rue de Rivoli\n75001 Paris", Language: "fr"},
+	}
+	field, _ := reflect.TypeOf(s).FieldByName("Motto")
+	data, err := wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Motto"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if string(data) != `{"text":"Roses are red, violets are blue","language":"fr"}` {
+		t.Errorf("We got unexpected normalized data: %s", data)
+	}
+	field, _ = reflect.TypeOf(s).FieldByName("Address")
+	data, err = wikibase.getDataForClaim(field, reflect.ValueOf(s).FieldByName("Address"))
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if string(data) != `{"text":"1 Rue de Rivoli\n75001 Paris","language":"fr"}` {
+		t.Errorf("We got unexpected raw data: %s", data)
+	}
+
+	datatype, err := goTypeToWikibaseType(field)
+	if err != nil || datatype != "monolingualtext" {
+		t.Errorf("Got unexpected datatype: %s %v", datatype, err)
+	}
+	if err := ValidateStruct(s); err != nil {
+		t.Errorf("We got an unexpected error: %v", err)
+	}
+}
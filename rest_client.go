@@ -0,0 +1,245 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RESTNetworkClient is a NetworkClientInterface that makes requests the library would make to the action API using
+// the Wikibase REST API instead where it can, and passes all other requests to a fallback client. Reads of the info,
+// labels, descriptions, aliases, and sitelinks of items and properties are made with the REST API, with one request
+// per entity when several are asked for at once, as by FetchTerms. Reads that include claims, such as GetEntity and
+// GetClaims, and all writes go to the fallback client. The REST API does not give the page title of an entity, so
+// that is left out of translated info.
+type RESTNetworkClient struct {
+	// The base URL of the Wikibase REST API, e.g. "https://www.wikidata.org/w/rest.php/wikibase/v1".
+	RESTURL string
+
+	// If greater than zero, REST requests that take longer than this will fail.
+	Timeout time.Duration
+
+	fallback NetworkClientInterface
+}
+
+// NewRESTNetworkClient creates a client that uses the Wikibase REST API on the server at urlbase where possible, and
+// the fallback client, usually an OAuthNetworkClient, for everything else.
+func NewRESTNetworkClient(urlbase string, fallback NetworkClientInterface) *RESTNetworkClient {
+	return &RESTNetworkClient{
+		RESTURL:  fmt.Sprintf("%s/w/rest.php/wikibase/v1", urlbase),
+		fallback: fallback,
+	}
+}
+
+// restEntity is the subset of the REST API representation of an item or property that we translate.
+type restEntity struct {
+	ID           ItemPropertyType        `json:"id"`
+	Type         string                  `json:"type"`
+	Labels       map[string]string       `json:"labels"`
+	Descriptions map[string]string       `json:"descriptions"`
+	Aliases      map[string][]string     `json:"aliases"`
+	Sitelinks    map[string]sitelinkInfo `json:"sitelinks"`
+}
+
+// restEntityPaths returns the REST API path for each of the requested entities if the arguments are a request that
+// can be made with the REST API, or nil if not.
+func restEntityPaths(args map[string]string) []string {
+
+	if args["action"] != "wbgetentities" {
+		return nil
+	}
+	for key := range args {
+		switch key {
+		case "action", "ids", "props", "languages", "format":
+		default:
+			return nil
+		}
+	}
+
+	// Without props the action API returns claims too
+	if len(args["props"]) == 0 {
+		return nil
+	}
+	for _, prop := range strings.Split(args["props"], "|") {
+		switch prop {
+		case "info", "labels", "descriptions", "aliases", "sitelinks", "sitelinks/urls":
+		default:
+			return nil
+		}
+	}
+
+	ids := strings.Split(args["ids"], "|")
+	paths := make([]string, len(ids))
+	for index, id := range ids {
+		if len(id) < 2 {
+			return nil
+		}
+		switch id[0] {
+		case 'Q':
+			paths[index] = "/entities/items/" + url.PathEscape(id)
+		case 'P':
+			paths[index] = "/entities/properties/" + url.PathEscape(id)
+		default:
+			return nil
+		}
+	}
+	return paths
+}
+
+// restRevisionID returns the revision ID of the entity from the ETag header of a REST API response, or zero if the
+// header is missing or not a revision ID.
+func restRevisionID(header http.Header) int {
+	tag := strings.TrimPrefix(header.Get("ETag"), "W/")
+	revision, err := strconv.Atoi(strings.Trim(tag, `"`))
+	if err != nil {
+		return 0
+	}
+	return revision
+}
+
+// translateRESTEntity converts a REST API entity into the wbgetentities form of the entity with the requested ID,
+// with just the parts in props, and only the terms in the languages given, if any.
+func translateRESTEntity(requested_id string, entity restEntity, revision int, props map[string]bool,
+	languages map[string]bool) itemEntity {
+
+	wanted := func(language string) bool {
+		return len(languages) == 0 || languages[language]
+	}
+
+	res := itemEntity{
+		ID:   entity.ID,
+		Type: entity.Type,
+	}
+	if props["info"] {
+		res.LastRevisionID = revision
+	}
+	if props["labels"] {
+		res.Labels = make(map[string]itemLabel, len(entity.Labels))
+		for language, value := range entity.Labels {
+			if wanted(language) {
+				res.Labels[language] = itemLabel{Language: language, Value: value}
+			}
+		}
+	}
+	if props["descriptions"] {
+		res.Descriptions = make(map[string]itemLabel, len(entity.Descriptions))
+		for language, value := range entity.Descriptions {
+			if wanted(language) {
+				res.Descriptions[language] = itemLabel{Language: language, Value: value}
+			}
+		}
+	}
+	if props["aliases"] {
+		res.Aliases = make(map[string][]itemLabel, len(entity.Aliases))
+		for language, values := range entity.Aliases {
+			if !wanted(language) {
+				continue
+			}
+			for _, value := range values {
+				res.Aliases[language] = append(res.Aliases[language], itemLabel{Language: language, Value: value})
+			}
+		}
+	}
+	if props["sitelinks"] || props["sitelinks/urls"] {
+		res.Sitelinks = make(map[string]sitelinkInfo, len(entity.Sitelinks))
+		for site, link := range entity.Sitelinks {
+			link.Site = site
+			if !props["sitelinks/urls"] {
+				link.URL = ""
+			}
+			res.Sitelinks[site] = link
+		}
+	}
+	if string(entity.ID) != requested_id {
+		// The REST API redirects merged entities to their target
+		res.Redirects = &entityRedirect{From: ItemPropertyType(requested_id), To: entity.ID}
+	}
+
+	return res
+}
+
+// getEntity fetches a single entity from the REST API and translates it as for translateRESTEntity.
+func (client *RESTNetworkClient) getEntity(path string, requested_id string, props map[string]bool,
+	languages map[string]bool) (itemEntity, error) {
+
+	http_client := http.Client{Timeout: client.Timeout}
+	response, err := http_client.Get(client.RESTURL + path)
+	if err != nil {
+		return itemEntity{}, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		var entity restEntity
+		err = json.NewDecoder(response.Body).Decode(&entity)
+		if err != nil {
+			return itemEntity{}, err
+		}
+		return translateRESTEntity(requested_id, entity, restRevisionID(response.Header), props, languages), nil
+	case http.StatusNotFound:
+		missing := ""
+		return itemEntity{ID: ItemPropertyType(requested_id), Missing: &missing}, nil
+	default:
+		return itemEntity{}, newHTTPError(response)
+	}
+}
+
+func (client *RESTNetworkClient) Get(args map[string]string) (io.ReadCloser, error) {
+
+	paths := restEntityPaths(args)
+	if paths == nil {
+		return client.fallback.Get(args)
+	}
+
+	props := make(map[string]bool)
+	for _, prop := range strings.Split(args["props"], "|") {
+		props[prop] = true
+	}
+	languages := make(map[string]bool)
+	if len(args["languages"]) > 0 {
+		for _, language := range strings.Split(args["languages"], "|") {
+			languages[language] = true
+		}
+	}
+
+	entities := make(map[string]itemEntity, len(paths))
+	for index, id := range strings.Split(args["ids"], "|") {
+		entity, err := client.getEntity(paths[index], id, props, languages)
+		if err != nil {
+			return nil, err
+		}
+		entities[id] = entity
+	}
+
+	data, err := json.Marshal(getEntitiesResponse{Entities: entities, Success: 1})
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (client *RESTNetworkClient) Post(args map[string]string) (io.ReadCloser, error) {
+	return client.fallback.Post(args)
+}
@@ -0,0 +1,260 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newTestRESTServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/w/rest.php/wikibase/v1/entities/items/Q42":
+			w.Header().Set("ETag", `"1597"`)
+			fmt.Fprint(w, `{"id":"Q42","type":"item","labels":{"en":"Douglas Adams","fr":"Douglas Adams"},
+				"descriptions":{"en":"English writer"},"aliases":{"en":["Douglas Noel Adams","DNA"]},"statements":{},
+				"sitelinks":{"enwiki":{"title":"Douglas Adams","badges":[],"url":"https://en.wikipedia.org/wiki/Douglas_Adams"}}}`)
+		case "/w/rest.php/wikibase/v1/entities/items/Q43":
+			http.Redirect(w, r, "/w/rest.php/wikibase/v1/entities/items/Q42", http.StatusPermanentRedirect)
+		case "/w/rest.php/wikibase/v1/entities/properties/P31":
+			w.Header().Set("ETag", `W/"1601"`)
+			fmt.Fprint(w, `{"id":"P31","type":"property","data_type":"wikibase-item","labels":{"en":"instance of"},"descriptions":{}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":"item-not-found","message":"Could not find an item with the ID"}`)
+		}
+	}))
+}
+
+func TestRESTNetworkClientGetEntity(t *testing.T) {
+
+	server := newTestRESTServer()
+	defer server.Close()
+
+	fallback := &MockNetworkClient{}
+	wikibase := NewClient(NewRESTNetworkClient(server.URL, fallback))
+
+	sitelinks, err := wikibase.GetSitelinks("Q42")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if sitelinks["enwiki"] != "Douglas Adams" {
+		t.Errorf("Got wrong sitelinks: %v", sitelinks)
+	}
+
+	entity, err := wikibase.getEntity("P31", "labels|descriptions")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if entity.Labels["en"].Value != "instance of" || entity.Type != "property" {
+		t.Errorf("Got wrong property: %v", entity)
+	}
+
+	if fallback.InvocationCount != 0 {
+		t.Errorf("Fallback client should not have been used: %v", fallback)
+	}
+}
+
+func TestRESTNetworkClientFetchTerms(t *testing.T) {
+
+	server := newTestRESTServer()
+	defer server.Close()
+
+	fallback := &MockNetworkClient{}
+	wikibase := NewClient(NewRESTNetworkClient(server.URL, fallback))
+
+	terms, err := wikibase.FetchTerms([]ItemPropertyType{"Q42", "P31", "Q999"}, []string{"en"})
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(terms) != 2 {
+		t.Fatalf("Expected terms for the two entities that exist: %v", terms)
+	}
+	if terms["Q42"].Labels["en"] != "Douglas Adams" || terms["Q42"].Descriptions["en"] != "English writer" {
+		t.Errorf("Got wrong terms for Q42: %v", terms["Q42"])
+	}
+	if _, ok := terms["Q42"].Labels["fr"]; ok {
+		t.Errorf("Expected terms to be limited to the languages asked for: %v", terms["Q42"])
+	}
+	if terms["P31"].Labels["en"] != "instance of" {
+		t.Errorf("Got wrong terms for P31: %v", terms["P31"])
+	}
+
+	if fallback.InvocationCount != 0 {
+		t.Errorf("Fallback client should not have been used: %v", fallback)
+	}
+}
+
+func TestRESTNetworkClientRevisionAndAliases(t *testing.T) {
+
+	server := newTestRESTServer()
+	defer server.Close()
+
+	fallback := &MockNetworkClient{}
+	wikibase := NewClient(NewRESTNetworkClient(server.URL, fallback))
+
+	item := AliasTestStruct{}
+	item.ID = "Q42"
+	err := wikibase.RefreshLastRevID(&item)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if item.LastRevID != 1597 {
+		t.Errorf("Expected the revision from the ETag header, got %d", item.LastRevID)
+	}
+
+	err = wikibase.RefreshAliases(&item)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(item.Names, []string{"Douglas Noel Adams", "DNA"}) || len(item.FrenchNames) != 0 {
+		t.Errorf("Got wrong aliases: %v", item)
+	}
+
+	if fallback.InvocationCount != 0 {
+		t.Errorf("Fallback client should not have been used: %v", fallback)
+	}
+}
+
+func TestRESTNetworkClientEntityHistory(t *testing.T) {
+
+	server := newTestRESTServer()
+	defer server.Close()
+
+	fallback := &MockNetworkClient{}
+	fallback.AddResponse(`
+{"batchcomplete":"","query":{"pages":{"20":{"pageid":20,"ns":0,"title":"Q42","revisions":[
+    {"revid":1597,"parentid":0,"user":"ContentMineBot","timestamp":"2018-05-02T13:03:21Z","comment":"created"}
+]}}}}
+`)
+	wikibase := NewClient(NewRESTNetworkClient(server.URL, fallback))
+	wikibase.EntityNamespaces = map[string]string{"item": "", "property": "Property"}
+
+	revisions, err := wikibase.GetEntityHistory("Q42", 0)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(revisions) != 1 || revisions[0].RevID != 1597 {
+		t.Errorf("Got wrong revisions: %v", revisions)
+	}
+	if fallback.InvocationCount != 1 || fallback.LastArgs()["titles"] != "Q42" {
+		t.Errorf("Expected the history to be read with the page title from the namespace config: %v",
+			fallback.LastArgs())
+	}
+}
+
+func TestRESTNetworkClientRedirect(t *testing.T) {
+
+	server := newTestRESTServer()
+	defer server.Close()
+
+	wikibase := NewClient(NewRESTNetworkClient(server.URL, &MockNetworkClient{}))
+
+	entity, err := wikibase.getEntity("Q43", "labels")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if entity.ID != "Q42" || entity.Redirects == nil || entity.Redirects.From != "Q43" {
+		t.Errorf("Redirect was not reported: %v", entity)
+	}
+}
+
+func TestRESTNetworkClientMissing(t *testing.T) {
+
+	server := newTestRESTServer()
+	defer server.Close()
+
+	wikibase := NewClient(NewRESTNetworkClient(server.URL, &MockNetworkClient{}))
+
+	_, err := wikibase.GetSitelinks("Q999")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+}
+
+func TestRESTNetworkClientFallback(t *testing.T) {
+
+	server := newTestRESTServer()
+	defer server.Close()
+
+	fallback := &MockNetworkClient{}
+	fallback.AddResponse(`{"claims":{}}`)
+	fallback.AddResponse(`{"success":1,"entity":{"id":"Q42","type":"item","labels":{"en":{"language":"en","value":"hello"}},"lastrevid":5}}`)
+	wikibase := NewClient(NewRESTNetworkClient(server.URL, fallback))
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.GetClaims("Q42")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if fallback.LastArgs()["action"] != "wbgetclaims" {
+		t.Errorf("Expected claims read to use fallback: %v", fallback.LastArgs())
+	}
+
+	err = wikibase.SetLabel("Q42", "en", "hello")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if fallback.LastArgs()["action"] != "wbsetlabel" {
+		t.Errorf("Expected writes to use fallback: %v", fallback.LastArgs())
+	}
+	if fallback.InvocationCount != 2 {
+		t.Errorf("Got unexpected invocation count: %v", fallback)
+	}
+}
+
+func TestRESTEntityPaths(t *testing.T) {
+
+	tests := []struct {
+		args     map[string]string
+		expected []string
+	}{
+		{map[string]string{"action": "wbgetentities", "ids": "Q42", "props": "labels"},
+			[]string{"/entities/items/Q42"}},
+		{map[string]string{"action": "wbgetentities", "ids": "P31", "props": "info|labels|sitelinks/urls"},
+			[]string{"/entities/properties/P31"}},
+		{map[string]string{"action": "wbgetentities", "ids": "Q42|P31", "props": "labels|descriptions",
+			"languages": "en|fr"}, []string{"/entities/items/Q42", "/entities/properties/P31"}},
+		{map[string]string{"action": "wbgetentities", "ids": "Q42", "props": "info|claims"}, nil},
+		{map[string]string{"action": "wbgetentities", "ids": "Q42"}, nil},
+		{map[string]string{"action": "wbgetentities", "ids": "Q42|L1", "props": "labels"}, nil},
+		{map[string]string{"action": "wbgetentities", "ids": "Q42", "props": "labels", "revids": "5"}, nil},
+		{map[string]string{"action": "wbgetclaims", "entity": "Q42"}, nil},
+	}
+
+	for _, test := range tests {
+		paths := restEntityPaths(test.args)
+		if !reflect.DeepEqual(paths, test.expected) {
+			t.Errorf("Got %v for %v, expected %v", paths, test.args, test.expected)
+		}
+	}
+}
+
+func TestRESTRevisionID(t *testing.T) {
+
+	tests := map[string]int{`"1597"`: 1597, `W/"1601"`: 1601, "": 0, `"abc"`: 0}
+	for tag, expected := range tests {
+		header := http.Header{}
+		header.Set("ETag", tag)
+		if revision := restRevisionID(header); revision != expected {
+			t.Errorf("Got %d for %s, expected %d", revision, tag, expected)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Names of the metrics reported to Client.Metrics.
+const (
+	// Reported with a value of 1 each time a write is retried, with the cause as a suffix, e.g. "retry.maxlag".
+	MetricRetry = "retry"
+
+	// Reported with the number of retries a write needed, when it needed at least one.
+	MetricRetriesPerWrite = "retries_per_write"
+
+	// Reported with a value of 1 when a write fails because it used up all of Client.MaxRetries.
+	MetricRetryBudgetExhausted = "retry_budget_exhausted"
+
+	// Reported with a value of 1 when a write is not retried because the check before retrying found that an earlier
+	// attempt had taken effect on the server.
+	MetricRetryAlreadyApplied = "retry_already_applied"
+
+	// Reported with the current limit on writes in flight when Client.AdaptiveConcurrency changes it.
+	MetricWriteConcurrency = "write_concurrency"
+)
+
+// Causes of retries, used as the suffix of MetricRetry.
+const (
+	retryCauseNetwork = "network"
+	retryCauseHTTP    = "http"
+	retryCauseMaxLag  = "maxlag"
+	retryCauseLimit   = "ratelimited"
+)
+
+func (c *Client) reportMetric(name string, value int) {
+	if c.Metrics != nil {
+		c.Metrics(name, value)
+	}
+}
+
+// rejectedBeforeCommit returns whether the error is an HTTP response the server gives before making any changes,
+// either a 429 or a 503 saying when to try again.
+func rejectedBeforeCommit(err error) bool {
+	herr, ok := err.(*HTTPError)
+	if !ok {
+		return false
+	}
+	return herr.StatusCode == http.StatusTooManyRequests ||
+		(herr.StatusCode == http.StatusServiceUnavailable && herr.RetryAfter > 0)
+}
+
+// retryCauseForError returns why a failed request should be retried, or an empty string if it should not be. The
+// server may have committed the write before a network error or any other 5xx response, so those are only retried
+// if checked is set, meaning the write can be checked for having taken effect before it is retried.
+func retryCauseForError(err error, checked bool) string {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ""
+	}
+	if herr, ok := err.(*HTTPError); ok {
+		if rejectedBeforeCommit(err) || (checked && herr.StatusCode >= 500) {
+			return retryCauseHTTP
+		}
+		return ""
+	}
+	if checked {
+		return retryCauseNetwork
+	}
+	return ""
+}
+
+// retryCauseForResponse returns why a request with the given response body should be retried, or an empty string
+// if it should not be.
+func retryCauseForResponse(body []byte) string {
+	var res struct {
+		Error *APIError `json:"error"`
+	}
+	if json.Unmarshal(body, &res) != nil || res.Error == nil {
+		return ""
+	}
+	switch res.Error.Code {
+	case "maxlag":
+		return retryCauseMaxLag
+	case "ratelimited":
+		return retryCauseLimit
+	default:
+		return ""
+	}
+}
+
+// retryCheck is called before retrying a write that may have been committed by the server even though the client
+// did not get a response, such as after a timeout. If the earlier attempt did take effect, it returns a response body
+// equivalent to the one the server would have sent, which is used rather than retrying. Otherwise it returns nil.
+type retryCheck func() ([]byte, error)
+
+// postWithRetries makes the request, retrying up to MaxRetries times in total whatever the cause of each failure,
+// so that a struggling server doesn't get a storm of retries. The response is read into memory so that it can be
+// checked for errors that should be retried. Without a check, only rejections the server gives before making any
+// changes are retried. If check is not nil, network errors and 5xx responses are retried too, and it is called before
+// each of those retries to see if the failed attempt took effect. If the server asks for a longer wait than the
+// current delay with a Retry-After header, that is used instead.
+func (c *Client) postWithRetries(args map[string]string, check retryCheck) (io.ReadCloser, error) {
+
+	delay := c.RetryDelay
+	retries := 0
+	for {
+		var body []byte
+		response, err := c.client.Post(args)
+		if err == nil {
+			body, err = ioutil.ReadAll(response)
+			response.Close()
+		}
+
+		cause := ""
+		if err != nil {
+			cause = retryCauseForError(err, check != nil)
+		} else {
+			cause = retryCauseForResponse(body)
+			c.adjustWriteConcurrency(cause == retryCauseMaxLag)
+		}
+
+		if len(cause) == 0 || retries >= c.MaxRetries {
+			if retries > 0 {
+				c.reportMetric(MetricRetriesPerWrite, retries)
+			}
+			if len(cause) > 0 && c.MaxRetries > 0 {
+				c.reportMetric(MetricRetryBudgetExhausted, 1)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+
+		if check != nil && cause != retryCauseMaxLag && cause != retryCauseLimit && !rejectedBeforeCommit(err) {
+			existing, check_err := check()
+			if check_err != nil {
+				return nil, check_err
+			}
+			if existing != nil {
+				if retries > 0 {
+					c.reportMetric(MetricRetriesPerWrite, retries)
+				}
+				c.reportMetric(MetricRetryAlreadyApplied, 1)
+				return ioutil.NopCloser(bytes.NewReader(existing)), nil
+			}
+		}
+
+		retries += 1
+		c.reportMetric(MetricRetry+"."+cause, 1)
+		wait := delay
+		if herr, ok := err.(*HTTPError); ok && herr.RetryAfter > wait {
+			wait = herr.RetryAfter
+		}
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
@@ -0,0 +1,527 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testMaxLagResponse = `{"error":{"code":"maxlag","info":"Waiting for 10.64.48.23: 7 seconds lagged","host":"10.64.48.23","lag":7}}`
+
+const testArticleEditResponse = `{"edit":{"result":"Success","pageid":94,"title":"Article:Hello","contentmodel":"wikitext","newrevid":371}}`
+
+type testMetrics struct {
+	lock   sync.Mutex
+	values map[string][]int
+}
+
+func (m *testMetrics) record(name string, value int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.values == nil {
+		m.values = make(map[string][]int)
+	}
+	m.values[name] = append(m.values[name], value)
+}
+
+func TestRetriesAcrossCauses(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddError(&HTTPError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable",
+		RetryAfter: time.Millisecond})
+	client.AddResponse(testMaxLagResponse)
+	client.AddResponse(testRateLimitedResponse)
+	client.AddResponse(testArticleEditResponse)
+	wikibase := NewClient(client)
+	wikibase.MaxRetries = 3
+	wikibase.MaxLag = 5
+	metrics := &testMetrics{}
+	wikibase.Metrics = metrics.record
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	id, err := wikibase.CreateOrUpdateArticle("Hello", "world")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if id != 94 {
+		t.Errorf("Got wrong page ID: %d", id)
+	}
+	if client.InvocationCount != 4 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+	if client.LastArgs()["maxlag"] != "5" {
+		t.Errorf("Expected maxlag to be sent: %v", client.LastArgs())
+	}
+
+	for _, name := range []string{"retry.http", "retry.maxlag", "retry.ratelimited"} {
+		if len(metrics.values[name]) != 1 {
+			t.Errorf("Expected one %s metric: %v", name, metrics.values)
+		}
+	}
+	if len(metrics.values[MetricRetriesPerWrite]) != 1 || metrics.values[MetricRetriesPerWrite][0] != 3 {
+		t.Errorf("Expected retries per write to be reported: %v", metrics.values)
+	}
+	if len(metrics.values[MetricRetryBudgetExhausted]) != 0 {
+		t.Errorf("Did not expect budget to be exhausted: %v", metrics.values)
+	}
+}
+
+func TestRetryBudgetCapsAttempts(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddError(&HTTPError{StatusCode: http.StatusTooManyRequests, Status: "429 Too Many Requests"})
+	client.AddResponse(testMaxLagResponse)
+	client.AddError(&HTTPError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable",
+		RetryAfter: time.Millisecond})
+	client.AddResponse(testArticleEditResponse)
+	wikibase := NewClient(client)
+	wikibase.MaxRetries = 2
+	metrics := &testMetrics{}
+	wikibase.Metrics = metrics.record
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateOrUpdateArticle("Hello", "world")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if herr, ok := err.(*HTTPError); !ok || herr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected the last error to be returned, got %T: %v", err, err)
+	}
+	if client.InvocationCount != 3 {
+		t.Errorf("Expected budget to cap attempts at 3, got %d", client.InvocationCount)
+	}
+	if len(metrics.values[MetricRetryBudgetExhausted]) != 1 {
+		t.Errorf("Expected budget exhaustion to be reported: %v", metrics.values)
+	}
+}
+
+func TestRetryBudgetReturnsLastAPIError(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testMaxLagResponse)
+	client.AddResponse(testMaxLagResponse)
+	wikibase := NewClient(client)
+	wikibase.MaxRetries = 1
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateOrUpdateArticle("Hello", "world")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if aerr, ok := err.(*APIError); !ok || aerr.Code != "maxlag" {
+		t.Errorf("Expected the maxlag error to be returned, got %T: %v", err, err)
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddError(&HTTPError{StatusCode: http.StatusForbidden, Status: "403 Forbidden"})
+	wikibase := NewClient(client)
+	wikibase.MaxRetries = 3
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateOrUpdateArticle("Hello", "world")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestNoRetryOnUncheckedFailure(t *testing.T) {
+
+	failures := []error{
+		fmt.Errorf("Timeout awaiting response headers"),
+		&HTTPError{StatusCode: http.StatusGatewayTimeout, Status: "504 Gateway Timeout"},
+		&HTTPError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"},
+	}
+	for _, failure := range failures {
+		client := &MockNetworkClient{}
+		client.AddError(failure)
+		wikibase := NewClient(client)
+		wikibase.MaxRetries = 3
+		token := "insertokenhere"
+		wikibase.editToken = &token
+
+		item := SimpleItemTestStruct{}
+		err := wikibase.CreateItemInstance("blah", &item)
+		if err != failure {
+			t.Errorf("Expected the failure to be returned, got %v", err)
+		}
+		if client.InvocationCount != 1 {
+			t.Errorf("Expected item creation not to be retried after %v, got %d invocations", failure,
+				client.InvocationCount)
+		}
+		if client.LastArgs()["new"] != "item" {
+			t.Errorf("Unexpected request: %v", client.LastArgs())
+		}
+	}
+}
+
+func TestNoRetryOnContextError(t *testing.T) {
+
+	for _, failure := range []error{context.Canceled, context.DeadlineExceeded} {
+		wrapped := fmt.Errorf("Post failed: %w", failure)
+		if cause := retryCauseForError(wrapped, true); cause != "" {
+			t.Errorf("Expected %v not to be retried, got cause %s", wrapped, cause)
+		}
+	}
+}
+
+func TestAdaptiveConcurrencyUnderMaxLag(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	for i := 0; i < 4; i++ {
+		client.AddResponse(testMaxLagResponse)
+	}
+	for i := 0; i < 3; i++ {
+		client.AddResponse(testArticleEditResponse)
+	}
+	wikibase := NewClient(client)
+	wikibase.MaxConcurrentWrites = 8
+	wikibase.AdaptiveConcurrency = true
+	metrics := &testMetrics{}
+	wikibase.Metrics = metrics.record
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	// Sustained maxlag pressure halves the limit each time, down to a single write
+	for i := 0; i < 4; i++ {
+		_, err := wikibase.CreateOrUpdateArticle("Hello", "world")
+		if aerr, ok := err.(*APIError); !ok || aerr.Code != "maxlag" {
+			t.Fatalf("Expected the maxlag error to be returned, got %T: %v", err, err)
+		}
+	}
+	if !reflect.DeepEqual(metrics.values[MetricWriteConcurrency], []int{4, 2, 1}) {
+		t.Errorf("Expected concurrency to be driven down: %v", metrics.values)
+	}
+	if len(metrics.values[MetricRetryBudgetExhausted]) != 0 {
+		t.Errorf("Did not expect budget exhaustion without retries: %v", metrics.values)
+	}
+
+	// Once the pressure subsides it ramps back up after each window of successful writes
+	for i := 0; i < 3; i++ {
+		_, err := wikibase.CreateOrUpdateArticle("Hello", "world")
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+	}
+	if !reflect.DeepEqual(metrics.values[MetricWriteConcurrency], []int{4, 2, 1, 2, 3}) {
+		t.Errorf("Expected concurrency to ramp back up: %v", metrics.values)
+	}
+	if wikibase.writesInFlight != 0 {
+		t.Errorf("Expected all write slots to be released, got %d", wikibase.writesInFlight)
+	}
+}
+
+func TestClaimCreateRetryFindsCommittedClaim(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddError(fmt.Errorf("Timeout awaiting response headers"))
+	client.AddResponse(`
+{"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"other","type":"string"}},
+     "type":"statement","id":"Q11$OTHER","rank":"normal"},
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"wot!","type":"string"}},
+     "type":"statement","id":"Q11$COMMITTED","rank":"normal"}
+]}}
+`)
+	wikibase := NewClient(client)
+	wikibase.MaxRetries = 2
+	metrics := &testMetrics{}
+	wikibase.Metrics = metrics.record
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	id, err := wikibase.CreateClaimOnItem("Q11", "P14", []byte(`"wot!"`))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if id != "Q11$COMMITTED" {
+		t.Errorf("Expected the committed claim to be found, got %s", id)
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Expected no second create attempt, got %d invocations", client.InvocationCount)
+	}
+	if client.LastArgs()["action"] != "wbgetclaims" || client.LastArgs()["property"] != "P14" {
+		t.Errorf("Unexpected check request: %v", client.LastArgs())
+	}
+	if len(metrics.values[MetricRetryAlreadyApplied]) != 1 || len(metrics.values["retry.network"]) != 0 {
+		t.Errorf("Expected the skipped retry to be reported: %v", metrics.values)
+	}
+}
+
+func TestClaimCreateRetryWhenNotCommitted(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddError(&HTTPError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"})
+	client.AddResponse(`
+{"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"other","type":"string"}},
+     "type":"statement","id":"Q11$OTHER","rank":"normal"}
+]}}
+`)
+	client.AddResponse(testClaimCreateResponse)
+	wikibase := NewClient(client)
+	wikibase.MaxRetries = 2
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	id, err := wikibase.CreateClaimOnItem("Q11", "P14", []byte(`"wot!"`))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if id != "Q11$1AE01A5E-EAC8-4568-B866-8E07E93EAB63" {
+		t.Errorf("Expected the claim from the retried create, got %s", id)
+	}
+	if client.InvocationCount != 3 {
+		t.Errorf("Got unexpected invocation count: %d", client.InvocationCount)
+	}
+	if client.LastArgs()["action"] != "wbcreateclaim" {
+		t.Errorf("Expected the create to be retried: %v", client.LastArgs())
+	}
+}
+
+const testSetClaimsRetryClaims = `[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"wot!","type":"string"}},
+     "type":"statement","rank":"normal"}
+]`
+
+func TestSetClaimsRetryFindsCommittedClaims(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddError(fmt.Errorf("Timeout awaiting response headers"))
+	client.AddResponse(`
+{"entities":{"Q11":{"id":"Q11","type":"item","lastrevid":72,"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"wot!","type":"string"}},
+     "type":"statement","id":"Q11$COMMITTED","rank":"normal"},
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"other","type":"string"}},
+     "type":"statement","id":"Q11$OTHER","rank":"normal"}
+]}}}}
+`)
+	wikibase := NewClient(client)
+	wikibase.MaxRetries = 2
+	metrics := &testMetrics{}
+	wikibase.Metrics = metrics.record
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	claims, err := wikibase.SetClaimsWithResult("Q11", []byte(testSetClaimsRetryClaims))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(claims) != 1 || claims[0].ID != "Q11$COMMITTED" {
+		t.Errorf("Expected the committed claim to be found, got %v", claims)
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Expected no second edit attempt, got %d invocations", client.InvocationCount)
+	}
+	if client.LastArgs()["action"] != "wbgetentities" || client.LastArgs()["ids"] != "Q11" {
+		t.Errorf("Unexpected check request: %v", client.LastArgs())
+	}
+	if len(metrics.values[MetricRetryAlreadyApplied]) != 1 {
+		t.Errorf("Expected the skipped retry to be reported: %v", metrics.values)
+	}
+}
+
+func TestSetClaimsRetryWhenNotCommitted(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddError(&HTTPError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"})
+	client.AddResponse(`
+{"entities":{"Q11":{"id":"Q11","type":"item","lastrevid":71,"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"other","type":"string"}},
+     "type":"statement","id":"Q11$OTHER","rank":"normal"}
+]}}}}
+`)
+	client.AddResponse(`
+{"entity":{"id":"Q11","type":"item","lastrevid":72,"claims":{"P14":[
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"other","type":"string"}},
+     "type":"statement","id":"Q11$OTHER","rank":"normal"},
+    {"mainsnak":{"snaktype":"value","property":"P14","datavalue":{"value":"wot!","type":"string"}},
+     "type":"statement","id":"Q11$NEW","rank":"normal"}
+]}},"success":1}
+`)
+	wikibase := NewClient(client)
+	wikibase.MaxRetries = 2
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	claims, err := wikibase.SetClaimsWithResult("Q11", []byte(testSetClaimsRetryClaims))
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(claims) != 1 || claims[0].ID != "Q11$NEW" {
+		t.Errorf("Expected the claim from the retried edit, got %v", claims)
+	}
+	if client.InvocationCount != 3 {
+		t.Errorf("Got unexpected invocation count: %d", client.InvocationCount)
+	}
+	if client.LastArgs()["action"] != "wbeditentity" {
+		t.Errorf("Expected the edit to be retried: %v", client.LastArgs())
+	}
+}
+
+func TestReplaceItemNotRetried(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddError(fmt.Errorf("Timeout awaiting response headers"))
+	wikibase := NewClient(client)
+	wikibase.MaxRetries = 2
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, _, err := wikibase.editEntityClaims("Q11", &itemCreateData{}, nil, true)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Expected an edit that clears the item not to be retried, got %d invocations",
+			client.InvocationCount)
+	}
+}
+
+func TestSnakHasEncodedValue(t *testing.T) {
+
+	item := Snak{SnakType: "value", DataValue: &DataValue{Type: "wikibase-entityid",
+		Value: []byte(`{"entity-type":"item","numeric-id":5,"id":"Q5"}`)}}
+	if !snakHasEncodedValue(item, []byte(`{"entity-type":"item","numeric-id":5}`)) {
+		t.Errorf("Expected item values to match")
+	}
+	if snakHasEncodedValue(item, []byte(`{"entity-type":"item","numeric-id":6}`)) {
+		t.Errorf("Did not expect different items to match")
+	}
+
+	quantity := Snak{SnakType: "value", DataValue: &DataValue{Type: "quantity",
+		Value: []byte(`{"amount":"+42","unit":"1"}`)}}
+	if !snakHasEncodedValue(quantity, []byte(`{"amount":"42","unit":"1"}`)) {
+		t.Errorf("Expected quantities to match regardless of sign")
+	}
+
+	if !snakHasEncodedValue(Snak{SnakType: "novalue"}, nil) || snakHasEncodedValue(quantity, nil) {
+		t.Errorf("Expected no value to only match no value snaks")
+	}
+}
+
+const testRateLimitedResponse = `{"error":{"code":"ratelimited","info":"As an anti-abuse measure, you are limited from performing this action too many times in a short space of time, and you have exceeded this limit. Please try again in a few minutes."}}`
+
+func TestRateLimitedError(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testRateLimitedResponse)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.CreateOrUpdateArticle("Hello", "world")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected a rate limit error, got %T: %v", err, err)
+	}
+
+	if errors.Is(&APIError{Code: "maxlag"}, ErrRateLimited) {
+		t.Errorf("Did not expect maxlag to be a rate limit error")
+	}
+	if !errors.Is(&HTTPError{StatusCode: http.StatusTooManyRequests}, ErrRateLimited) {
+		t.Errorf("Expected a 429 response to be a rate limit error")
+	}
+	if errors.Is(&HTTPError{StatusCode: http.StatusServiceUnavailable}, ErrRateLimited) {
+		t.Errorf("Did not expect a 503 response to be a rate limit error")
+	}
+}
+
+func TestRateLimitedSitelinkError(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testRateLimitedResponse)
+	client.AddResponse(testRateLimitedResponse)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetSitelink("Q42", "enwiki", "Douglas Adams")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected a rate limit error setting a sitelink, got %T: %v", err, err)
+	}
+	err = wikibase.RemoveSitelink("Q42", "enwiki")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected a rate limit error removing a sitelink, got %T: %v", err, err)
+	}
+}
+
+func TestRateLimitedIsRetried(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testRateLimitedResponse)
+	client.AddError(&HTTPError{StatusCode: http.StatusTooManyRequests, Status: "429 Too Many Requests",
+		RetryAfter: time.Millisecond})
+	client.AddResponse(testArticleEditResponse)
+	wikibase := NewClient(client)
+	wikibase.MaxRetries = 2
+	metrics := &testMetrics{}
+	wikibase.Metrics = metrics.record
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	id, err := wikibase.CreateOrUpdateArticle("Hello", "world")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if id != 94 {
+		t.Errorf("Got wrong page ID: %d", id)
+	}
+	if client.InvocationCount != 3 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+	if len(metrics.values["retry.ratelimited"]) != 1 || len(metrics.values["retry.http"]) != 1 {
+		t.Errorf("Expected rate limit retries to be reported: %v", metrics.values)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+
+	now := time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-5":                            0,
+		"soon":                          0,
+		"Wed, 21 Oct 2015 07:28:30 GMT": 30 * time.Second,
+		"Wed, 21 Oct 2015 07:27:00 GMT": 0,
+	}
+	for header, expected := range tests {
+		if wait := parseRetryAfter(header, now); wait != expected {
+			t.Errorf("Retry-After %q gave %v, expected %v", header, wait, expected)
+		}
+	}
+}
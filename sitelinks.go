@@ -0,0 +1,216 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Site IDs are global IDs like "enwiki", "commonswiki", or "zh_min_nanwiki".
+var sitelinkSiteRegexp = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// sitelinkSite returns the site to use for a sitelink operation, which is the client's DefaultSitelinkSite if the
+// site given is empty.
+func (c *Client) sitelinkSite(site string) (string, error) {
+	if len(site) == 0 {
+		site = c.DefaultSitelinkSite
+	}
+	if len(site) == 0 {
+		return "", fmt.Errorf("Sitelink site must not be an empty string.")
+	}
+	if !sitelinkSiteRegexp.MatchString(site) {
+		return "", fmt.Errorf("Sitelink site %s is not a valid site ID", site)
+	}
+	return site, nil
+}
+
+// GetSitelinks fetches the sitelinks for an item, returning a map of site IDs (e.g. "enwiki") to the title of the
+// page on that site.
+func (c *Client) GetSitelinks(id ItemPropertyType) (map[string]string, error) {
+
+	entity, err := c.getEntity(id, "sitelinks")
+	if err != nil {
+		return nil, err
+	}
+
+	sitelinks := make(map[string]string, len(entity.Sitelinks))
+	for site, link := range entity.Sitelinks {
+		sitelinks[site] = link.Title
+	}
+
+	return sitelinks, nil
+}
+
+// Sitelink is a link from an item to a page on another site, as returned by GetSitelinksWithURLs.
+type Sitelink struct {
+	Site   string
+	Title  string
+	URL    string
+	Badges []ItemPropertyType
+}
+
+// GetSitelinksWithURLs fetches the sitelinks for an item along with the full URL of each linked page, returning a
+// map of site IDs (e.g. "enwiki") to the sitelink.
+func (c *Client) GetSitelinksWithURLs(id ItemPropertyType) (map[string]Sitelink, error) {
+
+	entity, err := c.getEntity(id, "sitelinks/urls")
+	if err != nil {
+		return nil, err
+	}
+
+	sitelinks := make(map[string]Sitelink, len(entity.Sitelinks))
+	for site, link := range entity.Sitelinks {
+		badges := make([]ItemPropertyType, len(link.Badges))
+		for i, badge := range link.Badges {
+			badges[i] = ItemPropertyType(badge)
+		}
+		sitelinks[site] = Sitelink{
+			Site:   site,
+			Title:  link.Title,
+			URL:    link.URL,
+			Badges: badges,
+		}
+	}
+
+	return sitelinks, nil
+}
+
+// SetSitelink links the item to the page with the given title on the given site (e.g. "enwiki"). If site is empty
+// then the client's DefaultSitelinkSite is used.
+func (c *Client) SetSitelink(id ItemPropertyType, site string, title string) error {
+	return c.SetSitelinkWithBadges(id, site, title, nil)
+}
+
+// SetSitelinkWithBadges links the item to the page with the given title on the given site, and marks the link with
+// the provided badges, which must be the Q numbers of the badge items (e.g. "featured article").
+func (c *Client) SetSitelinkWithBadges(id ItemPropertyType, site string, title string, badges []ItemPropertyType) error {
+
+	if len(id) == 0 {
+		return fmt.Errorf("Item ID must not be an empty string.")
+	}
+	site, err := c.sitelinkSite(site)
+	if err != nil {
+		return err
+	}
+
+	badge_ids := make([]string, len(badges))
+	for i, badge := range badges {
+		claim, err := c.entityClaimToAPIData(badge)
+		if err != nil {
+			return fmt.Errorf("Invalid badge %s: %v", badge, err)
+		}
+		if claim.EntityType != "item" {
+			return fmt.Errorf("Badges must be items, not %s", badge)
+		}
+		badge_ids[i] = string(badge)
+	}
+
+	editToken, terr := c.GetEditingToken()
+	if terr != nil {
+		return terr
+	}
+
+	args := map[string]string{
+		"action":    "wbsetsitelink",
+		"token":     editToken,
+		"id":        string(id),
+		"linksite":  site,
+		"linktitle": title,
+		"bot":       "1",
+	}
+	if len(badge_ids) > 0 {
+		args["badges"] = strings.Join(badge_ids, "|")
+	}
+
+	response, err := c.editPost(args)
+
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+
+	var res itemEditResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return err
+	}
+
+	if res.Error != nil {
+		return fmt.Errorf("Failed to set sitelink %s on %s: %w", site, id, res.Error)
+	}
+
+	if res.Success != 1 {
+		return fmt.Errorf("We got an unexpected success value setting sitelink %s on %s: %v", site, id, res)
+	}
+
+	return nil
+}
+
+// RemoveSitelink removes the link from the item to a page on the given site (e.g. "enwiki"). If site is empty then
+// the client's DefaultSitelinkSite is used. Removing a sitelink the item does not have is not an error.
+func (c *Client) RemoveSitelink(id ItemPropertyType, site string) error {
+
+	if len(id) == 0 {
+		return fmt.Errorf("Item ID must not be an empty string.")
+	}
+	site, err := c.sitelinkSite(site)
+	if err != nil {
+		return err
+	}
+
+	editToken, terr := c.GetEditingToken()
+	if terr != nil {
+		return terr
+	}
+
+	// An empty title tells the server to remove the sitelink
+	response, err := c.editPost(
+		map[string]string{
+			"action":    "wbsetsitelink",
+			"token":     editToken,
+			"id":        string(id),
+			"linksite":  site,
+			"linktitle": "",
+			"bot":       "1",
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+
+	var res itemEditResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return err
+	}
+
+	if res.Error != nil {
+		if res.Error.Code == "no-such-sitelink" {
+			return nil
+		}
+		return fmt.Errorf("Failed to remove sitelink %s on %s: %w", site, id, res.Error)
+	}
+
+	if res.Success != 1 {
+		return fmt.Errorf("We got an unexpected success value removing sitelink %s on %s: %v", site, id, res)
+	}
+
+	return nil
+}
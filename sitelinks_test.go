@@ -0,0 +1,312 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"testing"
+)
+
+func TestGetSitelinks(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{
+    "entities": {
+        "Q42": {
+            "type": "item",
+            "id": "Q42",
+            "sitelinks": {
+                "enwiki": {
+                    "site": "enwiki",
+                    "title": "Douglas Adams",
+                    "badges": []
+                },
+                "dewiki": {
+                    "site": "dewiki",
+                    "title": "Douglas Adams",
+                    "badges": ["Q17437796"]
+                },
+                "frwikiquote": {
+                    "site": "frwikiquote",
+                    "title": "Douglas Adams (écrivain)",
+                    "badges": []
+                }
+            }
+        }
+    },
+    "success": 1
+}
+`)
+	wikibase := NewClient(client)
+
+	sitelinks, err := wikibase.GetSitelinks("Q42")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(sitelinks) != 3 {
+		t.Fatalf("We got the wrong number of sitelinks: %v", sitelinks)
+	}
+	if sitelinks["enwiki"] != "Douglas Adams" {
+		t.Errorf("We got the wrong enwiki sitelink: %v", sitelinks)
+	}
+	if sitelinks["frwikiquote"] != "Douglas Adams (écrivain)" {
+		t.Errorf("We got the wrong frwikiquote sitelink: %v", sitelinks)
+	}
+
+	// Check that the request was also sane
+	if client.LastArgs()["action"] != "wbgetentities" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["ids"] != "Q42" {
+		t.Errorf("Unexpected ids requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["props"] != "sitelinks" {
+		t.Errorf("Unexpected props requested: %v", client.LastArgs())
+	}
+}
+
+func TestGetSitelinksWithURLs(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{
+    "entities": {
+        "Q42": {
+            "type": "item",
+            "id": "Q42",
+            "sitelinks": {
+                "enwiki": {
+                    "site": "enwiki",
+                    "title": "Douglas Adams",
+                    "badges": [],
+                    "url": "https://en.wikipedia.org/wiki/Douglas_Adams"
+                },
+                "dewiki": {
+                    "site": "dewiki",
+                    "title": "Douglas Adams",
+                    "badges": ["Q17437796"],
+                    "url": "https://de.wikipedia.org/wiki/Douglas_Adams"
+                }
+            }
+        }
+    },
+    "success": 1
+}
+`)
+	wikibase := NewClient(client)
+
+	sitelinks, err := wikibase.GetSitelinksWithURLs("Q42")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(sitelinks) != 2 {
+		t.Fatalf("We got the wrong number of sitelinks: %v", sitelinks)
+	}
+	enwiki := sitelinks["enwiki"]
+	if enwiki.Site != "enwiki" || enwiki.Title != "Douglas Adams" {
+		t.Errorf("We got the wrong enwiki sitelink: %v", enwiki)
+	}
+	if enwiki.URL != "https://en.wikipedia.org/wiki/Douglas_Adams" {
+		t.Errorf("We got the wrong enwiki URL: %v", enwiki)
+	}
+	if len(enwiki.Badges) != 0 {
+		t.Errorf("We got unexpected enwiki badges: %v", enwiki)
+	}
+	dewiki := sitelinks["dewiki"]
+	if dewiki.URL != "https://de.wikipedia.org/wiki/Douglas_Adams" {
+		t.Errorf("We got the wrong dewiki URL: %v", dewiki)
+	}
+	if len(dewiki.Badges) != 1 || dewiki.Badges[0] != "Q17437796" {
+		t.Errorf("We got the wrong dewiki badges: %v", dewiki)
+	}
+
+	if client.LastArgs()["props"] != "sitelinks/urls" {
+		t.Errorf("Unexpected props requested: %v", client.LastArgs())
+	}
+}
+
+func TestGetSitelinksMissingItem(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entities":{"Q999999":{"id":"Q999999","missing":""}},"success":1}
+`)
+	wikibase := NewClient(client)
+
+	_, err := wikibase.GetSitelinks("Q999999")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+}
+
+const testSetSitelinkResponse = `
+{"entity":{"id":"Q42","type":"item","lastrevid":1234,"sitelinks":{"enwiki":{"site":"enwiki","title":"Douglas Adams","badges":["Q17437796"]}}},"success":1}
+`
+
+func TestSetSitelink(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testSetSitelinkResponse)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetSitelink("Q42", "enwiki", "Douglas Adams")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+
+	if client.LastArgs()["action"] != "wbsetsitelink" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["linksite"] != "enwiki" || client.LastArgs()["linktitle"] != "Douglas Adams" {
+		t.Errorf("Unexpected sitelink requested: %v", client.LastArgs())
+	}
+	if _, ok := client.LastArgs()["badges"]; ok {
+		t.Errorf("Unexpected badges requested: %v", client.LastArgs())
+	}
+}
+
+func TestSetSitelinkWithBadges(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testSetSitelinkResponse)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetSitelinkWithBadges("Q42", "enwiki", "Douglas Adams", []ItemPropertyType{"Q17437796", "Q17437798"})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+
+	if client.LastArgs()["badges"] != "Q17437796|Q17437798" {
+		t.Errorf("Unexpected badges requested: %v", client.LastArgs())
+	}
+}
+
+func TestSetSitelinkWithInvalidBadge(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetSitelinkWithBadges("Q42", "enwiki", "Douglas Adams", []ItemPropertyType{"P17"})
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestSetSitelinkDefaultSite(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testSetSitelinkResponse)
+	client.AddResponse(testSetSitelinkResponse)
+	wikibase := NewClient(client)
+	wikibase.DefaultSitelinkSite = "enwiki"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetSitelink("Q42", "", "Douglas Adams")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.LastArgs()["linksite"] != "enwiki" {
+		t.Errorf("Default site was not used: %v", client.LastArgs())
+	}
+
+	// An explicit site overrides the default
+	err = wikibase.SetSitelink("Q42", "dewiki", "Douglas Adams")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.LastArgs()["linksite"] != "dewiki" {
+		t.Errorf("Explicit site was not used: %v", client.LastArgs())
+	}
+}
+
+func TestSetSitelinkInvalidSite(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	for _, site := range []string{"", "en wiki", "https://en.wikipedia.org"} {
+		err := wikibase.SetSitelink("Q42", site, "Douglas Adams")
+		if err == nil {
+			t.Errorf("We expected an error for site %q", site)
+		}
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestRemoveSitelink(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"id":"Q42","type":"item","lastrevid":1500,"sitelinks":{"enwiki":{"site":"enwiki","title":"Douglas Adams","removed":""}}},"success":1}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.RemoveSitelink("Q42", "enwiki")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+
+	args := client.LastArgs()
+	if args["action"] != "wbsetsitelink" || args["id"] != "Q42" || args["token"] != "insertokenhere" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+	if title, ok := args["linktitle"]; args["linksite"] != "enwiki" || !ok || len(title) != 0 {
+		t.Errorf("Expected an empty title for the site: %v", args)
+	}
+}
+
+func TestRemoveMissingSitelink(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"error":{"code":"no-such-sitelink","info":"Could not find a sitelink to enwiki on Q42"}}
+`)
+	client.AddResponse(`
+{"error":{"code":"no-such-entity","info":"Could not find an entity with the ID \"Q999999\"."}}
+`)
+	wikibase := NewClient(client)
+	wikibase.DefaultSitelinkSite = "enwiki"
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.RemoveSitelink("Q42", "")
+	if err != nil {
+		t.Errorf("Removing a missing sitelink should not be an error: %v", err)
+	}
+	if client.LastArgs()["linksite"] != "enwiki" {
+		t.Errorf("Expected the default site to be used: %v", client.LastArgs())
+	}
+
+	err = wikibase.RemoveSitelink("Q999999", "")
+	if err == nil {
+		t.Errorf("We expected an error for a missing item")
+	}
+}
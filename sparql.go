@@ -15,12 +15,19 @@
 package wikibase
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type SparqlHead struct {
@@ -44,6 +51,79 @@ type SparqlResponse struct {
 	Results SparqlResults `json:"results"`
 }
 
+// Rows flattens the results into a list of maps of variable name to value, dropping the type information. Variables
+// that are not bound in a result will not be present in that row's map.
+func (r *SparqlResponse) Rows() []map[string]string {
+	rows := make([]map[string]string, len(r.Results.Bindings))
+	for i, binding := range r.Results.Bindings {
+		row := make(map[string]string, len(binding))
+		for name, value := range binding {
+			row[name] = value.Value
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// XSDNamespace is the namespace of the XML schema datatypes used for typed literals in SPARQL results.
+const XSDNamespace = "http://www.w3.org/2001/XMLSchema#"
+
+var sparqlIntegerTypes = map[string]bool{
+	"integer": true, "int": true, "long": true, "short": true, "byte": true,
+	"nonNegativeInteger": true, "positiveInteger": true, "nonPositiveInteger": true, "negativeInteger": true,
+	"unsignedLong": true, "unsignedInt": true, "unsignedShort": true, "unsignedByte": true,
+}
+
+var sparqlFloatTypes = map[string]bool{
+	"decimal": true, "double": true, "float": true,
+}
+
+// xsdType returns the local name of the value's XML schema datatype, such as "dateTime", or an empty string if the
+// value is not a literal with an XML schema datatype. Both the full IRI and the "xsd:" prefixed form are accepted.
+func (v SparqlValue) xsdType() string {
+	if v.Type != "literal" && v.Type != "typed-literal" {
+		return ""
+	}
+	if strings.HasPrefix(v.DataType, XSDNamespace) {
+		return strings.TrimPrefix(v.DataType, XSDNamespace)
+	}
+	if strings.HasPrefix(v.DataType, "xsd:") {
+		return strings.TrimPrefix(v.DataType, "xsd:")
+	}
+	return ""
+}
+
+// AsTime returns the value as a time if it is an xsd:dateTime or xsd:date literal, and an error otherwise.
+func (v SparqlValue) AsTime() (time.Time, error) {
+	switch v.xsdType() {
+	case "dateTime":
+		return time.Parse(time.RFC3339, v.Value)
+	case "date":
+		return time.Parse("2006-01-02", v.Value)
+	default:
+		return time.Time{}, fmt.Errorf("SPARQL value %s with datatype %s is not a date", v.Value, v.DataType)
+	}
+}
+
+// AsInt returns the value as an integer if it is a literal of xsd:integer or one of its derived datatypes, and an
+// error otherwise.
+func (v SparqlValue) AsInt() (int64, error) {
+	if !sparqlIntegerTypes[v.xsdType()] {
+		return 0, fmt.Errorf("SPARQL value %s with datatype %s is not an integer", v.Value, v.DataType)
+	}
+	return strconv.ParseInt(v.Value, 10, 64)
+}
+
+// AsFloat returns the value as a float if it is an xsd:decimal, xsd:double, xsd:float, or integer literal, and an
+// error otherwise.
+func (v SparqlValue) AsFloat() (float64, error) {
+	xsd_type := v.xsdType()
+	if !sparqlFloatTypes[xsd_type] && !sparqlIntegerTypes[xsd_type] {
+		return 0, fmt.Errorf("SPARQL value %s with datatype %s is not a number", v.Value, v.DataType)
+	}
+	return strconv.ParseFloat(v.Value, 64)
+}
+
 func MakeSPARQLQuery(service_url string, sparql string) (*SparqlResponse, error) {
 
 	params := url.Values{}
@@ -79,3 +159,450 @@ func MakeSPARQLQuery(service_url string, sparql string) (*SparqlResponse, error)
 	}
 	return &data, nil
 }
+
+// sparqlEntityPrefixes are the prefixes that mark a binding value in MakeSPARQLQueryWithBindings as an entity rather
+// than a string literal.
+var sparqlEntityPrefixes = map[string]bool{
+	"wd": true, "wdt": true, "wds": true, "wdv": true, "wdref": true, "wdno": true,
+	"p": true, "ps": true, "psv": true, "pq": true, "pqv": true, "pr": true, "prv": true,
+	"wikibase": true, "schema": true, "rdfs": true, "skos": true, "bd": true,
+}
+
+var sparqlLocalNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// EscapeSPARQLLiteral returns the value as a quoted SPARQL string literal, with quotes, backslashes, and control
+// characters escaped as the SPARQL grammar requires. Any value interpolated into a query as a string, particularly
+// user input, should go through this or MakeSPARQLQueryWithBindings to avoid injection.
+func EscapeSPARQLLiteral(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// sparqlIRIForbidden are the characters, other than spaces and control characters, that can not appear in a SPARQL
+// IRI reference.
+const sparqlIRIForbidden = "<>\"{}|^`\\"
+
+// EscapeSPARQLIRI returns the IRI in angle brackets for use in a SPARQL query, with any characters the SPARQL
+// grammar does not allow in IRIs, such as spaces and angle brackets, percent encoded. An error is returned if the
+// IRI is not absolute. Any IRI interpolated into a query should go through this to avoid injection.
+func EscapeSPARQLIRI(iri string) (string, error) {
+	var b strings.Builder
+	for _, r := range iri {
+		if r <= 0x20 || r == 0x7f || strings.ContainsRune(sparqlIRIForbidden, r) {
+			fmt.Fprintf(&b, "%%%02X", r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	escaped := b.String()
+
+	u, err := url.Parse(escaped)
+	if err != nil || !u.IsAbs() {
+		return "", fmt.Errorf("IRI %s is not an absolute IRI", iri)
+	}
+	return "<" + escaped + ">", nil
+}
+
+// sparqlBindingValue works out how to insert a binding value into a query. Values that are IRIs in angle brackets,
+// or that use one of the well known Wikibase prefixes (e.g. "wd:Q42" or "wdt:P31") are treated as entities and
+// validated, and everything else is treated as a string literal and escaped.
+func sparqlBindingValue(value string) (string, error) {
+
+	if strings.HasPrefix(value, "<") {
+		if !strings.HasSuffix(value, ">") {
+			return "", fmt.Errorf("IRI binding %s is not terminated", value)
+		}
+		iri := value[1 : len(value)-1]
+		if strings.ContainsAny(iri, "<>\"{}|^`\\ \t\n\r") {
+			return "", fmt.Errorf("IRI binding %s contains invalid characters", value)
+		}
+		u, err := url.Parse(iri)
+		if err != nil || !u.IsAbs() {
+			return "", fmt.Errorf("IRI binding %s is not an absolute IRI", value)
+		}
+		return value, nil
+	}
+
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) == 2 && sparqlEntityPrefixes[parts[0]] {
+		if !sparqlLocalNameRegexp.MatchString(parts[1]) {
+			return "", fmt.Errorf("Entity binding %s is not valid", value)
+		}
+		return value, nil
+	}
+
+	return EscapeSPARQLLiteral(value), nil
+}
+
+// bindSPARQLQuery replaces ?name variables in the query with the values in bindings. Variables inside string
+// literals, IRIs, and comments in the query are left alone.
+func bindSPARQLQuery(sparql string, bindings map[string]string) (string, error) {
+
+	values := make(map[string]string, len(bindings))
+	for name, value := range bindings {
+		v, err := sparqlBindingValue(value)
+		if err != nil {
+			return "", err
+		}
+		values[name] = v
+	}
+	used := make(map[string]bool, len(bindings))
+
+	isNameChar := func(c byte) bool {
+		return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(sparql); {
+		if end := sparqlSpanEnd(sparql, i); end > i {
+			b.WriteString(sparql[i:end])
+			i = end
+			continue
+		}
+		c := sparql[i]
+		if c != '?' {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		end := i + 1
+		for end < len(sparql) && isNameChar(sparql[end]) {
+			end++
+		}
+		name := sparql[i+1 : end]
+		if v, ok := values[name]; ok {
+			b.WriteString(v)
+			used[name] = true
+			i = end
+		} else {
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	for name := range bindings {
+		if !used[name] {
+			return "", fmt.Errorf("Binding %s is not used in query", name)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// MakeSPARQLQueryWithBindings substitutes the provided bindings for the matching ?name variables in the query before
+// sending it. Binding values that are IRIs in angle brackets or use a well known Wikibase prefix such as "wd:" or
+// "wdt:" are treated as entities and validated, and all other values are escaped and inserted as string literals.
+// This avoids building queries by string concatenation, which is prone to injection bugs.
+func MakeSPARQLQueryWithBindings(service_url string, sparql string, bindings map[string]string) (*SparqlResponse, error) {
+
+	query, err := bindSPARQLQuery(sparql, bindings)
+	if err != nil {
+		return nil, err
+	}
+
+	return MakeSPARQLQuery(service_url, query)
+}
+
+// DefaultSPARQLPrefixes are the prefixes declared in SPARQL queries made by the client, as used by Wikidata.
+var DefaultSPARQLPrefixes = map[string]string{
+	"rdfs":     "http://www.w3.org/2000/01/rdf-schema#",
+	"wd":       "http://www.wikidata.org/entity/",
+	"wdt":      "http://www.wikidata.org/prop/direct/",
+	"wikibase": "http://wikiba.se/ontology#",
+}
+
+// sparqlPropertyTypes maps the datatypes used by the API to the names used for them in the Wikibase RDF ontology.
+var sparqlPropertyTypes = map[string]string{
+	"commonsMedia":      "CommonsMedia",
+	"edtf":              "Edtf",
+	"entity-schema":     "EntitySchema",
+	"external-id":       "ExternalId",
+	"geo-shape":         "GeoShape",
+	"globe-coordinate":  "GlobeCoordinate",
+	"math":              "Math",
+	"monolingualtext":   "Monolingualtext",
+	"musical-notation":  "MusicalNotation",
+	"quantity":          "Quantity",
+	"string":            "String",
+	"tabular-data":      "TabularData",
+	"time":              "Time",
+	"url":               "Url",
+	"wikibase-form":     "WikibaseForm",
+	"wikibase-item":     "WikibaseItem",
+	"wikibase-lexeme":   "WikibaseLexeme",
+	"wikibase-property": "WikibaseProperty",
+	"wikibase-sense":    "WikibaseSense",
+}
+
+// sparqlQueryWithPrefixes adds declarations of the SPARQL prefixes used by the query to the start of it, taking them
+// from the client's SPARQLPrefixes, or DefaultSPARQLPrefixes for those it does not set.
+func (c *Client) sparqlQueryWithPrefixes(sparql string) string {
+	prefixes := make(map[string]string, len(DefaultSPARQLPrefixes)+len(c.SPARQLPrefixes))
+	for name, iri := range DefaultSPARQLPrefixes {
+		prefixes[name] = iri
+	}
+	for name, iri := range c.SPARQLPrefixes {
+		prefixes[name] = iri
+	}
+	names := make([]string, 0, len(prefixes))
+	for name := range prefixes {
+		used := regexp.MustCompile(`(^|[^\w-])` + regexp.QuoteMeta(name) + `:`)
+		if used.MatchString(sparql) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "PREFIX %s: <%s>\n", name, prefixes[name])
+	}
+	b.WriteString(sparql)
+	return b.String()
+}
+
+// sparqlEntityID returns the entity ID from the end of an entity IRI in SPARQL results, or an empty string if the
+// value is not an entity.
+func (c *Client) sparqlEntityID(value SparqlValue) ItemPropertyType {
+	if value.Type != "uri" {
+		return ""
+	}
+	// The entity IRIs depend on the wiki, but always end with the ID
+	id := ItemPropertyType(value.Value[strings.LastIndex(value.Value, "/")+1:])
+	if _, err := c.entityClaimToAPIData(id); err != nil {
+		return ""
+	}
+	return id
+}
+
+var sparqlLanguageTagRegexp = regexp.MustCompile(`^[A-Za-z]+(-[A-Za-z0-9]+)*$`)
+
+// sparqlIDsForLabel finds the entities of the given type with exactly the label using the client's SPARQL endpoint.
+func (c *Client) sparqlIDsForLabel(thing WikiBaseType, label string) ([]string, error) {
+
+	language := c.labelLanguage(thing)
+	if !sparqlLanguageTagRegexp.MatchString(language) {
+		return nil, fmt.Errorf("Language %s can not be used in SPARQL", language)
+	}
+
+	query := c.sparqlQueryWithPrefixes(fmt.Sprintf(
+		"SELECT ?entity WHERE { ?entity rdfs:label %s@%s . }", EscapeSPARQLLiteral(label), language))
+	res, err := MakeSPARQLQuery(c.SPARQLEndpoint, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Other types of entity can have the same label, so only keep the ones we want
+	ids := make([]string, 0)
+	for _, binding := range res.Results.Bindings {
+		id := c.sparqlEntityID(binding["entity"])
+		if len(id) == 0 {
+			continue
+		}
+		entity, _ := c.entityClaimToAPIData(id)
+		if entity.EntityType == string(thing) {
+			ids = append(ids, string(id))
+		}
+	}
+	return ids, nil
+}
+
+// sparqlIsInstanceOf checks whether the item has a best ranked instance of statement for the class using the
+// client's SPARQL endpoint.
+func (c *Client) sparqlIsInstanceOf(item ItemPropertyType, class ItemPropertyType, property_id string) (bool, error) {
+
+	for _, id := range []ItemPropertyType{item, class, ItemPropertyType(property_id)} {
+		if !sparqlLocalNameRegexp.MatchString(string(id)) {
+			return false, fmt.Errorf("Entity ID %s can not be used in SPARQL", id)
+		}
+	}
+
+	query := c.sparqlQueryWithPrefixes(fmt.Sprintf(
+		"SELECT ?item WHERE { BIND(wd:%s AS ?item) ?item wdt:%s wd:%s . } LIMIT 1", item, property_id, class))
+	res, err := MakeSPARQLQuery(c.SPARQLEndpoint, query)
+	if err != nil {
+		return false, err
+	}
+	return len(res.Results.Bindings) > 0, nil
+}
+
+// FetchPropertiesByDatatype returns the IDs of the properties on the wiki with the given datatype, such as
+// "external-id", so that existing properties can be reused rather than new ones created. The datatype must be one of
+// those in WikibaseDataTypes. This queries the client's SPARQL endpoint, so reflects the query service's copy of the
+// wiki, which can lag behind recent edits.
+func (c *Client) FetchPropertiesByDatatype(datatype string) ([]string, error) {
+
+	if len(c.SPARQLEndpoint) == 0 {
+		return nil, fmt.Errorf("No SPARQL endpoint configured on the client")
+	}
+	ontology_type, ok := sparqlPropertyTypes[datatype]
+	if !ok {
+		return nil, fmt.Errorf("Unrecognised property datatype %s", datatype)
+	}
+
+	query := c.sparqlQueryWithPrefixes(fmt.Sprintf(
+		"SELECT ?property WHERE { ?property wikibase:propertyType wikibase:%s . }", ontology_type))
+	res, err := MakeSPARQLQuery(c.SPARQLEndpoint, query)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make([]string, 0, len(res.Results.Bindings))
+	for _, binding := range res.Results.Bindings {
+		value, ok := binding["property"]
+		if !ok || value.Type != "uri" {
+			continue
+		}
+		id := c.sparqlEntityID(value)
+		entity, err := c.entityClaimToAPIData(id)
+		if err != nil || entity.EntityType != "property" {
+			return nil, fmt.Errorf("Unexpected property %s in SPARQL results", value.Value)
+		}
+		properties = append(properties, string(id))
+	}
+
+	return properties, nil
+}
+
+// SPARQLQueryHash returns a stable hash of the query that can be used as a cache key. Whitespace outside of string
+// literals and IRIs is normalised before hashing, so queries that differ only in layout have the same hash.
+func SPARQLQueryHash(sparql string) string {
+	sum := sha256.Sum256([]byte(normaliseSPARQLWhitespace(sparql)))
+	return hex.EncodeToString(sum[:])
+}
+
+// sparqlSpanEnd returns the end of the string literal, IRI, or comment starting at position i of the query, or i if
+// there isn't one, so that they can be kept as they are when working on the rest of the query. Literals can use
+// single, double, or tripled quotes, and comments run to the end of the line. A "<" is only taken to start an IRI if
+// there is a ">" before the next whitespace, as otherwise it is a less than operator.
+func sparqlSpanEnd(sparql string, i int) int {
+	switch sparql[i] {
+	case '"', '\'':
+		delim := sparql[i : i+1]
+		if strings.HasPrefix(sparql[i:], strings.Repeat(delim, 3)) {
+			delim = strings.Repeat(delim, 3)
+		}
+		for j := i + len(delim); j < len(sparql); j++ {
+			if sparql[j] == '\\' {
+				j++
+				continue
+			}
+			if strings.HasPrefix(sparql[j:], delim) {
+				return j + len(delim)
+			}
+		}
+		return len(sparql)
+	case '<':
+		end := strings.IndexAny(sparql[i:], "> \t\n\r")
+		if end > 0 && sparql[i+end] == '>' {
+			return i + end + 1
+		}
+	case '#':
+		end := strings.IndexAny(sparql[i:], "\n\r")
+		if end < 0 {
+			return len(sparql)
+		}
+		return i + end
+	}
+	return i
+}
+
+// normaliseSPARQLWhitespace collapses each run of whitespace in the query to a single space and trims the ends, leaving
+// string literals, IRIs, and comments as they are.
+func normaliseSPARQLWhitespace(sparql string) string {
+
+	var b strings.Builder
+	space := false
+	write := func(token string) {
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(token)
+	}
+
+	for i := 0; i < len(sparql); {
+		if end := sparqlSpanEnd(sparql, i); end > i {
+			write(sparql[i:end])
+			i = end
+			continue
+		}
+		switch sparql[i] {
+		case ' ', '\t', '\n', '\r':
+			space = true
+		default:
+			write(sparql[i : i+1])
+		}
+		i++
+	}
+	return b.String()
+}
+
+type sparqlCacheEntry struct {
+	response *SparqlResponse
+	expires  time.Time
+}
+
+var sparqlCache = make(map[string]sparqlCacheEntry)
+var sparqlCacheLock sync.Mutex
+
+// CachedSPARQLQuery is like MakeSPARQLQuery, but keeps the results in memory for the given time, so repeated identical
+// queries to the same service within a run don't hit the endpoint again. Failed queries are not cached, and expired
+// results are dropped from the cache whenever it is used. The returned response is shared with other callers and so
+// should not be modified.
+func CachedSPARQLQuery(service_url string, sparql string, ttl time.Duration) (*SparqlResponse, error) {
+
+	key := service_url + " " + SPARQLQueryHash(sparql)
+
+	sparqlCacheLock.Lock()
+	now := time.Now()
+	for cached_key, cached := range sparqlCache {
+		if now.After(cached.expires) {
+			delete(sparqlCache, cached_key)
+		}
+	}
+	entry, ok := sparqlCache[key]
+	sparqlCacheLock.Unlock()
+	if ok {
+		return entry.response, nil
+	}
+
+	response, err := MakeSPARQLQuery(service_url, sparql)
+	if err != nil {
+		return nil, err
+	}
+
+	sparqlCacheLock.Lock()
+	sparqlCache[key] = sparqlCacheEntry{response: response, expires: time.Now().Add(ttl)}
+	sparqlCacheLock.Unlock()
+
+	return response, nil
+}
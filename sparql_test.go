@@ -0,0 +1,688 @@
+//   Copyright 2019 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testSparqlResponse = `
+{
+  "head" : {
+    "vars" : [ "item", "itemLabel", "population" ]
+  },
+  "results" : {
+    "bindings" : [ {
+      "item" : {
+        "type" : "uri",
+        "value" : "http://www.wikidata.org/entity/Q350"
+      },
+      "itemLabel" : {
+        "xml:lang" : "en",
+        "type" : "literal",
+        "value" : "Cambridge"
+      },
+      "population" : {
+        "datatype" : "http://www.w3.org/2001/XMLSchema#decimal",
+        "type" : "literal",
+        "value" : "123867"
+      }
+    }, {
+      "item" : {
+        "type" : "uri",
+        "value" : "http://www.wikidata.org/entity/Q34217"
+      },
+      "itemLabel" : {
+        "xml:lang" : "en",
+        "type" : "literal",
+        "value" : "Oxford"
+      }
+    } ]
+  }
+}
+`
+
+func TestSparqlRows(t *testing.T) {
+
+	var response SparqlResponse
+	err := json.Unmarshal([]byte(testSparqlResponse), &response)
+	if err != nil {
+		t.Fatalf("Failed to decode test data: %v", err)
+	}
+
+	rows := response.Rows()
+	if len(rows) != 2 {
+		t.Fatalf("We got the wrong number of rows: %v", rows)
+	}
+	if rows[0]["item"] != "http://www.wikidata.org/entity/Q350" || rows[0]["itemLabel"] != "Cambridge" ||
+		rows[0]["population"] != "123867" {
+		t.Errorf("We got the wrong first row: %v", rows[0])
+	}
+	if rows[1]["itemLabel"] != "Oxford" {
+		t.Errorf("We got the wrong second row: %v", rows[1])
+	}
+	if _, ok := rows[1]["population"]; ok {
+		t.Errorf("Unbound variable should not be in row: %v", rows[1])
+	}
+
+	// The richer results should still be available
+	if response.Results.Bindings[0]["population"].DataType != "http://www.w3.org/2001/XMLSchema#decimal" {
+		t.Errorf("We lost the type information: %v", response.Results.Bindings[0])
+	}
+}
+
+func TestBindSPARQLQueryLiteral(t *testing.T) {
+
+	query, err := bindSPARQLQuery(`SELECT ?item WHERE { ?item rdfs:label ?label . }`,
+		map[string]string{"label": "Cambridge"})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if query != `SELECT ?item WHERE { ?item rdfs:label "Cambridge" . }` {
+		t.Errorf("We got an unexpected query: %s", query)
+	}
+}
+
+func TestBindSPARQLQueryEntity(t *testing.T) {
+
+	query, err := bindSPARQLQuery(`SELECT ?item WHERE { ?item wdt:P31 ?type ; ?prop ?value . }`,
+		map[string]string{"type": "wd:Q515", "prop": "<http://www.wikidata.org/prop/direct/P17>", "value": "wd:Q145"})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if query != `SELECT ?item WHERE { ?item wdt:P31 wd:Q515 ; <http://www.wikidata.org/prop/direct/P17> wd:Q145 . }` {
+		t.Errorf("We got an unexpected query: %s", query)
+	}
+}
+
+func TestBindSPARQLQuerySkipsIRIsAndComments(t *testing.T) {
+
+	sparql := "# find ?type things\n" +
+		"SELECT ?item WHERE { ?item <http://example.org/find?type> ?type ; rdfs:label '''?type''' . # ?type\n" +
+		"FILTER(?n <?type) }"
+	query, err := bindSPARQLQuery(sparql, map[string]string{"type": "wd:Q515"})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	expected := "# find ?type things\n" +
+		"SELECT ?item WHERE { ?item <http://example.org/find?type> wd:Q515 ; rdfs:label '''?type''' . # ?type\n" +
+		"FILTER(?n <wd:Q515) }"
+	if query != expected {
+		t.Errorf("We got an unexpected query:\n%s\nexpected:\n%s", query, expected)
+	}
+
+	// A binding only used in a comment or IRI is not used
+	_, err = bindSPARQLQuery("SELECT ?item WHERE { ?item <http://example.org/?value> 1 . } # ?value",
+		map[string]string{"value": "hello"})
+	if err == nil {
+		t.Errorf("We expected an error for an unused binding")
+	}
+}
+
+func TestBindSPARQLQueryInvalidEntity(t *testing.T) {
+
+	invalid := []string{
+		"wd:Q515 } ; DELETE { ?s ?p ?o",
+		"<http://www.wikidata.org/entity/Q515> . ?s ?p ?o",
+		"<not an iri>",
+		"<relative/path>",
+	}
+	for _, value := range invalid {
+		_, err := bindSPARQLQuery(`SELECT ?item WHERE { ?item wdt:P31 ?type . }`, map[string]string{"type": value})
+		if err == nil {
+			t.Errorf("We expected an error for %s", value)
+		}
+	}
+}
+
+func TestBindSPARQLQueryEscaping(t *testing.T) {
+
+	query, err := bindSPARQLQuery(`SELECT ?item WHERE { ?item rdfs:label ?label . FILTER(?other != "?label") }`,
+		map[string]string{"label": "Bobby\" } ; DROP ALL ; #\n\\'"})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	expected := `SELECT ?item WHERE { ?item rdfs:label "Bobby\" } ; DROP ALL ; #\n\\\'" . FILTER(?other != "?label") }`
+	if query != expected {
+		t.Errorf("We got an unexpected query:\n%s\nexpected:\n%s", query, expected)
+	}
+
+	// A prefix we don't know is just text
+	query, err = bindSPARQLQuery(`SELECT ?item WHERE { ?item rdfs:label ?label . }`,
+		map[string]string{"label": "note: hello"})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if query != `SELECT ?item WHERE { ?item rdfs:label "note: hello" . }` {
+		t.Errorf("We got an unexpected query: %s", query)
+	}
+}
+
+func TestEscapeSPARQLLiteral(t *testing.T) {
+
+	tests := map[string]string{
+		`Cambridge`:           `"Cambridge"`,
+		`Bobby" } ; DROP ALL`: `"Bobby\" } ; DROP ALL"`,
+		`it's`:                `"it\'s"`,
+		"line one\nline two":  `"line one\nline two"`,
+		"tab\tand\rreturn":    `"tab\tand\rreturn"`,
+		`C:\path\`:            `"C:\\path\\"`,
+		"bell\x07":            `"bell\u0007"`,
+		"café":                `"café"`,
+	}
+	for value, expected := range tests {
+		if escaped := EscapeSPARQLLiteral(value); escaped != expected {
+			t.Errorf("Escaping %q gave %s, expected %s", value, escaped, expected)
+		}
+	}
+}
+
+func TestEscapeSPARQLIRI(t *testing.T) {
+
+	iri, err := EscapeSPARQLIRI("http://www.wikidata.org/entity/Q42")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if iri != "<http://www.wikidata.org/entity/Q42>" {
+		t.Errorf("We got an unexpected IRI: %s", iri)
+	}
+
+	iri, err = EscapeSPARQLIRI("http://example.org/a b> . ?s ?p ?o <x\"y")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if iri != "<http://example.org/a%20b%3E%20.%20?s%20?p%20?o%20%3Cx%22y>" {
+		t.Errorf("We got an unexpected IRI: %s", iri)
+	}
+
+	_, err = EscapeSPARQLIRI("relative/path")
+	if err == nil {
+		t.Errorf("We expected an error for a relative IRI")
+	}
+}
+
+func TestBindSPARQLQueryUnusedBinding(t *testing.T) {
+
+	_, err := bindSPARQLQuery(`SELECT ?item WHERE { ?item rdfs:label ?labels . }`, map[string]string{"label": "x"})
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+}
+
+func TestMakeSPARQLQueryWithBindings(t *testing.T) {
+
+	var sent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.FormValue("query")
+		w.Header().Set("Content-Type", "application/sparql-results+json")
+		w.Write([]byte(testSparqlResponse))
+	}))
+	defer server.Close()
+
+	res, err := MakeSPARQLQueryWithBindings(server.URL, `SELECT ?item WHERE { ?item wdt:P31 ?type . }`,
+		map[string]string{"type": "wd:Q515"})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if sent != `SELECT ?item WHERE { ?item wdt:P31 wd:Q515 . }` {
+		t.Errorf("We sent an unexpected query: %s", sent)
+	}
+	if len(res.Results.Bindings) != 2 {
+		t.Errorf("We got unexpected results: %v", res)
+	}
+}
+
+func TestSPARQLQueryHash(t *testing.T) {
+
+	a := SPARQLQueryHash("SELECT ?item WHERE { ?item wdt:P31 wd:Q515 . }")
+	b := SPARQLQueryHash("SELECT ?item\nWHERE {\n\t?item wdt:P31 wd:Q515 .\n}\n")
+	c := SPARQLQueryHash("SELECT ?item WHERE { ?item wdt:P31 wd:Q5 . }")
+
+	if a != b {
+		t.Errorf("Queries differing only in whitespace should have the same hash: %s %s", a, b)
+	}
+	if a == c {
+		t.Errorf("Different queries should have different hashes: %s", a)
+	}
+	if len(a) != 64 {
+		t.Errorf("Expected a hex encoded SHA-256 hash: %s", a)
+	}
+
+	// Whitespace inside literals matters
+	if SPARQLQueryHash(`SELECT ?x WHERE { ?x rdfs:label "a  b" . }`) ==
+		SPARQLQueryHash(`SELECT ?x WHERE { ?x rdfs:label "a b" . }`) {
+		t.Errorf("Queries with different literals should have different hashes")
+	}
+	if SPARQLQueryHash(`SELECT ?x WHERE { ?x rdfs:label 'it\'s  here' . }`) ==
+		SPARQLQueryHash(`SELECT ?x WHERE { ?x rdfs:label 'it\'s here' . }`) {
+		t.Errorf("Queries with different literals containing escapes should have different hashes")
+	}
+}
+
+func TestNormaliseSPARQLWhitespace(t *testing.T) {
+
+	cases := map[string]string{
+		"  SELECT ?x\n\tWHERE {  ?x ?p ?o }  ":      "SELECT ?x WHERE { ?x ?p ?o }",
+		`?x rdfs:label "a  b"  .`:                   `?x rdfs:label "a  b" .`,
+		"?x rdfs:label \"\"\"two\n  lines\"\"\"  .": "?x rdfs:label \"\"\"two\n  lines\"\"\" .",
+		"?x  <http://example.org/a#b>   ?o":         "?x <http://example.org/a#b> ?o",
+		"FILTER(?n  <  5 &&  ?m > 2)":               "FILTER(?n < 5 && ?m > 2)",
+		`?x rdfs:label "say \"hi  there\""@en  .`:   `?x rdfs:label "say \"hi  there\""@en .`,
+		`?x rdfs:label "unterminated  literal`:      `?x rdfs:label "unterminated  literal`,
+	}
+	for query, expected := range cases {
+		if normalised := normaliseSPARQLWhitespace(query); normalised != expected {
+			t.Errorf("Expected %q to normalise to %q, got %q", query, expected, normalised)
+		}
+	}
+}
+
+func TestCachedSPARQLQuery(t *testing.T) {
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "application/sparql-results+json")
+		w.Write([]byte(testSparqlResponse))
+	}))
+	defer server.Close()
+
+	_, err := CachedSPARQLQuery(server.URL, "SELECT ?item WHERE { ?item wdt:P31 wd:Q515 . }", time.Minute)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	res, err := CachedSPARQLQuery(server.URL, "SELECT ?item\nWHERE { ?item wdt:P31 wd:Q515 . }", time.Minute)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(res.Results.Bindings) != 2 {
+		t.Errorf("We got the wrong cached response: %v", res)
+	}
+	if atomic.LoadInt32(&hits) != 1 {
+		t.Errorf("Expected the second query to be served from the cache, got %d hits", hits)
+	}
+
+	_, err = CachedSPARQLQuery(server.URL, "SELECT ?item WHERE { ?item wdt:P31 wd:Q5 . }", time.Minute)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if atomic.LoadInt32(&hits) != 2 {
+		t.Errorf("Expected a different query to miss the cache, got %d hits", hits)
+	}
+}
+
+func TestCachedSPARQLQueryExpires(t *testing.T) {
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "application/sparql-results+json")
+		w.Write([]byte(testSparqlResponse))
+	}))
+	defer server.Close()
+
+	query := "SELECT ?item WHERE { ?item wdt:P31 wd:Q515 . }"
+	_, err := CachedSPARQLQuery(server.URL, query, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	_, err = CachedSPARQLQuery(server.URL, query, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if atomic.LoadInt32(&hits) != 2 {
+		t.Errorf("Expected the expired entry to be fetched again, got %d hits", hits)
+	}
+
+	// Expired entries for other queries are dropped when the cache is next used
+	other := "SELECT ?item WHERE { ?item wdt:P31 wd:Q5 . }"
+	time.Sleep(30 * time.Millisecond)
+	_, err = CachedSPARQLQuery(server.URL, other, time.Minute)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	sparqlCacheLock.Lock()
+	_, ok := sparqlCache[server.URL+" "+SPARQLQueryHash(query)]
+	sparqlCacheLock.Unlock()
+	if ok {
+		t.Errorf("Expected the expired entry to be removed from the cache")
+	}
+}
+
+func TestSparqlValueAsTime(t *testing.T) {
+
+	value := SparqlValue{Type: "literal", Value: "1952-03-11T00:00:00Z", DataType: XSDNamespace + "dateTime"}
+	when, err := value.AsTime()
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !when.Equal(time.Date(1952, 3, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("We got the wrong time: %v", when)
+	}
+
+	value = SparqlValue{Type: "literal", Value: "1952-03-11", DataType: "xsd:date"}
+	when, err = value.AsTime()
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !when.Equal(time.Date(1952, 3, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("We got the wrong time: %v", when)
+	}
+}
+
+func TestSparqlValueAsInt(t *testing.T) {
+
+	value := SparqlValue{Type: "literal", Value: "-42", DataType: XSDNamespace + "integer"}
+	i, err := value.AsInt()
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if i != -42 {
+		t.Errorf("We got the wrong integer: %v", i)
+	}
+
+	// Integers are numbers too
+	f, err := value.AsFloat()
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if f != -42 {
+		t.Errorf("We got the wrong float: %v", f)
+	}
+}
+
+func TestSparqlValueAsFloat(t *testing.T) {
+
+	value := SparqlValue{Type: "literal", Value: "123867.5", DataType: XSDNamespace + "decimal"}
+	f, err := value.AsFloat()
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if f != 123867.5 {
+		t.Errorf("We got the wrong float: %v", f)
+	}
+}
+
+func TestSparqlValueTypeMismatch(t *testing.T) {
+
+	decimal := SparqlValue{Type: "literal", Value: "123867.5", DataType: XSDNamespace + "decimal"}
+	if _, err := decimal.AsInt(); err == nil {
+		t.Errorf("We expected an error reading a decimal as an integer")
+	}
+	if _, err := decimal.AsTime(); err == nil {
+		t.Errorf("We expected an error reading a decimal as a time")
+	}
+
+	uri := SparqlValue{Type: "uri", Value: "http://www.wikidata.org/entity/Q350"}
+	if _, err := uri.AsFloat(); err == nil {
+		t.Errorf("We expected an error reading a URI as a number")
+	}
+
+	untyped := SparqlValue{Type: "literal", Value: "12"}
+	if _, err := untyped.AsInt(); err == nil {
+		t.Errorf("We expected an error reading an untyped literal as an integer")
+	}
+
+	date := SparqlValue{Type: "literal", Value: "1952-03-11T00:00:00Z", DataType: XSDNamespace + "dateTime"}
+	if _, err := date.AsInt(); err == nil {
+		t.Errorf("We expected an error reading a date as an integer")
+	}
+}
+
+func TestFetchPropertiesByDatatype(t *testing.T) {
+
+	var sent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.FormValue("query")
+		w.Header().Set("Content-Type", "application/sparql-results+json")
+		w.Write([]byte(`
+{
+  "head" : { "vars" : [ "property" ] },
+  "results" : {
+    "bindings" : [
+      { "property" : { "type" : "uri", "value" : "http://www.wikidata.org/entity/P214" } },
+      { "property" : { "type" : "uri", "value" : "http://www.wikidata.org/entity/P496" } }
+    ]
+  }
+}`))
+	}))
+	defer server.Close()
+
+	wikibase := NewClient(&MockNetworkClient{})
+	wikibase.SPARQLEndpoint = server.URL
+
+	properties, err := wikibase.FetchPropertiesByDatatype("external-id")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(properties, []string{"P214", "P496"}) {
+		t.Errorf("We got unexpected properties: %v", properties)
+	}
+	expected := "PREFIX wikibase: <http://wikiba.se/ontology#>\n" +
+		"SELECT ?property WHERE { ?property wikibase:propertyType wikibase:ExternalId . }"
+	if sent != expected {
+		t.Errorf("We sent an unexpected query:\n%s", sent)
+	}
+
+	// Prefixes can be configured for wikis with their own ontology
+	wikibase.SPARQLPrefixes = map[string]string{"wikibase": "http://example.org/ontology#"}
+	_, err = wikibase.FetchPropertiesByDatatype("wikibase-item")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	expected = "PREFIX wikibase: <http://example.org/ontology#>\n" +
+		"SELECT ?property WHERE { ?property wikibase:propertyType wikibase:WikibaseItem . }"
+	if sent != expected {
+		t.Errorf("We sent an unexpected query:\n%s", sent)
+	}
+
+	_, err = wikibase.FetchPropertiesByDatatype("not-a-type")
+	if err == nil {
+		t.Errorf("We expected an error for an unknown datatype")
+	}
+}
+
+func TestFetchPropertiesByDatatypeWithoutEndpoint(t *testing.T) {
+
+	wikibase := NewClient(&MockNetworkClient{})
+	_, err := wikibase.FetchPropertiesByDatatype("string")
+	if err == nil {
+		t.Errorf("We expected an error")
+	}
+}
+
+func TestSPARQLPropertyTypesCoverDatatypes(t *testing.T) {
+
+	for _, datatype := range WikibaseDataTypes {
+		if _, ok := sparqlPropertyTypes[datatype]; !ok {
+			t.Errorf("No SPARQL property type for %s", datatype)
+		}
+	}
+}
+
+func TestLabelLookupPrefersSPARQL(t *testing.T) {
+
+	var sent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.FormValue("query")
+		w.Header().Set("Content-Type", "application/sparql-results+json")
+		w.Write([]byte(`
+{
+  "head" : { "vars" : [ "entity" ] },
+  "results" : {
+    "bindings" : [
+      { "entity" : { "type" : "uri", "value" : "http://www.wikidata.org/entity/Q42" } },
+      { "entity" : { "type" : "uri", "value" : "http://www.wikidata.org/entity/P42" } }
+    ]
+  }
+}`))
+	}))
+	defer server.Close()
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.SPARQLEndpoint = server.URL
+	wikibase.PreferSPARQLReads = true
+
+	ids, err := wikibase.FetchItemIDsForLabel(`Douglas "DNA" Adams`)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"Q42"}) {
+		t.Errorf("We got unexpected IDs: %v", ids)
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Expected the action API not to be used: %v", client)
+	}
+	expected := "PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>\n" +
+		`SELECT ?entity WHERE { ?entity rdfs:label "Douglas \"DNA\" Adams"@en . }`
+	if sent != expected {
+		t.Errorf("We sent an unexpected query:\n%s", sent)
+	}
+}
+
+func TestLabelLookupTrustsEmptySPARQLResult(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/sparql-results+json")
+		w.Write([]byte(`{"head": {"vars": ["entity"]}, "results": {"bindings": []}}`))
+	}))
+	defer server.Close()
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+	wikibase.SPARQLEndpoint = server.URL
+	wikibase.PreferSPARQLReads = true
+
+	ids, err := wikibase.FetchItemIDsForLabel("new item")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("We got unexpected IDs: %v", ids)
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Expected the action API not to be used: %v", client)
+	}
+}
+
+func TestLabelLookupFallsBackToAPI(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Item:Q99","pageid":99,"displaytext":"new item"}]}}`)
+	wikibase := NewClient(client)
+	wikibase.SPARQLEndpoint = server.URL
+	wikibase.PreferSPARQLReads = true
+
+	ids, err := wikibase.FetchItemIDsForLabel("new item")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"Q99"}) {
+		t.Errorf("We got unexpected IDs: %v", ids)
+	}
+	if client.InvocationCount != 1 || client.LastArgs()["list"] != "wbsearch" {
+		t.Errorf("Expected the action API to be used: %v", client.LastArgs())
+	}
+}
+
+func TestIsInstanceOf(t *testing.T) {
+
+	var sent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.FormValue("query")
+		w.Header().Set("Content-Type", "application/sparql-results+json")
+		if strings.Contains(sent, "wd:Q5 ") {
+			w.Write([]byte(`{"head": {"vars": ["item"]}, "results": {"bindings": [
+				{"item": {"type": "uri", "value": "http://www.wikidata.org/entity/Q42"}}]}}`))
+		} else if strings.Contains(sent, "wd:Q215627 ") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.Write([]byte(`{"head": {"vars": ["item"]}, "results": {"bindings": []}}`))
+		}
+	}))
+	defer server.Close()
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{
+    "claims": {
+        "P31": [
+            {"mainsnak": {"snaktype": "value", "property": "P31",
+                          "datavalue": {"value": {"entity-type": "item", "numeric-id": 5, "id": "Q5"},
+                                        "type": "wikibase-entityid"}},
+             "type": "statement", "id": "Q42$1", "rank": "normal"}
+        ]
+    }
+}
+`)
+	wikibase := NewClient(client)
+	wikibase.SPARQLEndpoint = server.URL
+	wikibase.PreferSPARQLReads = true
+
+	found, err := wikibase.IsInstanceOf("Q42", "Q5")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !found {
+		t.Errorf("Expected Q42 to be an instance of Q5")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Expected the action API not to be used: %v", client)
+	}
+	expected := "PREFIX wd: <http://www.wikidata.org/entity/>\n" +
+		"PREFIX wdt: <http://www.wikidata.org/prop/direct/>\n" +
+		"SELECT ?item WHERE { BIND(wd:Q42 AS ?item) ?item wdt:P31 wd:Q5 . } LIMIT 1"
+	if sent != expected {
+		t.Errorf("We sent an unexpected query:\n%s", sent)
+	}
+
+	// A negative answer from SPARQL is trusted
+	found, err = wikibase.IsInstanceOf("Q42", "Q43229")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if found {
+		t.Errorf("Did not expect Q42 to be an instance of Q43229")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Expected the action API not to be used: %v", client)
+	}
+
+	// If the SPARQL query fails the action API is used
+	found, err = wikibase.IsInstanceOf("Q42", "Q215627")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if found {
+		t.Errorf("Did not expect Q42 to be an instance of Q215627")
+	}
+	if client.InvocationCount != 1 || client.LastArgs()["property"] != "P31" {
+		t.Errorf("Expected the action API to be used: %v", client.LastArgs())
+	}
+}
@@ -0,0 +1,253 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// MaxEntitiesPerRequest is the number of entities that can be fetched in a single wbgetentities call by a normal
+// user. Requests for more are split into chunks of this size.
+const MaxEntitiesPerRequest = 50
+
+// EntityTerms are the labels and descriptions of an entity, as maps of language to text.
+type EntityTerms struct {
+	Labels       map[string]string
+	Descriptions map[string]string
+}
+
+// FetchTerms fetches the labels and descriptions of many entities at once, such as for building a display cache,
+// splitting the IDs into as few requests as possible. If languages is empty then terms in all languages are returned.
+// The result is keyed by the IDs as given, even if the entity is a redirect, and entities that do not exist are left
+// out of it.
+func (c *Client) FetchTerms(ids []ItemPropertyType, languages []string) (map[ItemPropertyType]EntityTerms, error) {
+
+	terms := make(map[ItemPropertyType]EntityTerms, len(ids))
+
+	unique := make([]ItemPropertyType, 0, len(ids))
+	seen := make(map[ItemPropertyType]bool, len(ids))
+	for _, id := range ids {
+		if len(id) == 0 {
+			return nil, fmt.Errorf("Entity ID must not be an empty string.")
+		}
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	for start := 0; start < len(unique); start += MaxEntitiesPerRequest {
+		end := start + MaxEntitiesPerRequest
+		if end > len(unique) {
+			end = len(unique)
+		}
+		err := c.fetchTermsChunk(unique[start:end], languages, terms)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return terms, nil
+}
+
+func (c *Client) fetchTermsChunk(ids []ItemPropertyType, languages []string,
+	terms map[ItemPropertyType]EntityTerms) error {
+
+	id_list := make([]string, len(ids))
+	requested := make(map[ItemPropertyType]bool, len(ids))
+	for i, id := range ids {
+		id_list[i] = string(id)
+		requested[id] = true
+	}
+
+	args := map[string]string{
+		"action": "wbgetentities",
+		"ids":    strings.Join(id_list, "|"),
+		"props":  "labels|descriptions",
+	}
+	if len(languages) > 0 {
+		args["languages"] = strings.Join(languages, "|")
+	}
+
+	response, err := c.get(args)
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+
+	var res getEntitiesResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return err
+	}
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	for key, entity := range res.Entities {
+		if entity.Missing != nil {
+			continue
+		}
+		// Redirected entities may be returned under the target ID, so map them back to the ID asked for
+		id := ItemPropertyType(key)
+		if !requested[id] && entity.Redirects != nil && requested[entity.Redirects.From] {
+			id = entity.Redirects.From
+		}
+		if !requested[id] {
+			continue
+		}
+
+		entity_terms := EntityTerms{
+			Labels:       make(map[string]string, len(entity.Labels)),
+			Descriptions: make(map[string]string, len(entity.Descriptions)),
+		}
+		for language, label := range entity.Labels {
+			entity_terms.Labels[language] = label.Value
+		}
+		for language, description := range entity.Descriptions {
+			entity_terms.Descriptions[language] = description.Value
+		}
+		terms[id] = entity_terms
+	}
+
+	return nil
+}
+
+// SetLabel sets the label of the entity in the given language. An empty value removes the label in that language.
+func (c *Client) SetLabel(id ItemPropertyType, language string, value string) error {
+	return c.setTerm("wbsetlabel", id, language, value)
+}
+
+// SetDescription sets the description of the entity in the given language. An empty value removes the description
+// in that language.
+func (c *Client) SetDescription(id ItemPropertyType, language string, value string) error {
+	return c.setTerm("wbsetdescription", id, language, value)
+}
+
+// SetItemTerms sets the labels and descriptions of the entity in many languages at once, in a single atomic edit. Both
+// are maps of language to text, and as with SetLabel and SetDescription an empty value removes the term in that
+// language. Languages not in the maps are left as they are.
+func (c *Client) SetItemTerms(id ItemPropertyType, labels map[string]string, descriptions map[string]string) error {
+
+	if len(id) == 0 {
+		return fmt.Errorf("Entity ID must not be an empty string.")
+	}
+	if len(labels) == 0 && len(descriptions) == 0 {
+		return fmt.Errorf("No terms given to set on %s", id)
+	}
+
+	data := struct {
+		Labels       map[string]itemLabel `json:"labels,omitempty"`
+		Descriptions map[string]itemLabel `json:"descriptions,omitempty"`
+	}{
+		Labels:       make(map[string]itemLabel, len(labels)),
+		Descriptions: make(map[string]itemLabel, len(descriptions)),
+	}
+	for language, value := range labels {
+		if len(language) == 0 {
+			return fmt.Errorf("Language must not be an empty string.")
+		}
+		data.Labels[language] = itemLabel{Language: language, Value: value}
+	}
+	for language, value := range descriptions {
+		if len(language) == 0 {
+			return fmt.Errorf("Language must not be an empty string.")
+		}
+		data.Descriptions[language] = itemLabel{Language: language, Value: value}
+	}
+
+	b, err := json.Marshal(&data)
+	if err != nil {
+		return err
+	}
+
+	editToken, terr := c.GetEditingToken()
+	if terr != nil {
+		return terr
+	}
+
+	response, err := c.editPost(
+		map[string]string{
+			"action": "wbeditentity",
+			"token":  editToken,
+			"id":     string(id),
+			"data":   string(b),
+			"bot":    "1",
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+
+	var entity itemEntity
+	err = decodeEnvelope(response, "entity", &entity)
+	if err != nil {
+		return err
+	}
+
+	if entity.ID != id {
+		return fmt.Errorf("Unexpected entity %s in response from server when updating %s", entity.ID, id)
+	}
+
+	return nil
+}
+
+func (c *Client) setTerm(action string, id ItemPropertyType, language string, value string) error {
+
+	if len(id) == 0 {
+		return fmt.Errorf("Entity ID must not be an empty string.")
+	}
+	if len(language) == 0 {
+		return fmt.Errorf("Language must not be an empty string.")
+	}
+
+	editToken, terr := c.GetEditingToken()
+	if terr != nil {
+		return terr
+	}
+
+	response, err := c.editPost(
+		map[string]string{
+			"action":   action,
+			"token":    editToken,
+			"id":       string(id),
+			"language": language,
+			"value":    value,
+			"bot":      "1",
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+
+	var entity itemEntity
+	err = decodeEnvelope(response, "entity", &entity)
+	if err != nil {
+		return err
+	}
+
+	if entity.ID != id {
+		return fmt.Errorf("Unexpected entity %s in response from server when updating %s", entity.ID, id)
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+//   Copyright 2018 Content Mine Ltd
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package wikibase
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeEnvelope(t *testing.T) {
+
+	var entity itemEntity
+	err := decodeEnvelope(strings.NewReader(`
+{"entity":{"labels":{"en":{"language":"en","value":"hello"}},"id":"Q42","type":"item","lastrevid":123},"success":1}
+`), "entity", &entity)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if entity.ID != "Q42" || entity.LastRevisionID != 123 || entity.Labels["en"].Value != "hello" {
+		t.Errorf("Entity was not decoded: %v", entity)
+	}
+
+	var edit articleEditDetailResponse
+	err = decodeEnvelope(strings.NewReader(`
+{"edit":{"result":"Success","pageid":94,"title":"Article:Hello","contentmodel":"wikitext","newrevid":371}}
+`), "edit", &edit)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if edit.PageID != 94 {
+		t.Errorf("Edit was not decoded: %v", edit)
+	}
+}
+
+func TestDecodeEnvelopeError(t *testing.T) {
+
+	err := decodeEnvelope(strings.NewReader(`
+{"error":{"code":"no-such-entity","info":"Could not find an entity with the ID \"Q999\"."}}
+`), "entity", nil)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	api_err, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("We expected an API error, got %T: %v", err, err)
+	}
+	if api_err.Code != "no-such-entity" {
+		t.Errorf("Wrong error code: %v", api_err)
+	}
+}
+
+func TestDecodeEnvelopeMissingKey(t *testing.T) {
+
+	err := decodeEnvelope(strings.NewReader(`{"success":1,"pageinfo":{"lastrevid":123}}`), "entity", nil)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if !strings.Contains(err.Error(), "entity") {
+		t.Errorf("Error should mention the missing key: %v", err)
+	}
+}
+
+func TestSetLabel(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"labels":{"fr":{"language":"fr","value":"bonjour"}},"id":"Q42","type":"item","lastrevid":123},"success":1}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetLabel("Q42", "fr", "bonjour")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+
+	args := client.LastArgs()
+	if args["action"] != "wbsetlabel" || args["id"] != "Q42" || args["language"] != "fr" || args["value"] != "bonjour" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+}
+
+func TestSetDescriptionMissingEntity(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"success":1}`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetDescription("Q42", "en", "A thing")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.LastArgs()["action"] != "wbsetdescription" {
+		t.Errorf("Unexpected request: %v", client.LastArgs())
+	}
+}
+
+func TestFetchTerms(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entities":{
+    "Q1":{"type":"item","id":"Q1",
+        "labels":{"en":{"language":"en","value":"universe"},"fr":{"language":"fr","value":"univers"}},
+        "descriptions":{"en":{"language":"en","value":"totality of space and time"}}},
+    "Q2":{"id":"Q2","missing":""},
+    "Q100":{"type":"item","id":"Q100","redirects":{"from":"Q3","to":"Q100"},
+        "labels":{"en":{"language":"en","value":"happiness"}},"descriptions":{}}
+},"success":1}
+`)
+	client.AddResponse(`
+{"entities":{
+    "Q51":{"type":"item","id":"Q51",
+        "labels":{"fr":{"language":"fr","value":"Antarctique"}},
+        "descriptions":{"fr":{"language":"fr","value":"continent"}}}
+},"success":1}
+`)
+	wikibase := NewClient(client)
+
+	ids := make([]ItemPropertyType, 0, 52)
+	for i := 1; i <= 51; i++ {
+		ids = append(ids, ItemPropertyType(fmt.Sprintf("Q%d", i)))
+	}
+	// Duplicates are only asked for once
+	ids = append(ids, "Q1")
+
+	terms, err := wikibase.FetchTerms(ids, []string{"en", "fr"})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Expected the IDs to be fetched in two chunks, got %d requests", client.InvocationCount)
+	}
+	if len(terms) != 3 {
+		t.Errorf("We got the wrong number of entities: %v", terms)
+	}
+	if terms["Q1"].Labels["en"] != "universe" || terms["Q1"].Labels["fr"] != "univers" {
+		t.Errorf("We got the wrong labels for Q1: %v", terms["Q1"])
+	}
+	if terms["Q1"].Descriptions["en"] != "totality of space and time" {
+		t.Errorf("We got the wrong descriptions for Q1: %v", terms["Q1"])
+	}
+	if _, ok := terms["Q2"]; ok {
+		t.Errorf("Did not expect a missing entity: %v", terms["Q2"])
+	}
+	if terms["Q3"].Labels["en"] != "happiness" {
+		t.Errorf("Expected redirect to be keyed by the ID asked for: %v", terms)
+	}
+	if terms["Q51"].Labels["fr"] != "Antarctique" || terms["Q51"].Descriptions["fr"] != "continent" {
+		t.Errorf("We got the wrong terms for Q51: %v", terms["Q51"])
+	}
+
+	args := client.LastArgs()
+	if args["action"] != "wbgetentities" || args["ids"] != "Q51" || args["props"] != "labels|descriptions" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+	if args["languages"] != "en|fr" {
+		t.Errorf("Unexpected languages requested: %v", args)
+	}
+}
+
+func TestSetItemTerms(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"entity":{"labels":{"en":{"language":"en","value":"Cambridge"},"de":{"language":"de","value":"Cambridge"}},"descriptions":{"en":{"language":"en","value":"city in England"}},"id":"Q350","type":"item","lastrevid":124},"success":1}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.SetItemTerms("Q350",
+		map[string]string{"en": "Cambridge", "de": "Cambridge"},
+		map[string]string{"en": "city in England", "fr": ""})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Expected all terms in one request, got %d", client.InvocationCount)
+	}
+
+	args := client.LastArgs()
+	if args["action"] != "wbeditentity" || args["id"] != "Q350" || args["token"] != "insertokenhere" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+
+	var data struct {
+		Labels       map[string]itemLabel `json:"labels"`
+		Descriptions map[string]itemLabel `json:"descriptions"`
+		Claims       interface{}          `json:"claims"`
+	}
+	err = json.Unmarshal([]byte(args["data"]), &data)
+	if err != nil {
+		t.Fatalf("Failed to decode data sent: %v", err)
+	}
+	expected_labels := map[string]itemLabel{
+		"en": {Language: "en", Value: "Cambridge"},
+		"de": {Language: "de", Value: "Cambridge"},
+	}
+	if !reflect.DeepEqual(data.Labels, expected_labels) {
+		t.Errorf("Unexpected labels sent: %v", data.Labels)
+	}
+	expected_descriptions := map[string]itemLabel{
+		"en": {Language: "en", Value: "city in England"},
+		"fr": {Language: "fr", Value: ""},
+	}
+	if !reflect.DeepEqual(data.Descriptions, expected_descriptions) {
+		t.Errorf("Unexpected descriptions sent: %v", data.Descriptions)
+	}
+	if data.Claims != nil {
+		t.Errorf("Did not expect claims to be sent: %v", args["data"])
+	}
+}
+
+func TestSetItemTermsNothingToSet(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+
+	err := wikibase.SetItemTerms("Q350", nil, map[string]string{})
+	if err == nil {
+		t.Errorf("We expected an error")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %d", client.InvocationCount)
+	}
+}
@@ -19,9 +19,11 @@ package wikibase
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // The Wikibase/media wiki client struct. Create this with a call to NewClient, passing it a valid network
@@ -33,20 +35,293 @@ type Client struct {
 	editToken     *string
 	editTokenLock sync.RWMutex
 
+	// Tokens other than the editing token, keyed by type. Don't read directly - use GetToken()
+	tokens     map[string]string
+	tokensLock sync.Mutex
+
 	// Mapping of labels to IDs for Items and Properties.
 	PropertyMap map[string]string
 	ItemMap     map[string]ItemPropertyType
+
+	// For property tags that list fallback labels, such as "birth date|date of birth", this maps the tag to the
+	// label that was found on the server.
+	ResolvedPropertyLabels map[string]string
+
+	// The language used for labels when creating and searching for items and properties. Defaults to "en".
+	Language string
+
+	// If set, overrides Language for the labels of properties, for when properties should be labelled consistently
+	// in one language whilst items use the local language.
+	PropertyLabelLanguage string
+
+	// If set, only properties with these datatypes can be created, and attempts to create properties of other
+	// datatypes will fail.
+	AllowedCreateDatatypes []string
+
+	// If set, this is called before MapPropertyAndItemConfiguration creates a missing property, with the label and
+	// the datatype inferred from the struct field. Returning an error stops the property being created, and the
+	// error is returned from MapPropertyAndItemConfiguration.
+	BeforeCreateProperty func(label string, datatype string) error
+
+	// The ID of the property used for property constraint statements. Defaults to P2302 as used on Wikidata.
+	ConstraintPropertyID string
+
+	// Change tags to apply to all edits made by the client. The tags must already be registered on the wiki.
+	EditTags []string
+
+	// If set, article edits made by the client are marked as minor edits.
+	MinorEdits bool
+
+	// If set, all edits are made with the assertion that they are made as this user, and will fail if the
+	// credentials used are for another account.
+	AssertUser string
+
+	// If set, all edits are made with this watchlist setting, which is one of "watch", "unwatch", "preferences", or
+	// "nochange", so bots can watch the items they edit to spot later changes by others.
+	Watchlist string
+
+	// If greater than zero, limits the number of write requests that can be in flight at once across all
+	// go-routines using this client. Set this before making any requests.
+	MaxConcurrentWrites int
+
+	// If set along with MaxConcurrentWrites, the number of writes allowed in flight is adapted to server load, in
+	// the same way as TCP congestion control: it is halved each time a write is rejected for maxlag, and raised by
+	// one again after each run of that many writes without, up to MaxConcurrentWrites. The current limit is
+	// reported as MetricWriteConcurrency whenever it changes.
+	AdaptiveConcurrency bool
+
+	writeLock      sync.Mutex
+	writeCond      *sync.Cond
+	writeLimit     int
+	writesInFlight int
+	writeSuccesses int
+	writeLimitOnce sync.Once
+
+	// If set, writes send this as the maxlag parameter, so the server rejects them when its replication lag in
+	// seconds is higher than this, as is recommended for bots.
+	MaxLag int
+
+	// The maximum number of times a single write will be retried, across all causes. Writes are retried after
+	// rejections the server gives before making any changes: maxlag and rate limit errors, HTTP 429, and HTTP 503
+	// with a Retry-After header. Network errors and other 5xx responses are only retried for writes that can check
+	// whether the failed attempt took effect. Zero, the default, means writes are not retried.
+	MaxRetries int
+
+	// The delay before the first retry of a write, which is doubled on each subsequent retry.
+	RetryDelay time.Duration
+
+	// Parameters added to every request made by the client, such as a centralauthtoken. Parameters set by the
+	// request itself take precedence.
+	DefaultParams map[string]string
+
+	// If set, this is called to report metrics about the client, such as retries, so that operators can monitor
+	// them. See the Metric constants for the names used.
+	Metrics func(name string, value int)
+
+	// If non-zero, label searches that find nothing are remembered for this long, and repeated searches for
+	// the same label within that window will not go to the server. Off by default, as items or properties
+	// created by other clients in that window will not be seen.
+	NegativeLookupCacheTTL time.Duration
+
+	// Mapping of entity ID prefixes to entity types, for Wikibase instances that don't use the standard Q, P, and L
+	// prefixes. If nil then DefaultEntityTypePrefixes is used.
+	EntityTypePrefixes map[string]string
+
+	// The start of the URIs the wiki uses for its entities, such as "https://example.org/entity/", used for the
+	// units of quantities and the globes of coordinates. If empty then DefaultConceptBaseURI is used.
+	ConceptBaseURI string
+
+	// Mapping of entity types to the namespace their pages are in, for Wikibase instances that don't use the
+	// default namespaces. An empty namespace means the main namespace. If nil then DefaultEntityNamespaces is used.
+	EntityNamespaces map[string]string
+
+	// The URL of the SPARQL query service for the wiki, such as "https://query.wikidata.org/sparql", used by the
+	// client methods that need SPARQL.
+	SPARQLEndpoint string
+
+	// Prefixes declared at the start of SPARQL queries made by the client, mapping prefix names to IRIs. These
+	// override the prefixes in DefaultSPARQLPrefixes, so Wikibase installs using their own entity or ontology IRIs
+	// can set "wd", "wdt", and "wikibase" here.
+	SPARQLPrefixes map[string]string
+
+	// If set, label lookups and IsInstanceOf are answered with the SPARQL endpoint where possible, to take load off
+	// the action API, which is only used if the SPARQL query fails. The query service can lag behind edits, so an
+	// answer of not found may be out of date, which matters if missing items or properties are then created. Off by
+	// default, and has no effect if SPARQLEndpoint is not set.
+	PreferSPARQLReads bool
+
+	// The ID of the "instance of" property, used by IsInstanceOf. If not set, DefaultInstanceOfProperty is used.
+	InstanceOfProperty string
+
+	// The ID of the property holding the formatter URLs of external identifier properties, used by
+	// ResolveExternalID. If not set, DefaultFormatterURLProperty is used.
+	FormatterURLProperty string
+
+	// The site ID, such as "enwiki", used for sitelinks when the caller does not give one, for bots that only link
+	// to a single project.
+	DefaultSitelinkSite string
+
+	// The items that bool fields are uploaded as, such as items for "yes" and "no". These must be set before
+	// uploading a struct with bool fields, as there are no standard items for them.
+	BooleanTrueItem  ItemPropertyType
+	BooleanFalseItem ItemPropertyType
+
+	// The globe used for coordinate claims that don't specify one. If not set, EarthGlobe is used.
+	DefaultGlobe ItemPropertyType
+
+	// Namespace IDs keyed by namespace name, fetched from the server when first needed
+	namespaceIDs     map[string]int
+	namespaceIDsLock sync.Mutex
+
+	negativeLookupCache     map[string]time.Time
+	negativeLookupCacheLock sync.Mutex
+
+	// String value normalizers keyed by property label. Don't set directly - use RegisterValueNormalizer()
+	valueNormalizers     map[string]func(string) string
+	valueNormalizersLock sync.RWMutex
 }
 
 // NewClient is a factory method for creating a new Client object.
 func NewClient(oauthClient NetworkClientInterface) *Client {
 	return &Client{
-		client:      oauthClient,
-		PropertyMap: make(map[string]string, 0),
-		ItemMap:     make(map[string]ItemPropertyType, 0),
+		client:                 oauthClient,
+		PropertyMap:            make(map[string]string, 0),
+		ItemMap:                make(map[string]ItemPropertyType, 0),
+		ResolvedPropertyLabels: make(map[string]string, 0),
+	}
+}
+
+// semaphoreReadCloser releases a write slot when the response is closed.
+type semaphoreReadCloser struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (r *semaphoreReadCloser) Close() error {
+	r.once.Do(r.release)
+	return r.ReadCloser.Close()
+}
+
+func (c *Client) initWriteLimit() {
+	c.writeLimitOnce.Do(func() {
+		c.writeLimit = c.MaxConcurrentWrites
+		c.writeCond = sync.NewCond(&c.writeLock)
+	})
+}
+
+// acquireWriteSlot blocks until there are fewer than the current write limit of writes in flight, and returns the
+// function to call to release the slot again.
+func (c *Client) acquireWriteSlot() func() {
+	if c.MaxConcurrentWrites <= 0 {
+		return func() {}
+	}
+	c.initWriteLimit()
+	c.writeLock.Lock()
+	for c.writesInFlight >= c.writeLimit {
+		c.writeCond.Wait()
+	}
+	c.writesInFlight += 1
+	c.writeLock.Unlock()
+
+	return func() {
+		c.writeLock.Lock()
+		c.writesInFlight -= 1
+		c.writeCond.Broadcast()
+		c.writeLock.Unlock()
+	}
+}
+
+// adjustWriteConcurrency updates the adaptive write limit after a write got a response, which was either a maxlag
+// error or not.
+func (c *Client) adjustWriteConcurrency(maxlag bool) {
+	if !c.AdaptiveConcurrency || c.MaxConcurrentWrites <= 0 {
+		return
+	}
+	c.initWriteLimit()
+	c.writeLock.Lock()
+	previous := c.writeLimit
+	if maxlag {
+		c.writeLimit /= 2
+		if c.writeLimit < 1 {
+			c.writeLimit = 1
+		}
+		c.writeSuccesses = 0
+	} else {
+		c.writeSuccesses += 1
+		if c.writeSuccesses >= c.writeLimit && c.writeLimit < c.MaxConcurrentWrites {
+			c.writeLimit += 1
+			c.writeSuccesses = 0
+			c.writeCond.Broadcast()
+		}
+	}
+	current := c.writeLimit
+	c.writeLock.Unlock()
+
+	if current != previous {
+		c.reportMetric(MetricWriteConcurrency, current)
 	}
 }
 
+// addDefaultParams adds the client's DefaultParams to the request arguments, without overriding any already set.
+func (c *Client) addDefaultParams(args map[string]string) {
+	for key, value := range c.DefaultParams {
+		if _, ok := args[key]; !ok {
+			args[key] = value
+		}
+	}
+}
+
+// get is used for all read actions.
+func (c *Client) get(args map[string]string) (io.ReadCloser, error) {
+	c.addDefaultParams(args)
+	return c.client.Get(args)
+}
+
+// editPost is used for all write actions, and adds the common editing arguments set on the client to the request.
+func (c *Client) editPost(args map[string]string) (io.ReadCloser, error) {
+	return c.editPostWithRetryCheck(args, nil)
+}
+
+// editPostWithRetryCheck is like editPost, but for writes that are not idempotent, where check is used to see if an
+// attempt that failed took effect anyway before it is retried.
+func (c *Client) editPostWithRetryCheck(args map[string]string, check retryCheck) (io.ReadCloser, error) {
+	if len(c.EditTags) > 0 {
+		args["tags"] = strings.Join(c.EditTags, "|")
+	}
+	if len(c.AssertUser) > 0 {
+		args["assertuser"] = c.AssertUser
+	}
+	if len(c.Watchlist) > 0 {
+		switch c.Watchlist {
+		case "watch", "unwatch", "preferences", "nochange":
+			args["watchlist"] = c.Watchlist
+		default:
+			return nil, fmt.Errorf("Watchlist setting %s is not valid", c.Watchlist)
+		}
+	}
+
+	if c.MaxLag > 0 {
+		args["maxlag"] = strconv.Itoa(c.MaxLag)
+	}
+	c.addDefaultParams(args)
+
+	// The write is in flight until the caller has finished reading the response
+	release := c.acquireWriteSlot()
+	var response io.ReadCloser
+	var err error
+	if c.MaxRetries > 0 || c.AdaptiveConcurrency {
+		response, err = c.postWithRetries(args, check)
+	} else {
+		response, err = c.client.Post(args)
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &semaphoreReadCloser{ReadCloser: response, release: release}, nil
+}
+
 // GetEditingToken returns an already acquired editing token for this session, or fetches a new one if necessary. This
 // method is thread safe.
 func (c *Client) GetEditingToken() (string, error) {
@@ -68,7 +343,7 @@ func (c *Client) GetEditingToken() (string, error) {
 		return *c.editToken, nil
 	}
 
-	response, err := c.client.Get(
+	response, err := c.get(
 		map[string]string{
 			"action": "query",
 			"meta":   "tokens",
@@ -95,15 +370,182 @@ func (c *Client) GetEditingToken() (string, error) {
 	return *c.editToken, nil
 }
 
+// GetToken returns an already acquired token of the given type for this session (e.g. "patrol" or "rollback"), or
+// fetches a new one if necessary. A type of "csrf" is the same as calling GetEditingToken. This method is thread safe.
+func (c *Client) GetToken(token_type string) (string, error) {
+
+	if token_type == "csrf" {
+		return c.GetEditingToken()
+	}
+
+	c.tokensLock.Lock()
+	defer c.tokensLock.Unlock()
+
+	if token, ok := c.tokens[token_type]; ok {
+		return token, nil
+	}
+
+	response, err := c.get(
+		map[string]string{
+			"action": "query",
+			"meta":   "tokens",
+			"type":   token_type,
+		},
+	)
+
+	if err != nil {
+		return "", err
+	}
+	defer response.Close()
+
+	var res typedTokenRequestResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return "", err
+	}
+	if res.Error != nil {
+		return "", res.Error
+	}
+
+	token, ok := res.Query.Tokens[token_type+"token"]
+	if !ok {
+		return "", fmt.Errorf("Failed to get %s token in response from server: %v", token_type, res)
+	}
+
+	if c.tokens == nil {
+		c.tokens = make(map[string]string)
+	}
+	c.tokens[token_type] = token
+
+	return token, nil
+}
+
+// Ping makes a lightweight authenticated request to the server, returning an error if the server can not be reached
+// or if the request was not made as a logged in user. This is useful to fail fast before starting a long job.
+func (c *Client) Ping() error {
+
+	info, err := c.UserInfo()
+	if err != nil {
+		return err
+	}
+
+	if info.IsAnonymous() {
+		return fmt.Errorf("Requests are not authenticated, server sees us as anonymous user %s", info.Name)
+	}
+
+	return nil
+}
+
+// UserInfo returns the name, groups, and rights of the account the client is acting as. This lets bots check they
+// have rights such as "bot" or "editprotected" before attempting edits that need them.
+func (c *Client) UserInfo() (*UserInfo, error) {
+
+	response, err := c.get(
+		map[string]string{
+			"action": "query",
+			"meta":   "userinfo",
+			"uiprop": "rights|groups",
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	defer response.Close()
+
+	var res userInfoResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	return &res.Query.UserInfo, nil
+}
+
+// negativeLookupCacheKey returns the key for a label search in the negative lookup cache. Searches are in the label
+// language, so a label missing in one language may still be found in another.
+func (c *Client) negativeLookupCacheKey(thing WikiBaseType, label string) string {
+	return fmt.Sprintf("%s:%s:%s", thing, c.labelLanguage(thing), label)
+}
+
+// isKnownMissingLabel returns true if a previous search for the label found nothing within the cache TTL.
+func (c *Client) isKnownMissingLabel(thing WikiBaseType, label string) bool {
+	if c.NegativeLookupCacheTTL == 0 {
+		return false
+	}
+
+	c.negativeLookupCacheLock.Lock()
+	defer c.negativeLookupCacheLock.Unlock()
+
+	key := c.negativeLookupCacheKey(thing, label)
+	expiry, ok := c.negativeLookupCache[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(c.negativeLookupCache, key)
+		return false
+	}
+	return true
+}
+
+func (c *Client) setKnownMissingLabel(thing WikiBaseType, label string) {
+	if c.NegativeLookupCacheTTL == 0 {
+		return
+	}
+
+	c.negativeLookupCacheLock.Lock()
+	defer c.negativeLookupCacheLock.Unlock()
+
+	if c.negativeLookupCache == nil {
+		c.negativeLookupCache = make(map[string]time.Time)
+	}
+	c.negativeLookupCache[c.negativeLookupCacheKey(thing, label)] = time.Now().Add(c.NegativeLookupCacheTTL)
+}
+
+// clearKnownMissingLabel is used when we create a thing with a label, so it's no longer missing.
+func (c *Client) clearKnownMissingLabel(thing WikiBaseType, label string) {
+	c.negativeLookupCacheLock.Lock()
+	defer c.negativeLookupCacheLock.Unlock()
+
+	delete(c.negativeLookupCache, c.negativeLookupCacheKey(thing, label))
+}
+
+// labelLanguage returns the language to use for the labels of the given type of thing.
+func (c *Client) labelLanguage(thing WikiBaseType) string {
+	if thing == WikiBaseProperty && len(c.PropertyLabelLanguage) > 0 {
+		return c.PropertyLabelLanguage
+	}
+	if len(c.Language) > 0 {
+		return c.Language
+	}
+	return "en"
+}
+
 func (c *Client) getWikibaseThingIDForLabel(thing WikiBaseType, label string) ([]string, error) {
 
-	response, err := c.client.Get(
+	if c.isKnownMissingLabel(thing, label) {
+		return make([]string, 0), nil
+	}
+
+	if c.PreferSPARQLReads && len(c.SPARQLEndpoint) > 0 {
+		ids, err := c.sparqlIDsForLabel(thing, label)
+		if err == nil {
+			return ids, nil
+		}
+	}
+
+	response, err := c.get(
 		map[string]string{
 			"action":      "query",
 			"list":        "wbsearch",
 			"wbssearch":   label,
 			"wbstype":     string(thing),
-			"wbslanguage": "en",
+			"wbslanguage": c.labelLanguage(thing),
 		},
 	)
 
@@ -124,14 +566,20 @@ func (c *Client) getWikibaseThingIDForLabel(thing WikiBaseType, label string) ([
 	for _, item := range search.Query.Items {
 		if item.DisplayText == label {
 
-			parts := strings.Split(item.Title, ":")
-			if len(parts) != 2 {
+			// Titles are normally namespace:id, but the namespace is optional depending on server config
+			parts := strings.SplitN(item.Title, ":", 2)
+			id := parts[len(parts)-1]
+			if len(id) == 0 {
 				return nil, fmt.Errorf("We expected type:value in reply, but got: %v", item.Title)
 			}
-			filtered_items = append(filtered_items, parts[1])
+			filtered_items = append(filtered_items, id)
 		}
 	}
 
+	if len(filtered_items) == 0 {
+		c.setKnownMissingLabel(thing, label)
+	}
+
 	return filtered_items, nil
 }
 
@@ -147,8 +595,455 @@ func (c *Client) FetchItemIDsForLabel(label string) ([]string, error) {
 	return c.getWikibaseThingIDForLabel(WikiBaseItem, label)
 }
 
+// haswbstatementKeyword builds the CirrusSearch keyword to find pages with a statement for the property with the
+// given value, quoting the value if needed.
+func haswbstatementKeyword(property_id string, value string) string {
+	statement := fmt.Sprintf("%s=%s", property_id, value)
+	if strings.ContainsAny(statement, " \t\"\\") {
+		statement = strings.Replace(statement, `\`, `\\`, -1)
+		statement = strings.Replace(statement, `"`, `\"`, -1)
+		return fmt.Sprintf(`haswbstatement:"%s"`, statement)
+	}
+	return fmt.Sprintf("haswbstatement:%s", statement)
+}
+
+// SearchMode selects how SearchEntities matches the search text.
+type SearchMode int
+
+const (
+	// SearchPrefix matches entities with a label or alias starting with the text, as used for autocompletion.
+	SearchPrefix SearchMode = iota
+
+	// SearchFullText matches entities containing all the words of the text anywhere, using the wiki's search engine.
+	SearchFullText
+)
+
+// SearchResult is an entity found by SearchEntities, with its label and description in the client's language.
+type SearchResult struct {
+	ID          ItemPropertyType
+	Label       string
+	Description string
+}
+
+// SearchEntities searches for entities of the given type, returning up to limit results in the order the server
+// ranks them, or as many as the server gives by default if limit is zero. Unlike the exact label lookups used for
+// mapping structs, the results are not filtered, so the mode decides how the text is matched. Full text searches
+// need the wiki to be using CirrusSearch, search the namespace the client has in EntityNamespaces for the type, and
+// fetch the labels and descriptions of the results separately. Pages in that namespace that are not entities of the
+// type are dropped after the limit is applied, so full text searches can return fewer than limit results.
+func (c *Client) SearchEntities(text string, thing WikiBaseType, mode SearchMode, limit int) ([]SearchResult, error) {
+
+	if len(text) == 0 {
+		return nil, fmt.Errorf("Search text must not be an empty string.")
+	}
+	if limit < 0 {
+		return nil, fmt.Errorf("Search limit must not be negative.")
+	}
+
+	switch mode {
+	case SearchPrefix:
+		return c.searchEntitiesByPrefix(text, thing, limit)
+	case SearchFullText:
+		return c.searchEntitiesByFullText(text, thing, limit)
+	default:
+		return nil, fmt.Errorf("Unrecognised search mode %d", mode)
+	}
+}
+
+func (c *Client) searchEntitiesByPrefix(text string, thing WikiBaseType, limit int) ([]SearchResult, error) {
+
+	language := c.labelLanguage(thing)
+	args := map[string]string{
+		"action":   "wbsearchentities",
+		"search":   text,
+		"type":     string(thing),
+		"language": language,
+		"uselang":  language,
+	}
+	if limit > 0 {
+		args["limit"] = strconv.Itoa(limit)
+	}
+
+	response, err := c.get(args)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Close()
+
+	var res entitySearchResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	results := make([]SearchResult, len(res.Search))
+	for i, match := range res.Search {
+		results[i] = SearchResult{ID: match.ID, Label: match.Label, Description: match.Description}
+	}
+	return results, nil
+}
+
+func (c *Client) searchEntitiesByFullText(text string, thing WikiBaseType, limit int) ([]SearchResult, error) {
+
+	namespace, err := c.entityNamespaceID(thing)
+	if err != nil {
+		return nil, err
+	}
+
+	args := map[string]string{
+		"action":      "query",
+		"list":        "search",
+		"srsearch":    text,
+		"srnamespace": strconv.Itoa(namespace),
+		"srprop":      "",
+		"srlimit":     "max",
+	}
+	if limit > 0 {
+		args["srlimit"] = strconv.Itoa(limit)
+	}
+
+	response, err := c.get(args)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Close()
+
+	var res statementSearchResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	ids := make([]ItemPropertyType, 0, len(res.Query.Search))
+	for _, result := range res.Query.Search {
+		// Titles are normally namespace:id, but the namespace is optional depending on server config
+		parts := strings.SplitN(result.Title, ":", 2)
+		id := ItemPropertyType(parts[len(parts)-1])
+		entity, err := c.entityClaimToAPIData(id)
+		if err != nil || entity.EntityType != string(thing) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return make([]SearchResult, 0), nil
+	}
+
+	language := c.labelLanguage(thing)
+	terms, err := c.FetchTerms(ids, []string{language})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, len(ids))
+	for i, id := range ids {
+		results[i] = SearchResult{
+			ID:          id,
+			Label:       terms[id].Labels[language],
+			Description: terms[id].Descriptions[language],
+		}
+	}
+	return results, nil
+}
+
+// FetchItemsByStatement finds the items that have a statement for the property with the given ID and value, such as
+// an external identifier like a DOI or ORCID. This uses the haswbstatement search keyword, so needs the wiki to be
+// using CirrusSearch with WikibaseCirrusSearch, and like all searches reflects the search index, which can lag behind
+// recent edits.
+func (c *Client) FetchItemsByStatement(property_id string, value string) ([]ItemPropertyType, error) {
+
+	property, err := c.entityClaimToAPIData(ItemPropertyType(property_id))
+	if err != nil {
+		return nil, err
+	}
+	if property.EntityType != "property" {
+		return nil, fmt.Errorf("We expected a property ID, not %s", property_id)
+	}
+	if len(value) == 0 {
+		return nil, fmt.Errorf("Statement value must not be an empty string.")
+	}
+
+	items := make([]ItemPropertyType, 0)
+	offset := 0
+	for {
+		args := map[string]string{
+			"action":   "query",
+			"list":     "search",
+			"srsearch": haswbstatementKeyword(property_id, value),
+			"srprop":   "",
+			"srlimit":  "max",
+		}
+		if offset > 0 {
+			args["sroffset"] = strconv.Itoa(offset)
+		}
+
+		response, err := c.get(args)
+		if err != nil {
+			return nil, err
+		}
+
+		var res statementSearchResponse
+		err = json.NewDecoder(response).Decode(&res)
+		response.Close()
+		if err != nil {
+			return nil, err
+		}
+		if res.Error != nil {
+			return nil, res.Error
+		}
+
+		for _, result := range res.Query.Search {
+			// Titles are normally namespace:id, but the namespace is optional depending on server config
+			parts := strings.SplitN(result.Title, ":", 2)
+			id := ItemPropertyType(parts[len(parts)-1])
+			entity, err := c.entityClaimToAPIData(id)
+			if err != nil || entity.EntityType != "item" {
+				continue
+			}
+			items = append(items, id)
+		}
+
+		if res.Continue == nil || res.Continue.SROffset <= offset {
+			break
+		}
+		offset = res.Continue.SROffset
+	}
+
+	return items, nil
+}
+
+// RecentChanges returns the changes made to the wiki since the given time, oldest first, following continuations
+// until all have been fetched. If namespaces is not empty then only changes to pages in those namespaces are
+// returned. Bots doing an incremental sync can pass the timestamp of the last change they saw, but should expect to
+// see that change again, as changes at exactly the given time are included.
+func (c *Client) RecentChanges(since time.Time, namespaces []int) ([]RecentChange, error) {
+
+	args := map[string]string{
+		"action":  "query",
+		"list":    "recentchanges",
+		"rcstart": since.UTC().Format(time.RFC3339),
+		"rcdir":   "newer",
+		"rcprop":  "title|ids|timestamp",
+		"rclimit": "max",
+	}
+	if len(namespaces) > 0 {
+		parts := make([]string, len(namespaces))
+		for index, namespace := range namespaces {
+			parts[index] = strconv.Itoa(namespace)
+		}
+		args["rcnamespace"] = strings.Join(parts, "|")
+	}
+
+	changes := make([]RecentChange, 0)
+	for {
+		response, err := c.get(args)
+		if err != nil {
+			return nil, err
+		}
+
+		var res recentChangesResponse
+		err = json.NewDecoder(response).Decode(&res)
+		response.Close()
+		if err != nil {
+			return nil, err
+		}
+		if res.Error != nil {
+			return nil, res.Error
+		}
+
+		changes = append(changes, res.Query.RecentChanges...)
+
+		if res.Continue == nil || len(res.Continue.RCContinue) == 0 {
+			break
+		}
+		if res.Continue.RCContinue == args["rccontinue"] {
+			return nil, fmt.Errorf("Server returned the same continuation twice: %s", res.Continue.RCContinue)
+		}
+		args["rccontinue"] = res.Continue.RCContinue
+		args["continue"] = res.Continue.Continue
+	}
+
+	return changes, nil
+}
+
+// FetchPageIDForTitle returns the page ID for the page with the given title. The server will normalise the title
+// first, so for example underscores will be treated as spaces and the first letter capitalised if the wiki is
+// configured to do so.
+func (c *Client) FetchPageIDForTitle(title string) (int, error) {
+
+	if len(title) == 0 {
+		return 0, fmt.Errorf("Page title must not be an empty string.")
+	}
+
+	response, err := c.get(
+		map[string]string{
+			"action": "query",
+			"titles": title,
+		},
+	)
+
+	if err != nil {
+		return 0, err
+	}
+	defer response.Close()
+
+	var res pageQueryResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return 0, err
+	}
+
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	canonical := res.Query.canonicalTitle(title)
+	for _, page := range res.Query.Pages {
+		if page.Title != canonical {
+			continue
+		}
+		if page.Invalid != nil {
+			return 0, fmt.Errorf("Page title %s is not valid", title)
+		}
+		if page.Missing != nil {
+			return 0, fmt.Errorf("No page found with title %s", canonical)
+		}
+		return page.PageID, nil
+	}
+
+	return 0, fmt.Errorf("Unexpected response from server: %v", res)
+}
+
+// PageIDForEntity returns the page ID of the page that stores the given entity, for page level operations such as
+// ProtectPageByID.
+func (c *Client) PageIDForEntity(id ItemPropertyType) (int, error) {
+
+	entity, err := c.entityClaimToAPIData(id)
+	if err != nil {
+		return 0, err
+	}
+
+	namespaces := c.EntityNamespaces
+	if namespaces == nil {
+		namespaces = DefaultEntityNamespaces
+	}
+	namespace, ok := namespaces[entity.EntityType]
+	if !ok {
+		return 0, fmt.Errorf("No namespace known for %s entities", entity.EntityType)
+	}
+
+	title := string(id)
+	if len(namespace) > 0 {
+		title = namespace + ":" + title
+	}
+	return c.FetchPageIDForTitle(title)
+}
+
+// entityNamespaceID returns the ID of the namespace pages for the given type of entity are in, as configured in
+// EntityNamespaces. The IDs of namespaces other than the main one are looked up on the server the first time one is
+// needed.
+func (c *Client) entityNamespaceID(thing WikiBaseType) (int, error) {
+
+	namespaces := c.EntityNamespaces
+	if namespaces == nil {
+		namespaces = DefaultEntityNamespaces
+	}
+	namespace, ok := namespaces[string(thing)]
+	if !ok {
+		return 0, fmt.Errorf("No namespace known for %s entities", thing)
+	}
+	if len(namespace) == 0 {
+		return 0, nil
+	}
+
+	c.namespaceIDsLock.Lock()
+	defer c.namespaceIDsLock.Unlock()
+
+	if c.namespaceIDs == nil {
+		response, err := c.get(
+			map[string]string{
+				"action": "query",
+				"meta":   "siteinfo",
+				"siprop": "namespaces",
+			},
+		)
+		if err != nil {
+			return 0, err
+		}
+		defer response.Close()
+
+		var res siteInfoNamespacesResponse
+		err = json.NewDecoder(response).Decode(&res)
+		if err != nil {
+			return 0, err
+		}
+		if res.Error != nil {
+			return 0, res.Error
+		}
+
+		ids := make(map[string]int, len(res.Query.Namespaces)*2)
+		for _, info := range res.Query.Namespaces {
+			ids[info.Name] = info.ID
+			if len(info.Canonical) > 0 {
+				ids[info.Canonical] = info.ID
+			}
+		}
+		c.namespaceIDs = ids
+	}
+
+	id, ok := c.namespaceIDs[namespace]
+	if !ok {
+		return 0, fmt.Errorf("Namespace %s not found on the server", namespace)
+	}
+	return id, nil
+}
+
+// CompareRevisions returns the diff between two revisions, as the HTML table rows MediaWiki uses to show diffs. If
+// either revision does not exist then a NoSuchRevisionError is returned.
+func (c *Client) CompareRevisions(from_rev int, to_rev int) (string, error) {
+
+	response, err := c.get(
+		map[string]string{
+			"action":  "compare",
+			"fromrev": strconv.Itoa(from_rev),
+			"torev":   strconv.Itoa(to_rev),
+		},
+	)
+
+	if err != nil {
+		return "", err
+	}
+	defer response.Close()
+
+	var res compareResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return "", err
+	}
+
+	if res.Error != nil {
+		if res.Error.Code == "nosuchrevid" {
+			return "", &NoSuchRevisionError{APIError: *res.Error, FromRev: from_rev, ToRev: to_rev}
+		}
+		return "", res.Error
+	}
+	if res.Compare == nil {
+		return "", fmt.Errorf("Unexpected response from server: %v", res)
+	}
+
+	return res.Compare.Body, nil
+}
+
 // CreateOrUpdateArticle will create a new mediawiki page if necessary, and set its content to the provided body text.
 // The body should be in wikitext format, or if your Mediawiki instance supports it, parsoidHTML.
+// If the page is protected and the user does not have the rights to edit it then a ProtectedPageError is returned.
+// If MinorEdits is set on the client then the edit will be marked as minor.
 func (c *Client) CreateOrUpdateArticle(title string, body string) (int, error) {
 
 	if len(title) == 0 {
@@ -160,14 +1055,17 @@ func (c *Client) CreateOrUpdateArticle(title string, body string) (int, error) {
 		return 0, terr
 	}
 
-	response, err := c.client.Post(
-		map[string]string{
-			"action": "edit",
-			"token":  editToken,
-			"title":  fmt.Sprintf("article:%s", title),
-			"text":   body,
-		},
-	)
+	args := map[string]string{
+		"action": "edit",
+		"token":  editToken,
+		"title":  fmt.Sprintf("article:%s", title),
+		"text":   body,
+	}
+	if c.MinorEdits {
+		args["minor"] = "1"
+	}
+
+	response, err := c.editPost(args)
 
 	if err != nil {
 		return 0, err
@@ -181,6 +1079,9 @@ func (c *Client) CreateOrUpdateArticle(title string, body string) (int, error) {
 	}
 
 	if res.Error != nil {
+		if res.Error.Code == "protectedpage" {
+			return 0, &ProtectedPageError{APIError: *res.Error, Title: title}
+		}
 		return 0, res.Error
 	}
 
@@ -198,7 +1099,7 @@ func (c *Client) protectPage(key string, value string) error {
 		return terr
 	}
 
-	response, err := c.client.Post(
+	response, err := c.editPost(
 		map[string]string{
 			"action":      "protect",
 			"token":       editToken,
@@ -235,3 +1136,139 @@ func (c *Client) ProtectPageByTitle(title string) error {
 func (c *Client) ProtectPageByID(page_id int) error {
 	return c.protectPage("pageid", strconv.Itoa(page_id))
 }
+
+// UndeletePageByTitle will attempt to restore all deleted revisions of the page with the given title. If the page
+// can not be restored, for example because there are no deleted revisions, then the API error with code
+// "cantundelete" is returned.
+func (c *Client) UndeletePageByTitle(title string, reason string) error {
+
+	editToken, terr := c.GetEditingToken()
+	if terr != nil {
+		return terr
+	}
+
+	response, err := c.editPost(
+		map[string]string{
+			"action": "undelete",
+			"token":  editToken,
+			"title":  title,
+			"reason": reason,
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+
+	var res undeleteResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return err
+	}
+
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.Undelete == nil {
+		return fmt.Errorf("Unexpected response from server: %v", res)
+	}
+
+	return nil
+}
+
+// WatchPage adds the page with the given title to the watchlist of the user the client is acting as, or removes it
+// if watch is false.
+func (c *Client) WatchPage(title string, watch bool) error {
+
+	if len(title) == 0 {
+		return fmt.Errorf("Page title must not be an empty string.")
+	}
+
+	watchToken, terr := c.GetToken("watch")
+	if terr != nil {
+		return terr
+	}
+
+	args := map[string]string{
+		"action": "watch",
+		"token":  watchToken,
+		"titles": title,
+	}
+	if !watch {
+		args["unwatch"] = "1"
+	}
+
+	response, err := c.editPost(args)
+
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+
+	var res watchResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return err
+	}
+
+	if res.Error != nil {
+		return res.Error
+	}
+	if len(res.Watch) != 1 {
+		return fmt.Errorf("Unexpected response from server: %v", res)
+	}
+
+	detail := res.Watch[0]
+	if detail.Invalid != nil {
+		return fmt.Errorf("Page title %s is not valid", title)
+	}
+	if (watch && detail.Watched == nil) || (!watch && detail.Unwatched == nil) {
+		return fmt.Errorf("Unexpected response from server: %v", res)
+	}
+
+	return nil
+}
+
+// PatrolRevision marks the revision with the given ID as patrolled. If the revision is not in the recent changes list
+// or the user is not allowed to patrol their own edits then a PatrolError is returned.
+func (c *Client) PatrolRevision(rev_id int) error {
+
+	patrolToken, terr := c.GetToken("patrol")
+	if terr != nil {
+		return terr
+	}
+
+	response, err := c.editPost(
+		map[string]string{
+			"action": "patrol",
+			"token":  patrolToken,
+			"revid":  strconv.Itoa(rev_id),
+		},
+	)
+
+	if err != nil {
+		return err
+	}
+	defer response.Close()
+
+	var res patrolResponse
+	err = json.NewDecoder(response).Decode(&res)
+	if err != nil {
+		return err
+	}
+
+	if res.Error != nil {
+		switch res.Error.Code {
+		case "nosuchrcid", "noautopatrol":
+			return &PatrolError{APIError: *res.Error, RevID: rev_id}
+		default:
+			return res.Error
+		}
+	}
+	if res.Patrol == nil {
+		return fmt.Errorf("Unexpected response from server: %v", res)
+	}
+
+	return nil
+}
@@ -15,67 +15,19 @@
 package wikibase
 
 import (
-	"bytes"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
-// Test network layer substitute
-
-type WikiBaseNetworkTestClientResponse struct {
-	Data  string
-	Error error
-}
-
-type WikiBaseNetworkTestClient struct {
-	InvocationCount int
-	Responses       []WikiBaseNetworkTestClientResponse
-	MostRecentArgs  map[string]string
-}
-
-func (c *WikiBaseNetworkTestClient) innerCall(args map[string]string) (io.ReadCloser, error) {
-	c.MostRecentArgs = args
-
-	resp := c.Responses[c.InvocationCount]
-	c.InvocationCount += 1
-
-	if resp.Error != nil {
-		return nil, resp.Error
-	}
-
-	return ioutil.NopCloser(bytes.NewBuffer([]byte(resp.Data))), nil
-}
-
-func (c *WikiBaseNetworkTestClient) Get(args map[string]string) (io.ReadCloser, error) {
-	return c.innerCall(args)
-}
-
-func (c *WikiBaseNetworkTestClient) Post(args map[string]string) (io.ReadCloser, error) {
-	return c.innerCall(args)
-}
-
-func (c *WikiBaseNetworkTestClient) addDataResponse(data string) {
-	if c.Responses == nil {
-		c.Responses = make([]WikiBaseNetworkTestClientResponse, 0)
-	}
-	c.Responses = append(c.Responses, WikiBaseNetworkTestClientResponse{Data: data})
-}
-
-func (c *WikiBaseNetworkTestClient) addErrorResponse(err error) {
-	if c.Responses == nil {
-		c.Responses = make([]WikiBaseNetworkTestClientResponse, 0)
-	}
-	c.Responses = append(c.Responses, WikiBaseNetworkTestClientResponse{Error: err})
-}
-
-// Actual tests
-
 func TestErrorGettingEditingToken(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addErrorResponse(fmt.Errorf("Oops"))
+	client := &MockNetworkClient{}
+	client.AddError(fmt.Errorf("Oops"))
 
 	wikibase := NewClient(client)
 
@@ -86,18 +38,18 @@ func TestErrorGettingEditingToken(t *testing.T) {
 	}
 
 	// Check that the request was also sane
-	if client.MostRecentArgs["action"] != "query" {
-		t.Errorf("Unexpected action requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["action"] != "query" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["meta"] != "tokens" {
-		t.Errorf("Unexpected action requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["meta"] != "tokens" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
 	}
 }
 
 func TestErrorGettingEditingTokenWhenAlreadyExists(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addErrorResponse(fmt.Errorf("Oops"))
+	client := &MockNetworkClient{}
+	client.AddError(fmt.Errorf("Oops"))
 
 	wikibase := NewClient(client)
 	token := "inserttokenhere"
@@ -113,15 +65,15 @@ func TestErrorGettingEditingTokenWhenAlreadyExists(t *testing.T) {
 	}
 
 	// Check that the request wasn't made
-	if len(client.MostRecentArgs) != 0 {
-		t.Errorf("Unexpected args requested: %v", client.MostRecentArgs)
+	if len(client.LastArgs()) != 0 {
+		t.Errorf("Unexpected args requested: %v", client.LastArgs())
 	}
 }
 
 func TestGettingEditingToken(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {"batchcomplete":"","query":{"tokens":{"csrftoken":"345def4e73a103a0ea37f924f999ffad5be05458+\\\\"}}}
 `)
 	wikibase := NewClient(client)
@@ -136,18 +88,104 @@ func TestGettingEditingToken(t *testing.T) {
 	}
 
 	// Check that the request was also sane
-	if client.MostRecentArgs["action"] != "query" {
-		t.Errorf("Unexpected action requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["action"] != "query" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["meta"] != "tokens" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+}
+
+func TestPing(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"userinfo":{"id":3,"name":"ContentMineBot"}}}
+`)
+	wikibase := NewClient(client)
+
+	err := wikibase.Ping()
+
+	if err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+
+	// Check that the request was also sane
+	if client.LastArgs()["action"] != "query" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["meta"] != "userinfo" {
+		t.Errorf("Unexpected meta requested: %v", client.LastArgs())
+	}
+}
+
+func TestPingAnonymous(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"userinfo":{"id":0,"name":"127.0.0.1","anon":""}}}
+`)
+	wikibase := NewClient(client)
+
+	err := wikibase.Ping()
+
+	if err == nil {
+		t.Errorf("Expected an error but didn't get one")
+	}
+}
+
+func TestPingNetworkError(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddError(fmt.Errorf("Oops"))
+	wikibase := NewClient(client)
+
+	err := wikibase.Ping()
+
+	if err == nil {
+		t.Errorf("Expected an error but didn't get one")
+	}
+}
+
+func TestUserInfo(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"userinfo":{"id":3,"name":"ContentMineBot","groups":["bot","*","user","autoconfirmed"],"rights":["read","edit","bot","createpage"]}}}
+`)
+	wikibase := NewClient(client)
+
+	info, err := wikibase.UserInfo()
+
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if info.Name != "ContentMineBot" {
+		t.Errorf("Got unexpected name: %v", info)
+	}
+	if info.IsAnonymous() {
+		t.Errorf("User should not be anonymous: %v", info)
+	}
+	if len(info.Groups) != 4 || !info.InGroup("bot") {
+		t.Errorf("Got unexpected groups: %v", info.Groups)
 	}
-	if client.MostRecentArgs["meta"] != "tokens" {
-		t.Errorf("Unexpected action requested: %v", client.MostRecentArgs)
+	if len(info.Rights) != 4 || !info.HasRight("bot") {
+		t.Errorf("Got unexpected rights: %v", info.Rights)
+	}
+	if info.HasRight("editprotected") {
+		t.Errorf("User should not have editprotected right: %v", info.Rights)
+	}
+
+	// Check that the request was also sane
+	if client.LastArgs()["uiprop"] != "rights|groups" {
+		t.Errorf("Unexpected uiprop requested: %v", client.LastArgs())
 	}
 }
 
 func TestGettingItemForLabel(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {
     "batchcomplete": "",
     "requestid": "42",
@@ -178,24 +216,24 @@ func TestGettingItemForLabel(t *testing.T) {
 	}
 
 	// Check that the request was also sane
-	if client.MostRecentArgs["action"] != "query" {
-		t.Errorf("Unexpected action requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["action"] != "query" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["list"] != "wbsearch" {
-		t.Errorf("Unexpected list requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["list"] != "wbsearch" {
+		t.Errorf("Unexpected list requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["wbssearch"] != "blah" {
-		t.Errorf("Unexpected search requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["wbssearch"] != "blah" {
+		t.Errorf("Unexpected search requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["wbstype"] != "item" {
-		t.Errorf("Unexpected type requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["wbstype"] != "item" {
+		t.Errorf("Unexpected type requested: %v", client.LastArgs())
 	}
 }
 
 func TestGettingUniqueItemForLabel(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
     	{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Item:Q6","pageid":33,"displaytext":"annotation"},{"ns":120,"title":"Item:Q101","pageid":128,"displaytext":"annotation instance"},{"ns":120,"title":"Item:Q103","pageid":130,"displaytext":"annotation instance"},{"ns":120,"title":"Item:Q105","pageid":132,"displaytext":"annotation instance"},{"ns":120,"title":"Item:Q107","pageid":134,"displaytext":"annotation instance"},{"ns":120,"title":"Item:Q109","pageid":136,"displaytext":"annotation instance"},{"ns":120,"title":"Item:Q111","pageid":138,"displaytext":"annotation instance"}]}}
 `)
 	wikibase := NewClient(client)
@@ -213,10 +251,49 @@ func TestGettingUniqueItemForLabel(t *testing.T) {
 	}
 }
 
+func TestGettingItemForLabelWithUnusualTitles(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":0,"title":"Q4","pageid":11,"displaytext":"blah"},{"ns":120,"title":"Item:Q5:extra","pageid":12,"displaytext":"blah"}]}}
+`)
+	wikibase := NewClient(client)
+
+	resp, err := wikibase.FetchItemIDsForLabel("blah")
+
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(resp) != 2 {
+		t.Fatalf("Got different response than expected: %v", resp)
+	}
+	if resp[0] != "Q4" {
+		t.Errorf("ID did not match expected: %s", resp)
+	}
+	if resp[1] != "Q5:extra" {
+		t.Errorf("ID did not match expected: %s", resp)
+	}
+}
+
+func TestGettingItemForLabelWithEmptyTitle(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"wbsearch":[{"ns":120,"title":"Item:","pageid":11,"displaytext":"blah"}]}}
+`)
+	wikibase := NewClient(client)
+
+	_, err := wikibase.FetchItemIDsForLabel("blah")
+
+	if err == nil {
+		t.Errorf("Expected an error but didn't get one")
+	}
+}
+
 func TestGettingPropertyForLabel(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
+	client := &MockNetworkClient{}
+	client.AddResponse(`
 {
     "batchcomplete": "",
     "requestid": "42",
@@ -247,69 +324,989 @@ func TestGettingPropertyForLabel(t *testing.T) {
 	}
 
 	// Check that the request was also sane
-	if client.MostRecentArgs["action"] != "query" {
-		t.Errorf("Unexpected action requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["action"] != "query" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["list"] != "wbsearch" {
-		t.Errorf("Unexpected list requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["list"] != "wbsearch" {
+		t.Errorf("Unexpected list requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["wbssearch"] != "blah" {
-		t.Errorf("Unexpected search requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["wbssearch"] != "blah" {
+		t.Errorf("Unexpected search requested: %v", client.LastArgs())
 	}
-	if client.MostRecentArgs["wbstype"] != "property" {
-		t.Errorf("Unexpected type requested: %v", client.MostRecentArgs)
+	if client.LastArgs()["wbstype"] != "property" {
+		t.Errorf("Unexpected type requested: %v", client.LastArgs())
 	}
 }
 
-// Page protection tests
+func TestNegativeLookupCache(t *testing.T) {
 
-func TestProtectPageByID(t *testing.T) {
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"batchcomplete":"","query":{"wbsearch":[]}}`)
+	client.AddResponse(`{"batchcomplete":"","query":{"wbsearch":[]}}`)
+	wikibase := NewClient(client)
+	wikibase.NegativeLookupCacheTTL = time.Minute
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
-    	{"protect":{"title":"Hello","reason":"","protections":[{"edit":"sysop","expiry":"infinite"}]}}
+	for i := 0; i < 2; i++ {
+		resp, err := wikibase.FetchPropertyIDsForLabel("blah")
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+		if len(resp) != 0 {
+			t.Errorf("Got more response than expected: %v", resp)
+		}
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Expected missing label to be cached: %v", client)
+	}
+
+	// The cache is per type, so looking for an item with the same label should still go to the network
+	_, err := wikibase.FetchItemIDsForLabel("blah")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Expected item lookup to hit network: %v", client)
+	}
+
+	// The cache is per language too, so a label missing in one language is still looked for in another
+	client.AddResponse(`{"batchcomplete":"","query":{"wbsearch":[]}}`)
+	wikibase.Language = "fr"
+	_, err = wikibase.FetchPropertyIDsForLabel("blah")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if client.InvocationCount != 3 || client.LastArgs()["wbslanguage"] != "fr" {
+		t.Errorf("Expected lookup in another language to hit network: %v", client.LastArgs())
+	}
+}
+
+func TestNegativeLookupCacheExpires(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"batchcomplete":"","query":{"wbsearch":[]}}`)
+	client.AddResponse(`{"batchcomplete":"","query":{"wbsearch":[]}}`)
+	wikibase := NewClient(client)
+	wikibase.NegativeLookupCacheTTL = time.Minute
+
+	_, err := wikibase.FetchPropertyIDsForLabel("blah")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	key := wikibase.negativeLookupCacheKey(WikiBaseProperty, "blah")
+	wikibase.negativeLookupCache[key] = time.Now().Add(-time.Second)
+
+	_, err = wikibase.FetchPropertyIDsForLabel("blah")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Expected expired entry to hit network: %v", client)
+	}
+}
+
+func TestNegativeLookupCacheOffByDefault(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"batchcomplete":"","query":{"wbsearch":[]}}`)
+	client.AddResponse(`{"batchcomplete":"","query":{"wbsearch":[]}}`)
+	wikibase := NewClient(client)
+
+	for i := 0; i < 2; i++ {
+		_, err := wikibase.FetchPropertyIDsForLabel("blah")
+		if err != nil {
+			t.Fatalf("Got unexpected error: %v", err)
+		}
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Expected both lookups to hit network: %v", client)
+	}
+}
+
+// Article tests
+
+func TestFetchPageIDForTitle(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"pages":{"94":{"pageid":94,"ns":0,"title":"Hello world"}}}}
+`)
+	wikibase := NewClient(client)
+
+	id, err := wikibase.FetchPageIDForTitle("Hello world")
+
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if id != 94 {
+		t.Errorf("Got unexpected page ID: %d", id)
+	}
+
+	// Check that the request was also sane
+	if client.LastArgs()["action"] != "query" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["titles"] != "Hello world" {
+		t.Errorf("Unexpected titles requested: %v", client.LastArgs())
+	}
+}
+
+func TestPageIDForEntity(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"pages":{"1234":{"pageid":1234,"ns":120,"title":"Item:Q42"}}}}
+`)
+	client.AddResponse(`
+{"batchcomplete":"","query":{"pages":{"5678":{"pageid":5678,"ns":0,"title":"Q42"}}}}
+`)
+	wikibase := NewClient(client)
+
+	id, err := wikibase.PageIDForEntity("Q42")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if id != 1234 {
+		t.Errorf("Got unexpected page ID: %d", id)
+	}
+	if client.LastArgs()["titles"] != "Item:Q42" {
+		t.Errorf("Unexpected titles requested: %v", client.LastArgs())
+	}
+
+	// Items in the main namespace, as on Wikidata
+	wikibase.EntityNamespaces = map[string]string{"item": "", "property": "Property"}
+	id, err = wikibase.PageIDForEntity("Q42")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if id != 5678 {
+		t.Errorf("Got unexpected page ID: %d", id)
+	}
+	if client.LastArgs()["titles"] != "Q42" {
+		t.Errorf("Unexpected titles requested: %v", client.LastArgs())
+	}
+
+	_, err = wikibase.PageIDForEntity("L7")
+	if err == nil {
+		t.Errorf("Expected an error for an entity type with no namespace")
+	}
+	if client.InvocationCount != 2 {
+		t.Errorf("Unexpected invocation count: %d", client.InvocationCount)
+	}
+}
+
+func TestFetchPageIDForNormalizedTitle(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"normalized":[{"from":"hello_world","to":"Hello world"}],"pages":{"94":{"pageid":94,"ns":0,"title":"Hello world"}}}}
+`)
+	wikibase := NewClient(client)
+
+	id, err := wikibase.FetchPageIDForTitle("hello_world")
+
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if id != 94 {
+		t.Errorf("Got unexpected page ID: %d", id)
+	}
+}
+
+func TestFetchPageIDForMissingTitle(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"normalized":[{"from":"nope","to":"Nope"}],"pages":{"-1":{"ns":0,"title":"Nope","missing":""}}}}
+`)
+	wikibase := NewClient(client)
+
+	_, err := wikibase.FetchPageIDForTitle("nope")
+
+	if err == nil {
+		t.Errorf("Expected an error but didn't get one")
+	}
+}
+
+func TestCreateOrUpdateArticle(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"edit":{"result":"Success","pageid":94,"title":"Article:Hello","contentmodel":"wikitext","oldrevid":0,"newrevid":371,"newtimestamp":"2018-12-18T16:59:42Z","new":""}}
 `)
 	wikibase := NewClient(client)
 	token := "insertokenhere"
 	wikibase.editToken = &token
 
-	err := wikibase.ProtectPageByID(42)
+	id, err := wikibase.CreateOrUpdateArticle("Hello", "world")
 
 	if err != nil {
-		t.Errorf("Got unexpected error: %v", err)
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if id != 94 {
+		t.Errorf("Got unexpected page ID: %d", id)
+	}
+
+	// Check that the request was also sane
+	if client.LastArgs()["action"] != "edit" {
+		t.Errorf("Unexpected action requested: %v", client.LastArgs())
+	}
+	if client.LastArgs()["title"] != "article:Hello" {
+		t.Errorf("Unexpected title requested: %v", client.LastArgs())
 	}
 }
 
-func TestProtectPageByTitle(t *testing.T) {
+func TestCreateOrUpdateArticleProtected(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
-    	{"protect":{"title":"Hello","reason":"","protections":[{"edit":"sysop","expiry":"infinite"}]}}
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"error":{"code":"protectedpage","info":"This page has been protected to prevent editing or other actions.","*":"See http://localhost:8181/w/api.php for API usage."}}
 `)
 	wikibase := NewClient(client)
 	token := "insertokenhere"
 	wikibase.editToken = &token
 
-	err := wikibase.ProtectPageByTitle("hello")
+	_, err := wikibase.CreateOrUpdateArticle("Hello", "world")
+
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	perr, ok := err.(*ProtectedPageError)
+	if !ok {
+		t.Fatalf("We expected a protected page error, got %T: %v", err, err)
+	}
+	if perr.Title != "Hello" || perr.Code != "protectedpage" {
+		t.Errorf("Got unexpected error contents: %v", perr)
+	}
+}
+
+func TestCreateOrUpdateArticleWithTags(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"edit":{"result":"Success","pageid":94,"title":"Article:Hello","contentmodel":"wikitext","oldrevid":0,"newrevid":371,"newtimestamp":"2018-12-18T16:59:42Z","new":""}}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+	wikibase.EditTags = []string{"import", "ORM"}
+
+	_, err := wikibase.CreateOrUpdateArticle("Hello", "world")
 
 	if err != nil {
-		t.Errorf("Got unexpected error: %v", err)
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if client.LastArgs()["tags"] != "import|ORM" {
+		t.Errorf("Unexpected tags requested: %v", client.LastArgs())
 	}
 }
 
-func TestProtectPageGetsError(t *testing.T) {
+func TestCreateOrUpdateArticleMinor(t *testing.T) {
 
-	client := &WikiBaseNetworkTestClient{}
-	client.addDataResponse(`
-    	 {"error":{"code":"nosuchpageid","info":"There is no page with ID 742232.","*":"See http://localhost:8181/w/api.php for API usage. Subscribe to the mediawiki-api-announce mailing list at &lt;https://lists.wikimedia.org/mailman/listinfo/mediawiki-api-announce&gt; for notice of API deprecations and breaking changes."}}
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"edit":{"result":"Success","pageid":94,"title":"Article:Hello","contentmodel":"wikitext","oldrevid":370,"newrevid":371,"newtimestamp":"2018-12-18T16:59:42Z"}}
+`)
+	client.AddResponse(`
+{"edit":{"result":"Success","pageid":94,"title":"Article:Hello","contentmodel":"wikitext","oldrevid":371,"newrevid":372,"newtimestamp":"2018-12-18T17:01:42Z"}}
 `)
 	wikibase := NewClient(client)
 	token := "insertokenhere"
 	wikibase.editToken = &token
 
-	err := wikibase.ProtectPageByID(42)
+	_, err := wikibase.CreateOrUpdateArticle("Hello", "world")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if _, ok := client.LastArgs()["minor"]; ok {
+		t.Errorf("Unexpected minor flag: %v", client.LastArgs())
+	}
+
+	wikibase.MinorEdits = true
+	_, err = wikibase.CreateOrUpdateArticle("Hello", "world!")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if client.LastArgs()["minor"] != "1" {
+		t.Errorf("Expected minor flag: %v", client.LastArgs())
+	}
+}
+
+func TestCreateOrUpdateArticleWithBadTags(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"error":{"code":"tags-apply-not-allowed-one","info":"The tag \"wibble\" is not allowed to be manually applied.","*":"See http://localhost:8181/w/api.php for API usage."}}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+	wikibase.EditTags = []string{"wibble"}
+
+	_, err := wikibase.CreateOrUpdateArticle("Hello", "world")
 
 	if err == nil {
-		t.Errorf("We expected an error")
+		t.Fatalf("We expected an error")
+	}
+	if !strings.Contains(err.Error(), "EditTags") {
+		t.Errorf("Expected error to mention tags: %v", err)
+	}
+}
+
+func TestCreateOrUpdateArticleWithAssertUser(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"edit":{"result":"Success","pageid":94,"title":"Article:Hello","contentmodel":"wikitext","oldrevid":0,"newrevid":371,"newtimestamp":"2018-12-18T16:59:42Z","new":""}}
+`)
+	client.AddResponse(`
+{"error":{"code":"assertuserfailed","info":"Assertion that the user is \"ContentMineBot\" failed.","*":"See http://localhost:8181/w/api.php for API usage."}}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+	wikibase.AssertUser = "ContentMineBot"
+
+	_, err := wikibase.CreateOrUpdateArticle("Hello", "world")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if client.LastArgs()["assertuser"] != "ContentMineBot" {
+		t.Errorf("Unexpected assertuser requested: %v", client.LastArgs())
+	}
+
+	_, err = wikibase.CreateOrUpdateArticle("Hello", "world")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	apierr, ok := err.(*APIError)
+	if !ok || apierr.Code != "assertuserfailed" {
+		t.Errorf("Expected assertuserfailed error, got %T: %v", err, err)
+	}
+	if !strings.Contains(err.Error(), "AssertUser") {
+		t.Errorf("Expected error to mention AssertUser: %v", err)
+	}
+}
+
+// slowNetworkClient records how many requests are in flight at once, where a request is in flight until the
+// response is closed.
+type slowNetworkClient struct {
+	lock        sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+type slowNetworkClientResponse struct {
+	io.Reader
+	client *slowNetworkClient
+}
+
+func (r *slowNetworkClientResponse) Close() error {
+	r.client.lock.Lock()
+	defer r.client.lock.Unlock()
+	r.client.inFlight -= 1
+	return nil
+}
+
+func (c *slowNetworkClient) Get(args map[string]string) (io.ReadCloser, error) {
+	return c.Post(args)
+}
+
+func (c *slowNetworkClient) Post(args map[string]string) (io.ReadCloser, error) {
+	c.lock.Lock()
+	c.inFlight += 1
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	c.lock.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	data := `{"edit":{"result":"Success","pageid":94,"title":"Article:Hello","contentmodel":"wikitext","newrevid":371}}`
+	return &slowNetworkClientResponse{Reader: strings.NewReader(data), client: c}, nil
+}
+
+func TestMaxConcurrentWrites(t *testing.T) {
+
+	client := &slowNetworkClient{}
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+	wikibase.MaxConcurrentWrites = 3
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := wikibase.CreateOrUpdateArticle(fmt.Sprintf("Hello %d", i), "world")
+			if err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+	if client.maxInFlight > 3 {
+		t.Errorf("Too many writes in flight at once: %d", client.maxInFlight)
+	}
+	if client.maxInFlight < 2 {
+		t.Errorf("Expected writes to run concurrently: %d", client.maxInFlight)
+	}
+}
+
+// Page protection tests
+
+func TestProtectPageByID(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+    	{"protect":{"title":"Hello","reason":"","protections":[{"edit":"sysop","expiry":"infinite"}]}}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.ProtectPageByID(42)
+
+	if err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+}
+
+func TestProtectPageByTitle(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+    	{"protect":{"title":"Hello","reason":"","protections":[{"edit":"sysop","expiry":"infinite"}]}}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.ProtectPageByTitle("hello")
+
+	if err != nil {
+		t.Errorf("Got unexpected error: %v", err)
+	}
+}
+
+func TestProtectPageGetsError(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+    	 {"error":{"code":"nosuchpageid","info":"There is no page with ID 742232.","*":"See http://localhost:8181/w/api.php for API usage. Subscribe to the mediawiki-api-announce mailing list at &lt;https://lists.wikimedia.org/mailman/listinfo/mediawiki-api-announce&gt; for notice of API deprecations and breaking changes."}}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.ProtectPageByID(42)
+
+	if err == nil {
+		t.Errorf("We expected an error")
+	}
+}
+
+// Undelete tests
+
+func TestUndeletePageByTitle(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+    	{"undelete":{"title":"Hello","revisions":3,"fileversions":0,"reason":"Bad bot run"}}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.UndeletePageByTitle("Hello", "Bad bot run")
+
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	args := client.LastArgs()
+	if args["action"] != "undelete" {
+		t.Errorf("Wrong action: %v", args)
+	}
+	if args["title"] != "Hello" || args["reason"] != "Bad bot run" || args["token"] != token {
+		t.Errorf("Wrong arguments: %v", args)
+	}
+}
+
+func TestUndeletePageByTitleCantUndelete(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+    	{"error":{"code":"cantundelete","info":"Couldn't undelete: the requested revisions may not exist, or may have been undeleted already.","*":"See http://localhost:8181/w/api.php for API usage."}}
+`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	err := wikibase.UndeletePageByTitle("Hello", "Bad bot run")
+
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	aerr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("We expected an API error, got %T: %v", err, err)
+	}
+	if aerr.Code != "cantundelete" {
+		t.Errorf("Wrong error code: %v", aerr)
+	}
+}
+
+// Patrol tests
+
+func TestPatrolRevision(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"batchcomplete":"","query":{"tokens":{"patroltoken":"patroltoken+\\"}}}`)
+	client.AddResponse(`{"patrol":{"rcid":1234,"ns":0,"title":"Hello"}}`)
+	wikibase := NewClient(client)
+
+	err := wikibase.PatrolRevision(371)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+
+	args := client.LastArgs()
+	if args["action"] != "patrol" || args["revid"] != "371" || args["token"] != "patroltoken+\\" {
+		t.Errorf("Wrong arguments: %v", args)
+	}
+
+	// The token should be cached, so a second patrol makes only one request
+	client.AddResponse(`{"patrol":{"rcid":1235,"ns":0,"title":"Hello"}}`)
+	err = wikibase.PatrolRevision(372)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if client.InvocationCount != 3 {
+		t.Errorf("Expected token to be cached, made %d calls", client.InvocationCount)
+	}
+}
+
+func TestPatrolRevisionTokenType(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"batchcomplete":"","query":{"tokens":{"patroltoken":"patroltoken+\\"}}}`)
+	wikibase := NewClient(client)
+
+	token, err := wikibase.GetToken("patrol")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if token != "patroltoken+\\" {
+		t.Errorf("Wrong token: %s", token)
+	}
+
+	args := client.LastArgs()
+	if args["meta"] != "tokens" || args["type"] != "patrol" {
+		t.Errorf("Wrong token request: %v", args)
+	}
+}
+
+func TestPatrolRevisionNoSuchRCID(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"batchcomplete":"","query":{"tokens":{"patroltoken":"patroltoken+\\"}}}`)
+	client.AddResponse(`{"error":{"code":"nosuchrcid","info":"There is no recent change with ID 371.","*":"See http://localhost:8181/w/api.php for API usage."}}`)
+	wikibase := NewClient(client)
+
+	err := wikibase.PatrolRevision(371)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	perr, ok := err.(*PatrolError)
+	if !ok {
+		t.Fatalf("We expected a patrol error, got %T: %v", err, err)
+	}
+	if perr.Code != "nosuchrcid" || perr.RevID != 371 {
+		t.Errorf("Wrong error details: %v", perr)
+	}
+}
+
+// Default parameter tests
+
+func TestDefaultParams(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"batchcomplete":"","query":{"wbsearch":[]}}`)
+	client.AddResponse(`{"edit":{"result":"Success","pageid":94,"title":"Article:Hello","contentmodel":"wikitext","newrevid":371}}`)
+	wikibase := NewClient(client)
+	wikibase.DefaultParams = map[string]string{"centralauthtoken": "abc123", "action": "shouldnotoverride"}
+	token := "insertokenhere"
+	wikibase.editToken = &token
+
+	_, err := wikibase.FetchItemIDsForLabel("hello")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if client.LastArgs()["centralauthtoken"] != "abc123" {
+		t.Errorf("Default param missing from read: %v", client.LastArgs())
+	}
+	if client.LastArgs()["action"] != "query" {
+		t.Errorf("Default param should not override request: %v", client.LastArgs())
+	}
+
+	_, err = wikibase.CreateOrUpdateArticle("Hello", "world")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if client.LastArgs()["centralauthtoken"] != "abc123" {
+		t.Errorf("Default param missing from write: %v", client.LastArgs())
+	}
+	if client.LastArgs()["action"] != "edit" {
+		t.Errorf("Default param should not override request: %v", client.LastArgs())
+	}
+}
+
+func TestSearchEntitiesByPrefix(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"searchinfo":{"search":"Douglas Ad"},"search":[
+    {"id":"Q42","title":"Q42","label":"Douglas Adams","description":"English writer and humorist",
+     "match":{"type":"label","language":"en","text":"Douglas Adams"}},
+    {"id":"Q21401869","title":"Q21401869","label":"Douglas Adams","description":"American environmental engineer",
+     "match":{"type":"label","language":"en","text":"Douglas Adams"}}
+],"success":1}
+`)
+	wikibase := NewClient(client)
+
+	results, err := wikibase.SearchEntities("Douglas Ad", WikiBaseItem, SearchPrefix, 5)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	expected := []SearchResult{
+		{ID: "Q42", Label: "Douglas Adams", Description: "English writer and humorist"},
+		{ID: "Q21401869", Label: "Douglas Adams", Description: "American environmental engineer"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Got unexpected results: %v", results)
+	}
+
+	args := client.LastArgs()
+	if args["action"] != "wbsearchentities" || args["search"] != "Douglas Ad" || args["type"] != "item" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+	if args["language"] != "en" || args["limit"] != "5" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+}
+
+const testSiteInfoNamespacesResponse = `
+{"batchcomplete":"","query":{"namespaces":{
+    "0":{"id":0,"case":"first-letter","content":"","*":""},
+    "120":{"id":120,"case":"first-letter","canonical":"Item","*":"Item"},
+    "122":{"id":122,"case":"first-letter","canonical":"Property","*":"Property"}
+}}}
+`
+
+func TestSearchEntitiesByFullText(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(testSiteInfoNamespacesResponse)
+	client.AddResponse(`
+{"batchcomplete":"","query":{"search":[
+    {"ns":120,"title":"Item:Q42","pageid":138},
+    {"ns":122,"title":"Property:P50","pageid":70},
+    {"ns":120,"title":"Item:Q5","pageid":9}
+]}}
+`)
+	client.AddResponse(`
+{"entities":{
+    "Q42":{"type":"item","id":"Q42","labels":{"en":{"language":"en","value":"Douglas Adams"}},
+        "descriptions":{"en":{"language":"en","value":"English writer and humorist"}}},
+    "Q5":{"type":"item","id":"Q5","labels":{"en":{"language":"en","value":"human"}},"descriptions":{}}
+},"success":1}
+`)
+	wikibase := NewClient(client)
+
+	results, err := wikibase.SearchEntities("hitchhiker writer", WikiBaseItem, SearchFullText, 10)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	expected := []SearchResult{
+		{ID: "Q42", Label: "Douglas Adams", Description: "English writer and humorist"},
+		{ID: "Q5", Label: "human"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Got unexpected results: %v", results)
+	}
+	if client.InvocationCount != 3 {
+		t.Errorf("Got unexpected invocation count: %d", client.InvocationCount)
+	}
+	if client.LastArgs()["ids"] != "Q42|Q5" || client.LastArgs()["languages"] != "en" {
+		t.Errorf("Unexpected terms request: %v", client.LastArgs())
+	}
+
+	// Properties are searched for in their own namespace, which is already known
+	client.AddResponse(`{"batchcomplete":"","query":{"search":[]}}`)
+	results, err = wikibase.SearchEntities("author", WikiBaseProperty, SearchFullText, 10)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if len(results) != 0 || client.InvocationCount != 4 {
+		t.Errorf("Got unexpected results: %v %d", results, client.InvocationCount)
+	}
+	if client.LastArgs()["list"] != "search" || client.LastArgs()["srnamespace"] != "122" {
+		t.Errorf("Unexpected search request: %v", client.LastArgs())
+	}
+}
+
+func TestSearchEntitiesByFullTextMainNamespace(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"batchcomplete":"","query":{"search":[]}}`)
+	wikibase := NewClient(client)
+	wikibase.EntityNamespaces = map[string]string{"item": "", "property": "Property"}
+
+	_, err := wikibase.SearchEntities("Douglas", WikiBaseItem, SearchFullText, 10)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if client.InvocationCount != 1 || client.LastArgs()["srnamespace"] != "0" {
+		t.Errorf("Expected the main namespace to be searched: %v", client.LastArgs())
+	}
+}
+
+func TestSearchEntitiesInvalidMode(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+
+	_, err := wikibase.SearchEntities("Douglas", WikiBaseItem, SearchMode(7), 0)
+	if err == nil {
+		t.Errorf("We expected an error")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %d", client.InvocationCount)
+	}
+}
+
+func TestFetchItemsByStatement(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","query":{"searchinfo":{"totalhits":2},"search":[{"ns":120,"title":"Item:Q42","pageid":141},{"ns":120,"title":"Item:Q1337","pageid":1502}]}}
+`)
+	wikibase := NewClient(client)
+
+	items, err := wikibase.FetchItemsByStatement("P356", "10.1000/xyz123")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(items, []ItemPropertyType{"Q42", "Q1337"}) {
+		t.Errorf("We got the wrong items: %v", items)
+	}
+
+	args := client.LastArgs()
+	if args["list"] != "search" || args["srsearch"] != "haswbstatement:P356=10.1000/xyz123" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+}
+
+func TestFetchItemsByStatementContinues(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"continue":{"sroffset":1,"continue":"-||"},"query":{"search":[{"ns":0,"title":"Q42","pageid":141}]}}
+`)
+	client.AddResponse(`
+{"batchcomplete":"","query":{"search":[{"ns":120,"title":"Property:P5","pageid":9},{"ns":0,"title":"Q7","pageid":12}]}}
+`)
+	wikibase := NewClient(client)
+
+	items, err := wikibase.FetchItemsByStatement("P496", "0000-0002-1825-0097")
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(items, []ItemPropertyType{"Q42", "Q7"}) {
+		t.Errorf("We got the wrong items: %v", items)
+	}
+	if client.InvocationCount != 2 {
+		t.Fatalf("Got unexpected invocation count: %v", client)
+	}
+	if client.LastArgs()["sroffset"] != "1" {
+		t.Errorf("Unexpected request: %v", client.LastArgs())
+	}
+}
+
+func TestFetchItemsByStatementQuotesValue(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"batchcomplete":"","query":{"search":[]}}`)
+	wikibase := NewClient(client)
+
+	items, err := wikibase.FetchItemsByStatement("P1476", `The "Hitchhiker's" Guide`)
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(items) != 0 {
+		t.Errorf("We expected no items: %v", items)
+	}
+	if client.LastArgs()["srsearch"] != `haswbstatement:"P1476=The \"Hitchhiker's\" Guide"` {
+		t.Errorf("Unexpected request: %v", client.LastArgs())
+	}
+}
+
+func TestFetchItemsByStatementInvalidProperty(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	wikibase := NewClient(client)
+
+	_, err := wikibase.FetchItemsByStatement("Q42", "value")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 0 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestRecentChanges(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`
+{"batchcomplete":"","continue":{"rccontinue":"20180501120500|1235","continue":"-||"},"query":{"recentchanges":[
+    {"type":"new","ns":120,"title":"Item:Q11","pageid":20,"revid":81,"old_revid":0,"rcid":1233,"timestamp":"2018-05-01T12:00:00Z"},
+    {"type":"edit","ns":120,"title":"Item:Q11","pageid":20,"revid":82,"old_revid":81,"rcid":1234,"timestamp":"2018-05-01T12:05:00Z"}
+]}}
+`)
+	client.AddResponse(`
+{"batchcomplete":"","query":{"recentchanges":[
+    {"type":"log","ns":2,"title":"User:Bot","pageid":0,"revid":0,"old_revid":0,"rcid":1235,"timestamp":"2018-05-01T12:05:00Z"}
+]}}
+`)
+	wikibase := NewClient(client)
+
+	since := time.Date(2018, 5, 1, 13, 0, 0, 0, time.FixedZone("BST", 3600))
+	changes, err := wikibase.RecentChanges(since, []int{120, 2})
+	if err != nil {
+		t.Fatalf("We got an unexpected error: %v", err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("We got the wrong number of changes: %v", changes)
+	}
+	if changes[0].Type != "new" || changes[0].Title != "Item:Q11" || changes[0].RevID != 81 {
+		t.Errorf("We got the wrong first change: %v", changes[0])
+	}
+	if changes[1].OldRevID != 81 || !changes[1].Timestamp.Equal(time.Date(2018, 5, 1, 12, 5, 0, 0, time.UTC)) {
+		t.Errorf("We got the wrong second change: %v", changes[1])
+	}
+	if changes[2].Type != "log" {
+		t.Errorf("We got the wrong last change: %v", changes[2])
+	}
+
+	if client.InvocationCount != 2 {
+		t.Fatalf("Got unexpected invocation count: %v", client)
+	}
+	args := client.LastArgs()
+	if args["list"] != "recentchanges" || args["rcstart"] != "2018-05-01T12:00:00Z" || args["rcdir"] != "newer" ||
+		args["rcnamespace"] != "120|2" || args["rccontinue"] != "20180501120500|1235" {
+		t.Errorf("Unexpected request: %v", args)
+	}
+}
+
+func TestWatchPage(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"batchcomplete":"","query":{"tokens":{"watchtoken":"watchtoken+\\"}}}`)
+	client.AddResponse(`{"batchcomplete":"","watch":[{"ns":120,"title":"Item:Q11","watched":""}]}`)
+	wikibase := NewClient(client)
+
+	err := wikibase.WatchPage("Item:Q11", true)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	args := client.LastArgs()
+	if args["action"] != "watch" || args["titles"] != "Item:Q11" || args["token"] != "watchtoken+\\" {
+		t.Errorf("Wrong arguments: %v", args)
+	}
+	if _, ok := args["unwatch"]; ok {
+		t.Errorf("Should not have unwatched: %v", args)
+	}
+
+	client.AddResponse(`{"batchcomplete":"","watch":[{"ns":120,"title":"Item:Q11","unwatched":""}]}`)
+	err = wikibase.WatchPage("Item:Q11", false)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if client.LastArgs()["unwatch"] != "1" {
+		t.Errorf("Wrong arguments: %v", client.LastArgs())
+	}
+}
+
+func TestWatchlistOnEdits(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"edit":{"result":"Success","pageid":94,"title":"Article:Hello","contentmodel":"wikitext","oldrevid":371,"newrevid":384,"newtimestamp":"2018-05-02T13:03:21Z"}}`)
+	wikibase := NewClient(client)
+	token := "insertokenhere"
+	wikibase.editToken = &token
+	wikibase.Watchlist = "watch"
+
+	_, err := wikibase.CreateOrUpdateArticle("Hello", "world")
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if client.LastArgs()["watchlist"] != "watch" {
+		t.Errorf("Wrong arguments: %v", client.LastArgs())
+	}
+
+	wikibase.Watchlist = "always"
+	_, err = wikibase.CreateOrUpdateArticle("Hello", "world")
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	if client.InvocationCount != 1 {
+		t.Errorf("Got unexpected invocation count: %v", client)
+	}
+}
+
+func TestCompareRevisions(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"compare":{"fromid":94,"fromrevid":371,"fromns":0,"fromtitle":"Article:Hello","toid":94,"torevid":384,"tons":0,"totitle":"Article:Hello","*":"<tr><td class=\"diff-marker\">−</td><td class=\"diff-deletedline\"><div>world</div></td></tr>"}}`)
+	wikibase := NewClient(client)
+
+	diff, err := wikibase.CompareRevisions(371, 384)
+	if err != nil {
+		t.Fatalf("Got unexpected error: %v", err)
+	}
+	if diff != `<tr><td class="diff-marker">−</td><td class="diff-deletedline"><div>world</div></td></tr>` {
+		t.Errorf("We got the wrong diff: %v", diff)
+	}
+
+	args := client.LastArgs()
+	if args["action"] != "compare" || args["fromrev"] != "371" || args["torev"] != "384" {
+		t.Errorf("Wrong arguments: %v", args)
+	}
+}
+
+func TestCompareMissingRevision(t *testing.T) {
+
+	client := &MockNetworkClient{}
+	client.AddResponse(`{"error":{"code":"nosuchrevid","info":"There is no revision with ID 999."}}`)
+	wikibase := NewClient(client)
+
+	_, err := wikibase.CompareRevisions(371, 999)
+	if err == nil {
+		t.Fatalf("We expected an error")
+	}
+	revision_err, ok := err.(*NoSuchRevisionError)
+	if !ok {
+		t.Fatalf("We got the wrong error type: %v", err)
+	}
+	if revision_err.FromRev != 371 || revision_err.ToRev != 999 {
+		t.Errorf("We got the wrong error details: %v", revision_err)
 	}
 }